@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ActivationOptions controls a staged activation. The zero value unfreezes
+// from the most connected cube of each body outward, 200ms apart, without
+// ramping anything.
+type ActivationOptions struct {
+	// Roots are the cubes (server names) activation starts from. Each
+	// connected part of the scene without a root starts from its most
+	// jointed cube.
+	Roots []string
+	// Stages overrides the computed order entirely: each entry is unfrozen
+	// together. Cubes left out stay frozen.
+	Stages     [][]string
+	StageDelay time.Duration
+	// Ramps move joint params from a soft start to their final values as
+	// the stages unfreeze, reaching To with the last stage.
+	Ramps []ParamRamp
+	// Activation aborts and refreezes everything it unfroze when a cube
+	// moves faster than this (m/s) or spins faster than MaxAngularSpeed
+	// (rad/s). Zero uses 20 m/s and 30 rad/s.
+	MaxLinearSpeed  float64
+	MaxAngularSpeed float64
+}
+
+// ParamRamp moves one joint param from From to To.
+type ParamRamp struct {
+	Param    string
+	From, To float64
+}
+
+// parseParamRamp reads "motor_max_impulse=100:1000".
+func parseParamRamp(s string) (ParamRamp, error) {
+	param, span, ok := strings.Cut(s, "=")
+	from, to, ok2 := strings.Cut(span, ":")
+	if !ok || !ok2 || param == "" {
+		return ParamRamp{}, fmt.Errorf("ramp %q: want param=from:to", s)
+	}
+	f, err1 := strconv.ParseFloat(from, 64)
+	t, err2 := strconv.ParseFloat(to, 64)
+	if err1 != nil || err2 != nil {
+		return ParamRamp{}, fmt.Errorf("ramp %q: from and to must be numbers", s)
+	}
+	return ParamRamp{Param: param, From: f, To: t}, nil
+}
+
+// at returns the ramp's value a fraction t of the way through.
+func (r ParamRamp) at(t float64) float64 {
+	return r.From + (r.To-r.From)*t
+}
+
+// activationStages orders the scene's cubes for unfreezing: breadth-first
+// over the joint graph from each root, one stage per step away from it, so
+// every cube wakes up attached to something already moving. Cubes without
+// joints come last, together.
+func activationStages(scene Scene, roots []string) [][]string {
+	neighbors := make(map[string][]string)
+	for _, joint := range scene.Joints {
+		if joint.CubeA != "" && joint.CubeB != "" {
+			neighbors[joint.CubeA] = append(neighbors[joint.CubeA], joint.CubeB)
+			neighbors[joint.CubeB] = append(neighbors[joint.CubeB], joint.CubeA)
+		}
+	}
+	cubes := make([]string, 0, len(scene.Cubes))
+	for _, cube := range scene.Cubes {
+		cubes = append(cubes, cube.Name)
+	}
+	// Most jointed first, so parts without a given root start from their
+	// hub rather than from a foot.
+	sort.SliceStable(cubes, func(i, j int) bool {
+		return len(neighbors[cubes[i]]) > len(neighbors[cubes[j]])
+	})
+
+	seen := make(map[string]bool)
+	var stages [][]string
+	grow := func(frontier []string) {
+		for depth := 0; len(frontier) > 0; depth++ {
+			if depth == len(stages) {
+				stages = append(stages, nil)
+			}
+			stages[depth] = append(stages[depth], frontier...)
+			var next []string
+			for _, cube := range frontier {
+				for _, n := range neighbors[cube] {
+					if !seen[n] {
+						seen[n] = true
+						next = append(next, n)
+					}
+				}
+			}
+			frontier = next
+		}
+	}
+
+	var start []string
+	for _, root := range roots {
+		if !seen[root] {
+			seen[root] = true
+			start = append(start, root)
+		}
+	}
+	grow(start)
+	var loose []string
+	for _, cube := range cubes {
+		switch {
+		case seen[cube]:
+		case len(neighbors[cube]) == 0:
+			seen[cube] = true
+			loose = append(loose, cube)
+		default:
+			seen[cube] = true
+			grow([]string{cube})
+		}
+	}
+	if len(loose) > 0 {
+		stages = append(stages, loose)
+	}
+	for _, stage := range stages {
+		slices.Sort(stage)
+	}
+	return stages
+}
+
+// activate unfreezes a frozen scene in stages instead of all at once. After
+// each stage the ramped joint params step toward their final values, and
+// once the stage has had StageDelay to settle the unfrozen cubes' velocities
+// are checked. A spike, or any error once unfreezing has begun, refreezes
+// everything activate unfroze.
+func (s *Session) activate(scene Scene, opts ActivationOptions) error {
+	stages := opts.Stages
+	if stages == nil {
+		stages = activationStages(scene, opts.Roots)
+	}
+	if opts.StageDelay <= 0 {
+		opts.StageDelay = 200 * time.Millisecond
+	}
+	if opts.MaxLinearSpeed <= 0 {
+		opts.MaxLinearSpeed = 20
+	}
+	if opts.MaxAngularSpeed <= 0 {
+		opts.MaxAngularSpeed = 30
+	}
+	for _, ramp := range opts.Ramps {
+		for _, t := range []float64{0, 1} {
+			if err := validateJointParams("", map[string]float64{ramp.Param: ramp.at(t)}); err != nil {
+				return fmt.Errorf("[Activate] %v", err)
+			}
+		}
+	}
+
+	// Joints start soft, before anything can move.
+	if err := s.rampJointParams(scene, opts.Ramps, 0); err != nil {
+		return err
+	}
+
+	var awake []string
+	done := false
+	defer func() {
+		if done || len(awake) == 0 {
+			return
+		}
+		if err := s.freezeCubes(awake, true); err != nil {
+			fmt.Println("[Activate]", err)
+			return
+		}
+		fmt.Printf("[Activate] Refroze %d cubes\n", len(awake))
+	}()
+	for i, stage := range stages {
+		// A failed unfreeze may still have woken part of the stage.
+		awake = append(awake, stage...)
+		if err := s.freezeCubes(stage, false); err != nil {
+			return err
+		}
+		fmt.Printf("[Activate] Stage %d/%d: unfroze %d cubes\n", i+1, len(stages), len(stage))
+
+		if err := s.rampJointParams(scene, opts.Ramps, float64(i+1)/float64(len(stages))); err != nil {
+			return err
+		}
+		time.Sleep(opts.StageDelay)
+
+		states, err := s.getCubeStates(awake)
+		if err != nil {
+			return err
+		}
+		if cube, what := velocitySpike(states, opts.MaxLinearSpeed, opts.MaxAngularSpeed); cube != "" {
+			return fmt.Errorf("[Activate] Aborted at stage %d/%d: %s %s", i+1, len(stages), cube, what)
+		}
+	}
+	done = true
+	fmt.Printf("[Activate] %d cubes active\n", len(awake))
+	return nil
+}
+
+// rampJointParams sets every ramped param a fraction t of the way, on each
+// joint of the scene whose kind has the param.
+func (s *Session) rampJointParams(scene Scene, ramps []ParamRamp, t float64) error {
+	if len(ramps) == 0 {
+		return nil
+	}
+	params := make(map[string]map[string]float64)
+	for _, joint := range scene.Joints {
+		kind := joint.Type
+		if kind == "" {
+			kind = s.jointKind(joint.Name)
+		}
+		for _, ramp := range ramps {
+			value := map[string]float64{ramp.Param: ramp.at(t)}
+			if kind != "" && validateJointParams(kind, value) != nil {
+				continue
+			}
+			if params[joint.Name] == nil {
+				params[joint.Name] = make(map[string]float64)
+			}
+			params[joint.Name][ramp.Param] = ramp.at(t)
+		}
+	}
+	return s.writeJointParams(params)
+}
+
+// velocitySpike returns the first cube, by name, moving or spinning faster
+// than allowed, and how fast.
+func velocitySpike(states map[string]CubeState, maxLinear, maxAngular float64) (string, string) {
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		state := states[name]
+		if v := vecLength(state.LinearVelocity); v > maxLinear {
+			return name, fmt.Sprintf("moves at %.1f m/s", v)
+		}
+		if w := vecLength(state.AngularVelocity); w > maxAngular {
+			return name, fmt.Sprintf("spins at %.1f rad/s", w)
+		}
+	}
+	return "", ""
+}
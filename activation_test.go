@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// stagedScene is a body with a head, two legs and a foot, a separate
+// two-cube arm, and a rock with no joints.
+func stagedScene() Scene {
+	var scene Scene
+	for _, name := range []string{"rock", "head", "leg1", "foot1", "arm1", "body", "leg2", "arm2"} {
+		scene.Cubes = append(scene.Cubes, Cube{Name: name})
+	}
+	scene.Joints = []JointDef{
+		{Name: "neck", CubeA: "body", CubeB: "head"},
+		{Name: "hip1", CubeA: "body", CubeB: "leg1"},
+		{Name: "hip2", CubeA: "leg2", CubeB: "body"},
+		{Name: "ankle", CubeA: "leg1", CubeB: "foot1"},
+		{Name: "elbow", CubeA: "arm1", CubeB: "arm2"},
+		// Half-defined joints connect nothing.
+		{Name: "dangling", CubeA: "rock"},
+	}
+	return scene
+}
+
+func TestActivationStages(t *testing.T) {
+	tests := []struct {
+		name  string
+		roots []string
+		want  string
+	}{
+		// Without roots each part starts from its most jointed cube.
+		{"hub first", nil, "[arm1 body] [arm2 head leg1 leg2] [foot1] [rock]"},
+		{"body root", []string{"body"}, "[arm1 body] [arm2 head leg1 leg2] [foot1] [rock]"},
+		{"foot root", []string{"foot1"}, "[arm1 foot1] [arm2 leg1] [body] [head leg2] [rock]"},
+		{"two roots", []string{"foot1", "arm2", "foot1"}, "[arm2 foot1] [arm1 leg1] [body] [head leg2] [rock]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stages []string
+			for _, stage := range activationStages(stagedScene(), tt.roots) {
+				stages = append(stages, fmt.Sprint(stage))
+			}
+			if got := strings.Join(stages, " "); got != tt.want {
+				t.Errorf("stages = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActivationStagesCycle(t *testing.T) {
+	scene := Scene{
+		Cubes: []Cube{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+		Joints: []JointDef{
+			{Name: "ab", CubeA: "a", CubeB: "b"},
+			{Name: "bc", CubeA: "b", CubeB: "c"},
+			{Name: "ca", CubeA: "c", CubeB: "a"},
+		},
+	}
+	if got := fmt.Sprint(activationStages(scene, []string{"a"})); got != "[[a] [b c]]" {
+		t.Errorf("stages = %s, want [[a] [b c]]", got)
+	}
+	if got := activationStages(Scene{}, nil); len(got) != 0 {
+		t.Errorf("stages of an empty scene = %v", got)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Animation is a sequence of colorings for an image wall. Each frame maps
+// server cube names to "#RRGGBB" for every cube in the wall.
+type Animation struct {
+	Cubes  []Cube // wall layout with logical names
+	Frames []map[string]string
+	Delays []time.Duration // per frame; zero means "use the playback fps"
+}
+
+// PlaybackStats summarizes how well the server kept up with an animation.
+type PlaybackStats struct {
+	Shown    int
+	Dropped  int
+	Commands int           // set_color commands sent
+	MaxSend  time.Duration // slowest frame write
+}
+
+func (st PlaybackStats) String() string {
+	return fmt.Sprintf("%d frames shown, %d dropped, %d set_color commands, slowest frame send %v",
+		st.Shown, st.Dropped, st.Commands, st.MaxSend.Round(time.Microsecond))
+}
+
+// loadFrames decodes an animated GIF or a directory of still images, sorted
+// by file name. GIF frames are composited the way a browser would show them
+// and keep their own delays; directory frames have no delay.
+func loadFrames(path string) ([]image.Image, []time.Duration, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[Animate] %v", err)
+	}
+	if info.IsDir() {
+		return loadFrameDir(path)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".gif") {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("[Animate] %v", err)
+		}
+		defer f.Close()
+		return decodeGIFFrames(f)
+	}
+	img, err := loadImage(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []image.Image{img}, []time.Duration{0}, nil
+}
+
+func loadFrameDir(dir string) ([]image.Image, []time.Duration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[Animate] %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".png", ".gif", ".jpg", ".jpeg":
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("[Animate] No images in %s", dir)
+	}
+	sort.Strings(names)
+
+	frames := make([]image.Image, len(names))
+	for i, name := range names {
+		img, err := loadImage(filepath.Join(dir, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		frames[i] = img
+	}
+	return frames, make([]time.Duration, len(frames)), nil
+}
+
+func decodeGIFFrames(r io.Reader) ([]image.Image, []time.Duration, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[Animate] Failed to decode GIF: %v", err)
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	frames := make([]image.Image, len(g.Image))
+	delays := make([]time.Duration, len(g.Image))
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frames[i] = cloneRGBA(canvas)
+		delays[i] = time.Duration(g.Delay[i]) * 10 * time.Millisecond
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames, delays, nil
+}
+
+func cloneRGBA(src *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(src.Bounds())
+	copy(dst.Pix, src.Pix)
+	return dst
+}
+
+// buildAnimation lays the frames out on one wall. The wall covers every cell
+// that is visible in at least one frame; frames where a cell is transparent
+// paint it with the background color instead.
+func buildAnimation(frames []image.Image, delays []time.Duration, opts ImageWallOptions, background string) (*Animation, ImageWallOptions, error) {
+	if len(frames) == 0 {
+		return nil, opts, fmt.Errorf("[Animate] No frames")
+	}
+	bg, err := Palette(nil).lookup(background)
+	if err != nil {
+		return nil, opts, fmt.Errorf("[Animate] %v", err)
+	}
+	b := frames[0].Bounds()
+	opts = opts.withDefaults(b.Dx(), b.Dy())
+
+	grids := make([][][]cellColor, len(frames))
+	visible := make([][]bool, opts.Height)
+	for y := range visible {
+		visible[y] = make([]bool, opts.Width)
+	}
+	for i, frame := range frames {
+		grids[i] = downsample(frame, opts.Width, opts.Height)
+		for y, row := range grids[i] {
+			for x, cell := range row {
+				visible[y][x] = visible[y][x] || cell.A >= opts.MinAlpha
+			}
+		}
+	}
+
+	anim := &Animation{Delays: delays}
+	for y, row := range visible {
+		for x, ok := range row {
+			if ok {
+				anim.Cubes = append(anim.Cubes, Cube{
+					Name:     opts.pixelName(x, y),
+					Position: opts.pixelPosition(x, y),
+					Color:    bg,
+					Group:    opts.Prefix,
+				})
+			}
+		}
+	}
+	for _, grid := range grids {
+		colors := make(map[string]string, len(anim.Cubes))
+		for y, row := range visible {
+			for x, ok := range row {
+				if !ok {
+					continue
+				}
+				name := serverCubeName(opts.pixelName(x, y))
+				if cell := grid[y][x]; cell.A >= opts.MinAlpha {
+					colors[name] = cell.hex()
+				} else {
+					colors[name] = bg
+				}
+			}
+		}
+		anim.Frames = append(anim.Frames, colors)
+	}
+	return anim, opts, nil
+}
+
+// diffColors returns the entries of next that differ from shown.
+func diffColors(shown, next map[string]string) map[string]string {
+	changes := make(map[string]string)
+	for name, hex := range next {
+		if shown[name] != hex {
+			changes[name] = hex
+		}
+	}
+	return changes
+}
+
+// playAnimation plays an animation on an already spawned wall over one
+// connection, sending only the set_color commands that change between
+// frames. Frames are scheduled against the wall clock; when the server falls
+// so far behind that a frame's slot has already passed, the frame is dropped
+// and the next one is diffed against what is actually on screen. fps
+// overrides the frame delays when positive; frames without a delay default
+// to 10 per second. loops <= 0 plays until stop is closed.
+func (s *Session) playAnimation(anim *Animation, fps float64, loops int, stop <-chan struct{}) (PlaybackStats, error) {
+	var stats PlaybackStats
+	conn, err := s.openBatch()
+	if err != nil {
+		return stats, fmt.Errorf("[Animate] %v", err)
+	}
+	defer conn.finish()
+
+	frameDelay := func(i int) time.Duration {
+		switch {
+		case fps > 0:
+			return time.Duration(float64(time.Second) / fps)
+		case anim.Delays[i] > 0:
+			return anim.Delays[i]
+		default:
+			return 100 * time.Millisecond
+		}
+	}
+
+	shown := make(map[string]string)
+	next := time.Now()
+	behind := false
+	for loop := 0; loops <= 0 || loop < loops; loop++ {
+		for i, frame := range anim.Frames {
+			select {
+			case <-stop:
+				return stats, nil
+			default:
+			}
+
+			due := next
+			next = next.Add(frameDelay(i))
+			last := i == len(anim.Frames)-1 && loop == loops-1
+			if now := time.Now(); now.After(next) && !last {
+				if !behind {
+					fmt.Printf("[Animate] Server can't keep up: dropping frames from %d (%v behind)\n",
+						i, now.Sub(due).Round(time.Millisecond))
+				}
+				behind = true
+				stats.Dropped++
+				continue
+			}
+			behind = false
+			time.Sleep(time.Until(due))
+
+			changes := diffColors(shown, frame)
+			if len(changes) == 0 {
+				stats.Shown++
+				continue
+			}
+			msgs := make([]Message, 0, len(changes))
+			for name, hex := range changes {
+				msgs = append(msgs, Message{
+					"type":      "set_color",
+					"cube_name": name,
+					"hex":       hex,
+				})
+				shown[name] = hex
+			}
+			start := time.Now()
+			if err := conn.send(msgs); err != nil {
+				return stats, fmt.Errorf("[Animate] Frame %d: %v", i, err)
+			}
+			stats.MaxSend = max(stats.MaxSend, time.Since(start))
+			stats.Shown++
+			stats.Commands += len(msgs)
+		}
+	}
+
+	for name, hex := range shown {
+		s.updateCube(name, func(cube *Cube) { cube.Color = hex })
+	}
+	return stats, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var gifPalette = color.Palette{color.RGBA{}, color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0, 0, 0xff, 0xff}, color.RGBA{0, 0xff, 0, 0xff}}
+
+// gifFrame builds a frame covering r filled with palette index c.
+func gifFrame(r image.Rectangle, c uint8) *image.Paletted {
+	img := image.NewPaletted(r, gifPalette)
+	for i := range img.Pix {
+		img.Pix[i] = c
+	}
+	return img
+}
+
+// frameString renders a composited frame as rows of r, b, g or . for
+// transparent.
+func frameString(img image.Image) string {
+	var rows []string
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		var row strings.Builder
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			switch {
+			case a == 0:
+				row.WriteByte('.')
+			case r > 0:
+				row.WriteByte('r')
+			case g > 0:
+				row.WriteByte('g')
+			case bl > 0:
+				row.WriteByte('b')
+			}
+		}
+		rows = append(rows, row.String())
+	}
+	return strings.Join(rows, "/")
+}
+
+func TestDecodeGIFFrames(t *testing.T) {
+	// A red 2×2 frame, then one-pixel frames exercising each disposal.
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			gifFrame(image.Rect(0, 0, 2, 2), 1),
+			gifFrame(image.Rect(1, 1, 2, 2), 2),
+			gifFrame(image.Rect(0, 0, 1, 1), 3),
+			gifFrame(image.Rect(1, 0, 2, 1), 2),
+		},
+		Delay:    []int{10, 20, 0, 5},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone},
+		Config:   image.Config{ColorModel: gifPalette, Width: 2, Height: 2},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+
+	frames, delays, err := decodeGIFFrames(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, frame := range frames {
+		got = append(got, frameString(frame))
+	}
+	want := []string{
+		"rr/rr",
+		"rr/rb",
+		// The blue pixel was cleared to the background.
+		"gr/r.",
+		// The green pixel was undone.
+		"rb/r.",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("frames = %q, want %q", got, want)
+	}
+	wantDelays := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 0, 50 * time.Millisecond}
+	if !slices.Equal(delays, wantDelays) {
+		t.Errorf("delays = %v, want %v", delays, wantDelays)
+	}
+
+	if _, _, err := decodeGIFFrames(strings.NewReader("GIF89a")); err == nil {
+		t.Error("decodeGIFFrames accepted a truncated GIF")
+	}
+}
+
+func TestBuildAnimation(t *testing.T) {
+	frames := []image.Image{
+		testImage(image.Point{}, "r.", ".."),
+		testImage(image.Point{}, "b.", "g."),
+	}
+	anim, opts, err := buildAnimation(frames, []time.Duration{0, time.Second}, ImageWallOptions{MinAlpha: 0x80}, "black")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Width != 2 || opts.Height != 2 {
+		t.Errorf("wall is %d×%d, want 2×2", opts.Width, opts.Height)
+	}
+	// The right column is never visible, so it gets no cubes.
+	var names []string
+	for _, cube := range anim.Cubes {
+		names = append(names, cube.Name)
+		if cube.Color != "#000000" {
+			t.Errorf("cube %s spawns as %s, want the background", cube.Name, cube.Color)
+		}
+	}
+	if want := []string{"px_0_0", "px_0_1"}; !slices.Equal(names, want) {
+		t.Errorf("cubes = %v, want %v", names, want)
+	}
+	wantFrames := []map[string]string{
+		{"px_0_0_BASE": "#FF0000", "px_0_1_BASE": "#000000"},
+		{"px_0_0_BASE": "#0000FF", "px_0_1_BASE": "#00FF00"},
+	}
+	for i, frame := range anim.Frames {
+		if !maps.Equal(frame, wantFrames[i]) {
+			t.Errorf("frame %d = %v, want %v", i, frame, wantFrames[i])
+		}
+	}
+
+	if _, _, err := buildAnimation(nil, nil, ImageWallOptions{}, "black"); err == nil {
+		t.Error("buildAnimation accepted no frames")
+	}
+	if _, _, err := buildAnimation(frames, nil, ImageWallOptions{}, "mauve"); err == nil {
+		t.Error("buildAnimation accepted an unknown background")
+	}
+}
+
+func TestDiffColors(t *testing.T) {
+	shown := map[string]string{"a": "#FF0000", "b": "#00FF00"}
+	next := map[string]string{"a": "#FF0000", "b": "#0000FF", "c": "#000000"}
+	want := map[string]string{"b": "#0000FF", "c": "#000000"}
+	if got := diffColors(shown, next); !maps.Equal(got, want) {
+		t.Errorf("diffColors = %v, want %v", got, want)
+	}
+	if got := diffColors(next, next); len(got) != 0 {
+		t.Errorf("diffColors of identical frames = %v", got)
+	}
+}
@@ -0,0 +1,873 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// commands are the subcommands accepted as the first program argument.
+// Running without a subcommand plays the dog demo.
+var commands = map[string]func(args []string) error{
+	"recover":  runRecover,
+	"dogfile":  runDogfile,
+	"plan":     runPlan,
+	"apply":    runApply,
+	"watch":    runWatch,
+	"image":    runImage,
+	"animate":  runAnimate,
+	"vox":      runVox,
+	"mesh":     runMesh,
+	"urdf":     runURDF,
+	"export":   runExport,
+	"graph":    runGraph,
+	"joints":   runJoints,
+	"activate": runActivate,
+	"pose":     runPose,
+	"timeline": runTimeline,
+	"tune":     runTune,
+}
+
+// runCommand dispatches a subcommand and exits non-zero if it fails.
+func runCommand(name string, args []string) {
+	cmd, ok := commands[name]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for n := range commands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		fmt.Printf("Unknown command %q. Available commands: %v\n", name, names)
+		os.Exit(2)
+	}
+	if err := cmd(args); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// serverFlags registers the connection flags shared by the subcommands that
+// talk to a server.
+func serverFlags(fs *flag.FlagSet) (addr, password *string) {
+	addr = fs.String("addr", serverAddr, "server address")
+	password = fs.String("password", authPass, "server password")
+	return addr, password
+}
+
+// runRecover despawns cubes left behind by runs that crashed before cleaning
+// up after themselves.
+func runRecover(args []string) error {
+	fs := flag.NewFlagSet("recover", flag.ExitOnError)
+	dir := fs.String("dir", defaultManifestDir, "directory holding session manifests")
+	password := fs.String("password", authPass, "server password")
+	force := fs.Bool("force", false, "also recover manifests whose process still appears to be running")
+	fs.Parse(args)
+
+	return recoverOrphans(*dir, *password, *force)
+}
+
+// runDogfile writes the dog as a creature definition to start editing from.
+func runDogfile(args []string) error {
+	fs := flag.NewFlagSet("dogfile", flag.ExitOnError)
+	name := fs.String("name", "dog", "instance prefix for the dog's cubes")
+	out := fs.String("o", "dog.json", "output file")
+	fs.Parse(args)
+
+	return saveCreature(*out, dogCreature(*name, []float64{40, -20, -3}))
+}
+
+// runPlan shows what apply would change for a creature file.
+func runPlan(args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	addr, password := serverFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: plan [flags] creature.json")
+	}
+
+	plan, err := newSession(*addr, *password).reconcileFile(fs.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	fmt.Print(plan)
+	return nil
+}
+
+// runApply shows the plan for a creature file and, once confirmed, runs it.
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	addr, password := serverFlags(fs)
+	yes := fs.Bool("yes", false, "apply without asking for confirmation")
+	verify := fs.Bool("verify", false, "read joint params back after setting them and fail on mismatches")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: apply [flags] creature.json")
+	}
+	path := fs.Arg(0)
+
+	session := newSession(*addr, *password)
+	session.VerifyParams = *verify
+	plan, desired, err := session.planFile(path)
+	if err != nil {
+		return err
+	}
+	fmt.Print(plan)
+	if plan.Empty() {
+		return nil
+	}
+	if !*yes && !confirm("Apply these changes?") {
+		fmt.Println("Apply cancelled.")
+		return nil
+	}
+
+	// Apply exactly the plan that was shown: edits made to the file while
+	// the prompt waited are left for the next plan. Cubes applied here are
+	// meant to outlive the process, so no manifest.
+	if err := session.applyFile(path, plan, desired); err != nil {
+		return err
+	}
+	fmt.Println("Apply complete.")
+	return nil
+}
+
+// runWatch hot-reloads a creature file into the running world.
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	addr, password := serverFlags(fs)
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often to check the file for changes")
+	cleanup := fs.Bool("cleanup", false, "despawn everything spawned by this watch on exit")
+	breaks := fs.Bool("breaks", false, "report joints the server says broke; the next edit recreates them")
+	verify := fs.Bool("verify", false, "read joint params back after setting them and report mismatches")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: watch [flags] creature.json")
+	}
+
+	session := newSession(*addr, *password)
+	session.VerifyParams = *verify
+	if *cleanup {
+		if err := session.enableManifest(defaultManifestDir); err != nil {
+			return err
+		}
+		session.cleanupOnExit()
+		defer session.closeOnPanic()
+	}
+
+	if *breaks {
+		go func() {
+			err := session.watchJointBreaks(nil, func(b JointBreak) {
+				fmt.Printf("💥 Joint %s broke (force %g N, torque %g N·m)\n", b.JointName, b.Force, b.Torque)
+			})
+			if err != nil {
+				fmt.Println(err)
+			}
+		}()
+	}
+
+	fmt.Printf("[Watch] Watching %s, press Ctrl-C to stop.\n", fs.Arg(0))
+	return session.watchCreature(fs.Arg(0), *interval, nil)
+}
+
+// runImage spawns an image as a wall of frozen, colored cubes.
+func runImage(args []string) error {
+	fs := flag.NewFlagSet("image", flag.ExitOnError)
+	addr, password := serverFlags(fs)
+	opts := imageWallFlags(fs)
+	hold := fs.Bool("hold", false, "keep the wall until Ctrl-C, then despawn it")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: image [flags] picture.png")
+	}
+	origin, err := opts.origin()
+	if err != nil {
+		return err
+	}
+	opts.ImageWallOptions.Origin = origin
+
+	session := newSession(*addr, *password)
+	if *hold {
+		if err := session.enableManifest(defaultManifestDir); err != nil {
+			return err
+		}
+		session.cleanupOnExit()
+	}
+	if _, err := session.spawnImageWall(fs.Arg(0), opts.ImageWallOptions); err != nil {
+		return err
+	}
+	if *hold {
+		fmt.Println("[Image] Holding the wall, press Ctrl-C to despawn it.")
+		select {}
+	}
+	return nil
+}
+
+// runAnimate plays an animated GIF or a directory of frames on a cube wall.
+func runAnimate(args []string) error {
+	fs := flag.NewFlagSet("animate", flag.ExitOnError)
+	addr, password := serverFlags(fs)
+	opts := imageWallFlags(fs)
+	fps := fs.Float64("fps", 0, "frames per second (0 uses the GIF's own delays, or 10 for frame folders)")
+	loops := fs.Int("loops", 1, "times to play the animation (0 loops until Ctrl-C)")
+	background := fs.String("bg", "black", "color for cells that are transparent in a frame")
+	spawn := fs.Bool("spawn", true, "spawn the wall first; disable to reuse one from a previous run")
+	keep := fs.Bool("keep", false, "leave the wall in the world when playback ends")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: animate [flags] animation.gif|frames/")
+	}
+	origin, err := opts.origin()
+	if err != nil {
+		return err
+	}
+	opts.ImageWallOptions.Origin = origin
+
+	frames, delays, err := loadFrames(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	anim, layout, err := buildAnimation(frames, delays, opts.ImageWallOptions, *background)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[Animate] %s: %d frames on a %dx%d wall of %d cubes\n",
+		fs.Arg(0), len(anim.Frames), layout.Width, layout.Height, len(anim.Cubes))
+
+	session := newSession(*addr, *password)
+	if *spawn {
+		if !*keep {
+			if err := session.enableManifest(defaultManifestDir); err != nil {
+				return err
+			}
+			session.cleanupOnExit()
+			defer session.close()
+		}
+		if err := session.spawnCubes(anim.Cubes); err != nil {
+			return err
+		}
+		if err := session.freezeCubes(session.CubeNames(), true); err != nil {
+			return err
+		}
+	}
+
+	stats, err := session.playAnimation(anim, *fps, *loops, nil)
+	fmt.Println("[Animate]", stats)
+	return err
+}
+
+// runVox imports a MagicaVoxel model, either spawning it or writing it out as
+// a creature definition.
+func runVox(args []string) error {
+	fs := flag.NewFlagSet("vox", flag.ExitOnError)
+	addr, password := serverFlags(fs)
+	opts := voxelFlags(fs)
+	joints := fs.Bool("joints", false, "join each connected group of voxels with a spanning tree of joints")
+	jointType := fs.String("joint-type", "fixed", "joint type used by -joints")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: vox [flags] model.vox")
+	}
+	if err := opts.parse(fs.Arg(0)); err != nil {
+		return err
+	}
+	if *joints {
+		opts.JointType = JointKind(*jointType)
+	}
+
+	vox, err := loadVox(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	creature := voxCreature(vox, opts.VoxelOptions)
+	fmt.Printf("[Vox] %s: %d models, %d cubes, %d joints, %d colors\n",
+		fs.Arg(0), len(vox.Models), len(creature.Cubes), len(creature.Joints), len(creature.Palette))
+	return opts.output(creature, *addr, *password)
+}
+
+// runMesh voxelizes an OBJ or STL mesh, either spawning it or writing it out
+// as a creature definition.
+func runMesh(args []string) error {
+	fs := flag.NewFlagSet("mesh", flag.ExitOnError)
+	addr, password := serverFlags(fs)
+	opts := voxelFlags(fs)
+	resolution := fs.Int("res", 16, "cubes along the mesh's longest side")
+	solid := fs.Bool("solid", false, "fill the inside of closed meshes instead of only the surface")
+	zUp := fs.Bool("zup", false, "the mesh is Z-up (typical for STL from CAD tools)")
+	color := fs.String("color", "gray", "palette name or hex color for the cubes")
+	rigid := fs.Bool("rigid", false, "join the cubes with fixed joints so the object moves as one body")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: mesh [flags] model.obj|model.stl")
+	}
+	if err := opts.parse(fs.Arg(0)); err != nil {
+		return err
+	}
+	if *rigid {
+		opts.JointType = JointFixed
+	}
+
+	mesh, err := loadMesh(fs.Arg(0), *zUp)
+	if err != nil {
+		return err
+	}
+	creature := meshCreature(mesh, MeshOptions{
+		VoxelOptions: opts.VoxelOptions,
+		Resolution:   *resolution,
+		Solid:        *solid,
+		Color:        *color,
+	})
+	fmt.Printf("[Mesh] %s: %d triangles, %d cubes, %d joints\n",
+		fs.Arg(0), len(mesh.Triangles), len(creature.Cubes), len(creature.Joints))
+	return opts.output(creature, *addr, *password)
+}
+
+// runURDF imports a URDF robot description, either spawning it or writing it
+// out as a creature definition.
+func runURDF(args []string) error {
+	fs := flag.NewFlagSet("urdf", flag.ExitOnError)
+	addr, password := serverFlags(fs)
+	name := fs.String("name", "", "creature name and cube prefix (default: the robot's name)")
+	offsetText := fs.String("offset", "0,0,0", "world position of the root link as x,y,z")
+	scale := fs.Float64("scale", 1, "world units per meter")
+	out := fs.String("o", "", "write a creature file instead of spawning")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: urdf [flags] robot.urdf")
+	}
+	offset, err := parseVec3(*offsetText)
+	if err != nil {
+		return err
+	}
+
+	creature, warnings, err := loadURDF(fs.Arg(0), URDFOptions{Name: *name, Offset: offset, Scale: *scale})
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		fmt.Println("[URDF] Warning:", w)
+	}
+	fmt.Printf("[URDF] %s: %d cubes, %d joints\n", fs.Arg(0), len(creature.Cubes), len(creature.Joints))
+	return saveOrSpawn(creature, *out, *addr, *password)
+}
+
+// runExport writes a creature definition, or a snapshot of the live world,
+// to a .gltf or .glb file for review in any 3D viewer.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	source := sceneFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 || !source.set() {
+		return fmt.Errorf("usage: export [-creature creature.json] [-live] out.glb|out.gltf")
+	}
+
+	scene, err := source.load()
+	if err != nil {
+		return err
+	}
+	if err := writeGLTF(fs.Arg(0), scene); err != nil {
+		return err
+	}
+	fmt.Printf("[Export] Wrote %d cubes and %d joints to %s\n", len(scene.Cubes), len(scene.Joints), fs.Arg(0))
+	return nil
+}
+
+// runGraph draws the cube/joint graph of a creature definition or the live
+// world as Graphviz DOT or Mermaid.
+func runGraph(args []string) error {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	source := sceneFlags(fs)
+	format := fs.String("format", "", "dot or mermaid (default: from the -o extension, else dot)")
+	out := fs.String("o", "", "output file (default: stdout)")
+	fs.Parse(args)
+	if fs.NArg() != 0 || !source.set() {
+		return fmt.Errorf("usage: graph [-creature creature.json] [-live] [-format dot|mermaid] [-o out]")
+	}
+	if *format == "" {
+		*format = "dot"
+		if ext := strings.ToLower(filepath.Ext(*out)); ext == ".mmd" || ext == ".md" {
+			*format = "mermaid"
+		}
+	}
+
+	scene, err := source.load()
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return writeGraph(os.Stdout, scene, *format)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("[Graph] %v", err)
+	}
+	defer f.Close()
+	return writeGraph(f, scene, *format)
+}
+
+// sceneFlagSet binds the choice of what to export: a creature definition, a
+// snapshot of the live world, or a live snapshot of a creature's cubes.
+type sceneFlagSet struct {
+	addr, password *string
+	creaturePath   *string
+	live           *bool
+}
+
+func sceneFlags(fs *flag.FlagSet) *sceneFlagSet {
+	f := &sceneFlagSet{}
+	f.addr, f.password = serverFlags(fs)
+	f.creaturePath = fs.String("creature", "", "creature file to export (colors and groups also feed -live)")
+	f.live = fs.Bool("live", false, "snapshot positions, rotations and joints from the server")
+	return f
+}
+
+func (f *sceneFlagSet) set() bool {
+	return *f.creaturePath != "" || *f.live
+}
+
+// load builds the scene the flags describe.
+func (f *sceneFlagSet) load() (Scene, error) {
+	var scene Scene
+	if *f.creaturePath != "" {
+		creature, err := loadCreature(*f.creaturePath)
+		if err != nil {
+			return Scene{}, err
+		}
+		scene = creature.scene()
+	}
+	if *f.live {
+		return newSession(*f.addr, *f.password).liveScene(scene, *f.creaturePath != "")
+	}
+	return scene, nil
+}
+
+// voxelFlagSet binds VoxelOptions and the output choice shared by the
+// importers to command-line flags.
+type voxelFlagSet struct {
+	VoxelOptions
+	offsetText *string
+	out        *string
+}
+
+func voxelFlags(fs *flag.FlagSet) *voxelFlagSet {
+	f := &voxelFlagSet{}
+	fs.StringVar(&f.Name, "name", "", "creature name and cube prefix (default: the file name)")
+	fs.Float64Var(&f.Spacing, "spacing", 1, "distance between cube centers")
+	f.offsetText = fs.String("offset", "0,0,0", "world position of the model's bottom center as x,y,z")
+	f.out = fs.String("o", "", "write a creature file instead of spawning")
+	return f
+}
+
+// parse applies -offset and defaults the name to the input file's base name.
+func (f *voxelFlagSet) parse(path string) error {
+	offset, err := parseVec3(*f.offsetText)
+	if err != nil {
+		return err
+	}
+	f.Offset = offset
+	if f.Name == "" {
+		f.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return nil
+}
+
+// output writes the creature to -o, or spawns it when no file was given.
+func (f *voxelFlagSet) output(creature *Creature, addr, password string) error {
+	return saveOrSpawn(creature, *f.out, addr, password)
+}
+
+// saveOrSpawn writes an imported creature to out, or spawns it if out is
+// empty.
+func saveOrSpawn(creature *Creature, out, addr, password string) error {
+	if out != "" {
+		return saveCreature(out, creature)
+	}
+	plan, err := newSession(addr, password).spawnCreature(creature)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Applied %d changes.\n", len(plan.Actions))
+	return nil
+}
+
+// imageWallFlagSet binds ImageWallOptions to command-line flags.
+type imageWallFlagSet struct {
+	ImageWallOptions
+	originText *string
+	minAlpha   *uint
+}
+
+func imageWallFlags(fs *flag.FlagSet) *imageWallFlagSet {
+	f := &imageWallFlagSet{}
+	fs.IntVar(&f.Width, "w", 0, "grid width in cubes (0 keeps the aspect ratio)")
+	fs.IntVar(&f.Height, "h", 0, "grid height in cubes (0 keeps the aspect ratio)")
+	fs.StringVar(&f.Plane, "plane", "xy", "plane to lay the image on: xy, xz or zy")
+	fs.Float64Var(&f.Spacing, "spacing", 1, "distance between cube centers")
+	fs.StringVar(&f.Prefix, "prefix", "px", "cube name prefix")
+	f.originText = fs.String("origin", "0,100,0", "world position of the top-left pixel as x,y,z")
+	f.minAlpha = fs.Uint("alpha", 128, "skip cells with alpha below this (0-255)")
+	return f
+}
+
+// origin parses the -origin flag and applies -alpha.
+func (f *imageWallFlagSet) origin() ([]float64, error) {
+	f.MinAlpha = uint8(min(*f.minAlpha, 255))
+	return parseVec3(*f.originText)
+}
+
+// parseVec3 parses "x,y,z".
+func parseVec3(text string) ([]float64, error) {
+	parts := strings.Split(text, ",")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("want x,y,z, got %q", text)
+	}
+	vec := make([]float64, 3)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinate %q in %q", part, text)
+		}
+		vec[i] = v
+	}
+	return vec, nil
+}
+
+// confirm asks a yes/no question on stdin.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// runJoints prints every joint param of a creature as the server reports it,
+// and fails if any differ from the definition.
+func runJoints(args []string) error {
+	fs := flag.NewFlagSet("joints", flag.ExitOnError)
+	addr, password := serverFlags(fs)
+	asJSON := fs.Bool("json", false, "print the params as JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: joints [flags] creature.json")
+	}
+
+	creature, err := loadCreature(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	reports, err := newSession(*addr, *password).dumpJointParams(creature)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else if err := writeJointParamsReport(os.Stdout, reports); err != nil {
+		return err
+	}
+
+	drift := 0
+	for _, r := range reports {
+		drift += len(r.Mismatches)
+		if r.Error != "" {
+			drift++
+		}
+	}
+	if drift > 0 {
+		return fmt.Errorf("[joints] %d params differ from %s or could not be read", drift, fs.Arg(0))
+	}
+	return nil
+}
+
+// runActivate unfreezes an applied creature in stages, ramping joint params
+// as it goes and refreezing it if anything starts to fly.
+func runActivate(args []string) error {
+	fs := flag.NewFlagSet("activate", flag.ExitOnError)
+	addr, password := serverFlags(fs)
+	roots := fs.String("roots", "", "comma-separated cubes to start from; defaults to each body's most jointed cube")
+	delay := fs.Duration("stage-delay", 200*time.Millisecond, "time each stage gets to settle")
+	ramps := fs.String("ramps", "", "comma-separated joint param ramps as param=from:to, e.g. motor_max_impulse=100:1000")
+	maxSpeed := fs.Float64("max-speed", 20, "abort when a cube moves faster than this, in m/s")
+	maxSpin := fs.Float64("max-spin", 30, "abort when a cube spins faster than this, in rad/s")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: activate [flags] creature.json")
+	}
+
+	creature, err := loadCreature(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	opts := ActivationOptions{StageDelay: *delay, MaxLinearSpeed: *maxSpeed, MaxAngularSpeed: *maxSpin}
+	inst := creature.instance()
+	for _, root := range strings.Split(*roots, ",") {
+		if root = strings.TrimSpace(root); root != "" {
+			if _, ok := creature.cube(root); !ok {
+				return fmt.Errorf("[Activate] %s has no cube %q", fs.Arg(0), root)
+			}
+			opts.Roots = append(opts.Roots, inst.Resolve(root))
+		}
+	}
+	for _, text := range strings.Split(*ramps, ",") {
+		if text = strings.TrimSpace(text); text != "" {
+			ramp, err := parseParamRamp(text)
+			if err != nil {
+				return err
+			}
+			opts.Ramps = append(opts.Ramps, ramp)
+		}
+	}
+	return newSession(*addr, *password).activate(creature.scene(), opts)
+}
+
+// runPose moves an applied creature through one or more named poses, or
+// lists the library's poses when none are given.
+func runPose(args []string) error {
+	fs := flag.NewFlagSet("pose", flag.ExitOnError)
+	addr, password := serverFlags(fs)
+	posesPath := fs.String("poses", "", "pose library JSON file (required)")
+	duration := fs.Duration("duration", time.Second, "time each transition takes")
+	easing := fs.String("ease", "in-out", "easing: linear, in, out or in-out")
+	maxVelocity := fs.Float64("max-velocity", 6, "fastest motor velocity to command, in rad/s")
+	hz := fs.Float64("hz", 20, "control loop rate")
+	fs.Parse(args)
+	if *posesPath == "" || fs.NArg() < 1 || *hz <= 0 {
+		return fmt.Errorf("usage: pose -poses poses.json [flags] creature.json [pose...]")
+	}
+
+	lib, err := loadPoseLibrary(*posesPath)
+	if err != nil {
+		return err
+	}
+	creature, err := loadCreature(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	ease, err := easingByName(*easing)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 1 {
+		for _, name := range lib.names() {
+			fmt.Printf("%s\t%d joints\n", name, len(lib.Poses[name]))
+		}
+		return nil
+	}
+
+	// Resolve every pose before moving, so a typo in the last one does not
+	// leave the creature halfway through the sequence.
+	poses := make([]Pose, 0, fs.NArg()-1)
+	for _, name := range fs.Args()[1:] {
+		pose, warnings, err := lib.resolve(name, creature)
+		if err != nil {
+			return err
+		}
+		for _, w := range warnings {
+			fmt.Println("[Pose] ⚠️", w)
+		}
+		poses = append(poses, pose)
+	}
+	pc := newPoseController(newSession(*addr, *password))
+	pc.MaxVelocity = *maxVelocity
+	pc.Tick = time.Duration(float64(time.Second) / *hz)
+	for i, pose := range poses {
+		fmt.Printf("[Pose] %s (%d joints, %v)\n", fs.Arg(i+1), len(pose), *duration)
+		if err := pc.Transition(pose, *duration, ease); err != nil {
+			return err
+		}
+		fmt.Println("[Pose]", pc.Stats)
+	}
+	return nil
+}
+
+// runTimeline plays keyframe timelines on an applied creature until they end
+// or, for looping ones, until Ctrl-C; the joints are left holding still.
+// With -sim it plays them against simulated joints on a simulated clock,
+// instantly and without a server, and prints where the joints end up.
+func runTimeline(args []string) error {
+	fs := flag.NewFlagSet("timeline", flag.ExitOnError)
+	addr, password := serverFlags(fs)
+	speed := fs.Float64("speed", 1, "playback speed, on top of each timeline's own")
+	loop := fs.Bool("loop", false, "loop every timeline, even those that do not loop themselves")
+	maxVelocity := fs.Float64("max-velocity", 6, "fastest motor velocity an angle track may command, in rad/s")
+	hz := fs.Float64("hz", 20, "control loop rate")
+	limit := fs.Duration("for", 0, "stop after this long; needed with -sim for looping timelines")
+	sim := fs.Bool("sim", false, "play against simulated joints instead of the server")
+	fs.Parse(args)
+	if fs.NArg() < 2 || *speed <= 0 || *hz <= 0 {
+		return fmt.Errorf("usage: timeline [flags] creature.json timeline.json...")
+	}
+
+	creature, err := loadCreature(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	session := newSession(*addr, *password)
+	player := newTimelinePlayer(session)
+	player.Speed = *speed
+	player.MaxVelocity = *maxVelocity
+	looping := false
+	for _, path := range fs.Args()[1:] {
+		tl, err := loadTimeline(path)
+		if err != nil {
+			return err
+		}
+		for _, track := range tl.joints() {
+			if _, ok := creature.joint(track); !ok {
+				return fmt.Errorf("[Timeline] %s: %s has no joint %q", path, fs.Arg(0), track)
+			}
+		}
+		if *loop && !tl.Loop {
+			tl.Loop = true
+			if err := tl.validate(); err != nil {
+				return fmt.Errorf("[Timeline] %s: %v", path, err)
+			}
+		}
+		looping = looping || tl.Loop
+		if err := player.Add(tl, creature.instance()); err != nil {
+			return err
+		}
+	}
+
+	period := time.Duration(float64(time.Second) / *hz)
+	var control *ControlLoop
+	var joints *simJoints
+	if *sim {
+		if looping && *limit <= 0 {
+			return fmt.Errorf("[Timeline] A looping timeline never ends on its own; give -sim a -for duration")
+		}
+		clock := newSimClock()
+		joints = newSimJoints(clock)
+		control = newControlLoop(joints, period)
+		control.Clock = clock
+	} else {
+		m, err := session.openMotorConn()
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+		control = newControlLoop(m, period)
+	}
+	control.Limit = *limit
+	control.Register(player)
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+	fmt.Printf("[Timeline] Playing %d timelines at %g Hz, press Ctrl-C to stop.\n", fs.NArg()-1, *hz)
+	err = control.Run(stop)
+	fmt.Println("[Timeline]", control.Stats)
+	if joints != nil {
+		names := make([]string, 0, len(joints.angle))
+		for joint := range joints.angle {
+			names = append(names, joint)
+		}
+		sort.Strings(names)
+		for _, joint := range names {
+			fmt.Printf("  %s\t%.3f rad\n", joint, joints.angle[joint])
+		}
+	}
+	return err
+}
+
+// runTune steps one joint of an applied creature to a target angle with each
+// combination of the given PID gains and compares how it responds. With
+// -sim the trials run against simulated joints instead, instantly.
+func runTune(args []string) error {
+	fs := flag.NewFlagSet("tune", flag.ExitOnError)
+	addr, password := serverFlags(fs)
+	target := fs.Float64("target", 0.5, "angle to step to, in rad")
+	kps := fs.String("kp", "1,2,4,8", "comma-separated proportional gains to try")
+	kis := fs.String("ki", "0", "comma-separated integral gains to try")
+	kds := fs.String("kd", "0", "comma-separated derivative gains to try")
+	trial := fs.Duration("for", 2*time.Second, "how long each trial runs")
+	tolerance := fs.Float64("tolerance", 0.01, "how close counts as there, in rad")
+	hz := fs.Float64("hz", 20, "control loop rate")
+	sim := fs.Bool("sim", false, "tune against simulated joints instead of the server")
+	fs.Parse(args)
+	if fs.NArg() != 2 || *hz <= 0 {
+		return fmt.Errorf("usage: tune [flags] creature.json joint")
+	}
+
+	creature, err := loadCreature(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	joint, ok := creature.joint(fs.Arg(1))
+	if !ok {
+		return fmt.Errorf("[Tune] %s has no joint %q", fs.Arg(0), fs.Arg(1))
+	}
+	if joint.Type != JointHinge {
+		return fmt.Errorf("[Tune] Joint %q is a %s; only hinges report an angle", joint.Name, joint.Type)
+	}
+	var gains [3][]float64
+	for i, list := range []string{*kps, *kis, *kds} {
+		for _, text := range strings.Split(list, ",") {
+			v, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+			if err != nil {
+				return fmt.Errorf("[Tune] Bad gain %q", text)
+			}
+			gains[i] = append(gains[i], v)
+		}
+	}
+	var candidates []PIDGains
+	for _, kp := range gains[0] {
+		for _, ki := range gains[1] {
+			for _, kd := range gains[2] {
+				candidates = append(candidates, PIDGains{Kp: kp, Ki: ki, Kd: kd})
+			}
+		}
+	}
+
+	period := time.Duration(float64(time.Second) / *hz)
+	var run func(...Controller) error
+	if *sim {
+		clock := newSimClock()
+		joints := newSimJoints(clock)
+		run = func(controllers ...Controller) error {
+			loop := newControlLoop(joints, period)
+			loop.Clock = clock
+			for _, c := range controllers {
+				loop.Register(c)
+			}
+			return loop.Run(nil)
+		}
+	} else {
+		session := newSession(*addr, *password)
+		run = func(controllers ...Controller) error {
+			_, err := session.runControllers(period, nil, controllers...)
+			return err
+		}
+	}
+
+	fmt.Printf("[Tune] %s: %d trials of %v stepping to %g rad\n", joint.Name, len(candidates), *trial, *target)
+	responses, err := tunePID(run, creature.instance().Name(joint.Name), *target, candidates, *trial, *tolerance)
+	if len(responses) > 0 {
+		if err := writeStepResponses(os.Stdout, responses); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	best := bestStep(responses, *tolerance)
+	if best == nil {
+		return fmt.Errorf("[Tune] No gains settled within %g rad in %v", *tolerance, *trial)
+	}
+	fmt.Printf("[Tune] Best: %s, settled in %v\n", best.Gains, best.Settled.Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Controller is anything a ControlLoop drives, once per tick.
+type Controller interface {
+	// Joints lists the joints whose angles the controller wants in the
+	// next tick's readings.
+	Joints() []string
+	// Update reads the tick and adds the controller's joint commands. It
+	// returns true once it is done; it is not called again after that.
+	Update(t Tick, cmds JointCommands) bool
+}
+
+// Tick is what a controller sees each time the loop runs it.
+type Tick struct {
+	N       int
+	Elapsed time.Duration // since the loop started
+	// Dt is how long this tick is expected to last: the loop period, or
+	// as long as the last tick really took when the loop is running late.
+	Dt     time.Duration
+	Angles map[string]float64 // rad, for every joint a controller asked for
+}
+
+// JointCommands collects the params every controller sets in one tick, per
+// joint. When two controllers set the same param the later one wins.
+type JointCommands map[string]map[string]float64
+
+func (c JointCommands) set(joint, param string, value float64) {
+	if c[joint] == nil {
+		c[joint] = make(map[string]float64)
+	}
+	c[joint][param] = value
+}
+
+// jointIO is what a control loop reads angles from and sends commands to:
+// a motorConn, or simJoints when nothing real should move.
+type jointIO interface {
+	angles(joints []string) (map[string]float64, error)
+	setParams(params map[string]map[string]float64) error
+}
+
+// Clock is the time a control loop runs on.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SimClock is a clock that only moves when the loop waits on it, and then
+// jumps straight to the end of the wait: a simulated run takes no real time
+// and always ticks exactly on schedule.
+type SimClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newSimClock() *SimClock {
+	return &SimClock{now: time.Unix(0, 0)}
+}
+
+func (c *SimClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *SimClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// LoopStats summarizes how well a control loop kept its rate.
+type LoopStats struct {
+	Ticks        int
+	Overruns     int           // ticks whose work ran past the next tick's start
+	Skipped      int           // ticks dropped to catch up after overruns
+	Commands     int           // joint commands sent
+	MaxLatency   time.Duration // slowest read-update-send round
+	TotalLatency time.Duration
+}
+
+func (st LoopStats) String() string {
+	var mean time.Duration
+	if st.Ticks > 0 {
+		mean = st.TotalLatency / time.Duration(st.Ticks)
+	}
+	return fmt.Sprintf("%d ticks, %d overruns, %d skipped, %d joint commands, latency mean %v max %v",
+		st.Ticks, st.Overruns, st.Skipped, st.Commands, mean.Round(time.Microsecond), st.MaxLatency.Round(time.Microsecond))
+}
+
+// ControlLoop runs controllers at a fixed rate. Each tick it reads the
+// angles they need in one round trip, lets every controller update, and
+// sends all of their commands in one batch. A tick that runs long does not
+// push the schedule back: ticks it overlapped are skipped and counted.
+type ControlLoop struct {
+	Period time.Duration
+	Clock  Clock
+	// Limit stops the loop, as if stop were closed, once it has run this
+	// long; zero runs until the controllers are done.
+	Limit time.Duration
+	Stats LoopStats
+
+	io          jointIO
+	controllers []Controller
+}
+
+func newControlLoop(io jointIO, period time.Duration) *ControlLoop {
+	if period <= 0 {
+		period = 50 * time.Millisecond
+	}
+	return &ControlLoop{Period: period, Clock: realClock{}, io: io}
+}
+
+// Register adds a controller, to be run from the next tick on.
+func (l *ControlLoop) Register(c Controller) {
+	l.controllers = append(l.controllers, c)
+}
+
+// Run ticks until every controller is done, stop is closed or the limit is
+// reached. When stopped it sets every motor it drove to zero velocity, so
+// nothing is left spinning mid-motion.
+func (l *ControlLoop) Run(stop <-chan struct{}) error {
+	active := append([]Controller(nil), l.controllers...)
+	driven := make(map[string]bool)
+	start := l.Clock.Now()
+	next, prev := start, start
+	for n := 0; len(active) > 0; n++ {
+		now := l.Clock.Now()
+		dt := max(l.Period, now.Sub(prev))
+		prev = now
+
+		var joints []string
+		seen := make(map[string]bool)
+		for _, c := range active {
+			for _, joint := range c.Joints() {
+				if !seen[joint] {
+					seen[joint] = true
+					joints = append(joints, joint)
+				}
+			}
+		}
+		sort.Strings(joints)
+		tick := Tick{N: n, Elapsed: now.Sub(start), Dt: dt}
+		if len(joints) > 0 {
+			angles, err := l.io.angles(joints)
+			if err != nil {
+				return err
+			}
+			tick.Angles = angles
+		}
+
+		cmds := make(JointCommands)
+		running := active[:0]
+		for _, c := range active {
+			if !c.Update(tick, cmds) {
+				running = append(running, c)
+			}
+		}
+		active = running
+		if len(cmds) > 0 {
+			if err := l.io.setParams(cmds); err != nil {
+				return err
+			}
+			for joint, params := range cmds {
+				if _, ok := params["motor_target_velocity"]; ok {
+					driven[joint] = true
+				}
+			}
+		}
+
+		latency := l.Clock.Now().Sub(now)
+		l.Stats.Ticks++
+		l.Stats.Commands += len(cmds)
+		l.Stats.TotalLatency += latency
+		l.Stats.MaxLatency = max(l.Stats.MaxLatency, latency)
+
+		next = next.Add(l.Period)
+		if late := l.Clock.Now().Sub(next); late >= 0 {
+			l.Stats.Overruns++
+			skip := int(late/l.Period) + 1
+			l.Stats.Skipped += skip - 1
+			next = next.Add(time.Duration(skip) * l.Period)
+		}
+		if len(active) == 0 {
+			break
+		}
+		if l.Limit > 0 && next.Sub(start) >= l.Limit {
+			return l.stopMotors(driven)
+		}
+		// A SimClock's wait is ready at once, so check stop on its own
+		// first or the select could keep picking the tick.
+		select {
+		case <-stop:
+			return l.stopMotors(driven)
+		default:
+		}
+		select {
+		case <-stop:
+			return l.stopMotors(driven)
+		case <-l.Clock.After(next.Sub(l.Clock.Now())):
+		}
+	}
+	return nil
+}
+
+// stopMotors sets the joints' motors to zero velocity.
+func (l *ControlLoop) stopMotors(joints map[string]bool) error {
+	if len(joints) == 0 {
+		return nil
+	}
+	still := make(map[string]map[string]float64, len(joints))
+	for joint := range joints {
+		still[joint] = map[string]float64{"motor_target_velocity": 0}
+	}
+	return l.io.setParams(still)
+}
+
+// runControllers runs controllers on a control loop over a fresh motor
+// connection and returns how the loop kept up.
+func (s *Session) runControllers(period time.Duration, stop <-chan struct{}, controllers ...Controller) (LoopStats, error) {
+	m, err := s.openMotorConn()
+	if err != nil {
+		return LoopStats{}, err
+	}
+	defer m.Close()
+	loop := newControlLoop(m, period)
+	for _, c := range controllers {
+		loop.Register(c)
+	}
+	err = loop.Run(stop)
+	return loop.Stats, err
+}
+
+// simJoints stands in for the server's joints: each motor turns its joint at
+// exactly the commanded velocity, on the loop's clock. It lets controllers
+// run without a server, and instantly on a SimClock.
+type simJoints struct {
+	clock  Clock
+	angle  map[string]float64
+	params map[string]map[string]float64
+	at     time.Time
+}
+
+func newSimJoints(clock Clock) *simJoints {
+	return &simJoints{
+		clock:  clock,
+		angle:  make(map[string]float64),
+		params: make(map[string]map[string]float64),
+		at:     clock.Now(),
+	}
+}
+
+// advance turns every enabled motor for the time since the last call.
+func (sj *simJoints) advance() {
+	now := sj.clock.Now()
+	dt := now.Sub(sj.at).Seconds()
+	sj.at = now
+	for joint, params := range sj.params {
+		if params["motor_enable"] != 0 {
+			sj.angle[joint] += params["motor_target_velocity"] * dt
+		}
+	}
+}
+
+func (sj *simJoints) angles(joints []string) (map[string]float64, error) {
+	sj.advance()
+	angles := make(map[string]float64, len(joints))
+	for _, joint := range joints {
+		angles[joint] = sj.angle[joint]
+	}
+	return angles, nil
+}
+
+func (sj *simJoints) setParams(params map[string]map[string]float64) error {
+	sj.advance()
+	for joint, p := range params {
+		if sj.params[joint] == nil {
+			sj.params[joint] = make(map[string]float64)
+		}
+		for name, value := range p {
+			sj.params[joint][name] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// laggyJoints is simJoints whose angle reads take latency on the loop's
+// SimClock, and which records every batch of params it is sent.
+type laggyJoints struct {
+	*simJoints
+	clock   *SimClock
+	latency time.Duration
+	sent    []map[string]map[string]float64
+}
+
+func newLaggyJoints(clock *SimClock, latency time.Duration) *laggyJoints {
+	return &laggyJoints{simJoints: newSimJoints(clock), clock: clock, latency: latency}
+}
+
+func (lj *laggyJoints) angles(joints []string) (map[string]float64, error) {
+	if lj.latency > 0 {
+		<-lj.clock.After(lj.latency)
+	}
+	return lj.simJoints.angles(joints)
+}
+
+func (lj *laggyJoints) setParams(params map[string]map[string]float64) error {
+	lj.sent = append(lj.sent, params)
+	return lj.simJoints.setParams(params)
+}
+
+// tickRecorder drives its joints at 1 rad/s and records every tick. It is
+// done after doneAfter ticks, or never when that is zero, and closes stop on
+// tick stopAt when stop is set.
+type tickRecorder struct {
+	joints    []string
+	doneAfter int
+	stop      chan struct{}
+	stopAt    int
+	ticks     []Tick
+}
+
+func (r *tickRecorder) Joints() []string { return r.joints }
+
+func (r *tickRecorder) Update(t Tick, cmds JointCommands) bool {
+	r.ticks = append(r.ticks, t)
+	for _, joint := range r.joints {
+		cmds.set(joint, "motor_enable", 1)
+		cmds.set(joint, "motor_target_velocity", 1)
+	}
+	if r.stop != nil && t.N == r.stopAt {
+		close(r.stop)
+	}
+	return r.doneAfter > 0 && len(r.ticks) >= r.doneAfter
+}
+
+func TestControlLoopRun(t *testing.T) {
+	const period = 50 * time.Millisecond
+	tests := []struct {
+		name      string
+		latency   time.Duration
+		limit     time.Duration
+		doneAfter int
+		stopAt    int // closes stop on this tick when positive
+		want      LoopStats
+		wantLast  time.Duration // Elapsed of the last tick
+		wantDt    time.Duration // Dt of the last tick
+		wantStill bool          // motors stopped at the end
+	}{
+		{
+			name:      "on schedule",
+			doneAfter: 5,
+			want:      LoopStats{Ticks: 5, Commands: 5},
+			wantLast:  200 * time.Millisecond,
+			wantDt:    period,
+		},
+		{
+			name:      "latency within the period",
+			latency:   30 * time.Millisecond,
+			doneAfter: 5,
+			want:      LoopStats{Ticks: 5, Commands: 5},
+			wantLast:  200 * time.Millisecond,
+			wantDt:    period,
+		},
+		{
+			name:      "overrun into the next tick",
+			latency:   70 * time.Millisecond,
+			doneAfter: 4,
+			want:      LoopStats{Ticks: 4, Overruns: 4, Commands: 4},
+			wantLast:  300 * time.Millisecond,
+			wantDt:    100 * time.Millisecond,
+		},
+		{
+			name:      "overrun past the next tick",
+			latency:   120 * time.Millisecond,
+			doneAfter: 4,
+			want:      LoopStats{Ticks: 4, Overruns: 4, Skipped: 4, Commands: 4},
+			wantLast:  450 * time.Millisecond,
+			wantDt:    150 * time.Millisecond,
+		},
+		{
+			name:      "limit",
+			limit:     200 * time.Millisecond,
+			want:      LoopStats{Ticks: 4, Commands: 4},
+			wantLast:  150 * time.Millisecond,
+			wantDt:    period,
+			wantStill: true,
+		},
+		{
+			name:      "limit counts skipped ticks",
+			latency:   70 * time.Millisecond,
+			limit:     200 * time.Millisecond,
+			want:      LoopStats{Ticks: 2, Overruns: 2, Commands: 2},
+			wantLast:  100 * time.Millisecond,
+			wantDt:    100 * time.Millisecond,
+			wantStill: true,
+		},
+		{
+			name:      "stop",
+			stopAt:    2,
+			want:      LoopStats{Ticks: 3, Commands: 3},
+			wantLast:  100 * time.Millisecond,
+			wantDt:    period,
+			wantStill: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newSimClock()
+			io := newLaggyJoints(clock, tt.latency)
+			loop := newControlLoop(io, period)
+			loop.Clock, loop.Limit = clock, tt.limit
+			rec := &tickRecorder{joints: []string{"j"}, doneAfter: tt.doneAfter}
+			var stop chan struct{}
+			if tt.stopAt > 0 {
+				stop = make(chan struct{})
+				rec.stop, rec.stopAt = stop, tt.stopAt
+			}
+			loop.Register(rec)
+
+			if err := loop.Run(stop); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			got := loop.Stats
+			if got.Ticks != tt.want.Ticks || got.Overruns != tt.want.Overruns ||
+				got.Skipped != tt.want.Skipped || got.Commands != tt.want.Commands {
+				t.Errorf("stats = %v, want %v", got, tt.want)
+			}
+			if got.MaxLatency != tt.latency {
+				t.Errorf("max latency = %v, want %v", got.MaxLatency, tt.latency)
+			}
+			last := rec.ticks[len(rec.ticks)-1]
+			if last.Elapsed != tt.wantLast || last.Dt != tt.wantDt {
+				t.Errorf("last tick at %v with dt %v, want %v with dt %v", last.Elapsed, last.Dt, tt.wantLast, tt.wantDt)
+			}
+			for i, tick := range rec.ticks {
+				if tick.N != i {
+					t.Errorf("tick %d numbered %d", i, tick.N)
+				}
+			}
+
+			final := io.sent[len(io.sent)-1]
+			v, ok := final["j"]["motor_target_velocity"]
+			if still := ok && v == 0; still != tt.wantStill {
+				t.Errorf("last command %v, want motors stopped %v", final, tt.wantStill)
+			}
+			if wantBatches := tt.want.Commands; tt.wantStill {
+				if len(io.sent) != wantBatches+1 {
+					t.Errorf("%d batches sent, want %d", len(io.sent), wantBatches+1)
+				}
+			}
+		})
+	}
+}
+
+func TestControlLoopStopsOnlyDrivenJoints(t *testing.T) {
+	clock := newSimClock()
+	io := newLaggyJoints(clock, 0)
+	loop := newControlLoop(io, 50*time.Millisecond)
+	loop.Clock, loop.Limit = clock, 100*time.Millisecond
+	loop.Register(&tickRecorder{joints: []string{"driven"}})
+	loop.Register(&paramSetter{joint: "tuned"})
+
+	if err := loop.Run(nil); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	final := io.sent[len(io.sent)-1]
+	if len(final) != 1 || final["driven"]["motor_target_velocity"] != 0 {
+		t.Errorf("stop sent %v, want only driven stopped", final)
+	}
+}
+
+// paramSetter sets a param that is not a motor velocity every tick.
+type paramSetter struct {
+	joint string
+}
+
+func (p *paramSetter) Joints() []string { return nil }
+
+func (p *paramSetter) Update(t Tick, cmds JointCommands) bool {
+	cmds.set(p.joint, "motor_max_impulse", 100)
+	return false
+}
+
+func TestSimJointsIntegratesVelocity(t *testing.T) {
+	clock := newSimClock()
+	sj := newSimJoints(clock)
+	sj.setParams(map[string]map[string]float64{
+		"on":  {"motor_enable": 1, "motor_target_velocity": 2},
+		"off": {"motor_target_velocity": 2},
+	})
+	<-clock.After(1500 * time.Millisecond)
+	angles, _ := sj.angles([]string{"on", "off", "unknown"})
+	want := map[string]float64{"on": 3, "off": 0, "unknown": 0}
+	for joint, angle := range want {
+		if angles[joint] != angle {
+			t.Errorf("%s at %g, want %g", joint, angles[joint], angle)
+		}
+	}
+}
+
+// runSim runs controllers to completion, or until limit, on simulated
+// joints starting at the given angles.
+func runSim(t *testing.T, limit time.Duration, start map[string]float64, controllers ...Controller) (*laggyJoints, LoopStats) {
+	t.Helper()
+	clock := newSimClock()
+	io := newLaggyJoints(clock, 0)
+	for joint, angle := range start {
+		io.angle[joint] = angle
+	}
+	loop := newControlLoop(io, 50*time.Millisecond)
+	loop.Clock, loop.Limit = clock, limit
+	for _, c := range controllers {
+		loop.Register(c)
+	}
+	if err := loop.Run(nil); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return io, loop.Stats
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Creature is a declarative definition of a model: the cubes to spawn and the
+// joints that hold them together. Names are logical; Name is used as the
+// instance prefix for the cubes and joints it spawns.
+type Creature struct {
+	Name      string        `json:"name,omitempty"`
+	Offset    []float64     `json:"offset,omitempty"`
+	Palette   Palette       `json:"palette,omitempty"`
+	Cubes     []Cube        `json:"cubes"`
+	Gradients []GradientDef `json:"gradients,omitempty"`
+	Joints    []JointDef    `json:"joints,omitempty"`
+	Mirrors   []MirrorDef   `json:"mirrors,omitempty"`
+}
+
+// JointDef describes one joint between two cubes of a creature.
+type JointDef struct {
+	Name   string             `json:"name"`
+	CubeA  string             `json:"cube_a"`
+	CubeB  string             `json:"cube_b"`
+	Type   JointKind          `json:"type"`
+	Params map[string]float64 `json:"params,omitempty"`
+	JointFrame
+	// The joint breaks when the force (N) or torque (N·m) holding it
+	// together exceeds these; zero means it never does.
+	BreakForce  float64 `json:"break_force,omitempty"`
+	BreakTorque float64 `json:"break_torque,omitempty"`
+}
+
+// loadCreature reads a creature definition from a JSON file.
+func loadCreature(path string) (*Creature, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[Creature] Failed to read %s: %v", path, err)
+	}
+	var c Creature
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("[Creature] Failed to parse %s: %v", path, err)
+	}
+	if err := c.prepare(); err != nil {
+		return nil, fmt.Errorf("[Creature] %s: %v", path, err)
+	}
+	return &c, nil
+}
+
+// prepare turns a definition as written into the one to spawn: it is
+// validated, its mirrors are expanded and its materials resolved.
+func (c *Creature) prepare() error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	if len(c.Mirrors) > 0 {
+		if err := c.expandMirrors(); err != nil {
+			return err
+		}
+		// The mirrored side is now spelled out; expanding again would
+		// only find its cubes already defined.
+		c.Mirrors = nil
+		if err := c.validate(); err != nil {
+			return err
+		}
+	}
+	return c.resolveMaterials()
+}
+
+// saveCreature writes a creature definition as indented JSON.
+func saveCreature(path string, c *Creature) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("[Creature] Failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// validate checks that names are unique and joints reference known cubes.
+func (c *Creature) validate() error {
+	cubes := make(map[string]bool, len(c.Cubes))
+	for _, cube := range c.Cubes {
+		if cube.Name == "" {
+			return fmt.Errorf("cube without a name")
+		}
+		if cubes[cube.Name] {
+			return fmt.Errorf("duplicate cube %q", cube.Name)
+		}
+		if len(cube.Position) != 3 {
+			return fmt.Errorf("cube %q needs a 3D position", cube.Name)
+		}
+		if len(cube.Size) != 0 && (len(cube.Size) != 3 || slices.Min(cube.Size) <= 0) {
+			return fmt.Errorf("cube %q size must be three positive lengths", cube.Name)
+		}
+		cubes[cube.Name] = true
+	}
+	joints := make(map[string]bool, len(c.Joints))
+	for _, joint := range c.Joints {
+		if joints[joint.Name] {
+			return fmt.Errorf("duplicate joint %q", joint.Name)
+		}
+		joints[joint.Name] = true
+		if !cubes[joint.CubeA] || !cubes[joint.CubeB] {
+			return fmt.Errorf("joint %q links unknown cubes %q and %q", joint.Name, joint.CubeA, joint.CubeB)
+		}
+		// An empty kind would pass any params; the server needs a real one.
+		if err := validateJointKind(joint.Type); err != nil {
+			return fmt.Errorf("joint %q: %v", joint.Name, err)
+		}
+		if err := validateJointParams(joint.Type, joint.Params); err != nil {
+			return fmt.Errorf("joint %q: %v", joint.Name, err)
+		}
+		if err := joint.JointFrame.validate(); err != nil {
+			return fmt.Errorf("joint %q: %v", joint.Name, err)
+		}
+		if joint.BreakForce < 0 || joint.BreakTorque < 0 {
+			return fmt.Errorf("joint %q: break thresholds cannot be negative", joint.Name)
+		}
+	}
+	return nil
+}
+
+// instance returns the instance that namespaces this creature's cubes.
+func (c *Creature) instance() *Instance {
+	return newInstance(c.Name, c.Offset)
+}
+
+// cube returns the cube with the given logical name.
+func (c *Creature) cube(name string) (Cube, bool) {
+	for _, cube := range c.Cubes {
+		if cube.Name == name {
+			return cube, true
+		}
+	}
+	return Cube{}, false
+}
+
+// joint returns the joint with the given logical name.
+func (c *Creature) joint(name string) (JointDef, bool) {
+	for _, joint := range c.Joints {
+		if joint.Name == name {
+			return joint, true
+		}
+	}
+	return JointDef{}, false
+}
+
+// chainJoints turns chains of logical cube names into joint definitions, one
+// per consecutive pair.
+func chainJoints(chains [][]string, jointType JointKind, params map[string]float64) []JointDef {
+	var joints []JointDef
+	for _, chain := range chains {
+		for i := 0; i < len(chain)-1; i++ {
+			joints = append(joints, JointDef{
+				Name:   fmt.Sprintf("joint_%s_%s", chain[i], chain[i+1]),
+				CubeA:  chain[i],
+				CubeB:  chain[i+1],
+				Type:   jointType,
+				Params: params,
+			})
+		}
+	}
+	return joints
+}
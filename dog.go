@@ -0,0 +1,192 @@
+package main
+
+import "slices"
+
+// dogCubeGroups returns the dog model at the origin, grouped by body part.
+// Names are logical: they carry neither an instance prefix nor the "_BASE"
+// suffix the server appends.
+func dogCubeGroups() [][]Cube {
+	return [][]Cube{
+		{
+			{Name: "rightear", Position: []float64{0, 130, 0}},
+			{Name: "leftear", Position: []float64{2, 130, 0}},
+		},
+		{
+			{Name: "head1", Position: []float64{0, 128.9, 0}},
+			{Name: "head2", Position: []float64{1, 128.9, 0}},
+			{Name: "head3", Position: []float64{2, 128.9, 0}},
+			{Name: "head4", Position: []float64{0, 128.9, 1}},
+			{Name: "head5", Position: []float64{1, 128.9, 1}},
+			{Name: "head6", Position: []float64{2, 128.9, 1}},
+			{Name: "head7", Position: []float64{0, 127.9, 0}},
+			{Name: "head8", Position: []float64{1, 127.9, 0}},
+			{Name: "head9", Position: []float64{2, 127.9, 0}},
+			{Name: "head10", Position: []float64{0, 127.9, 1}},
+			{Name: "head11", Position: []float64{1, 127.9, 1}},
+			{Name: "head12", Position: []float64{2, 127.9, 1}},
+		},
+		{
+			{Name: "leftmouth", Position: []float64{0.5, 128.9, -1}},
+			{Name: "rightmouth", Position: []float64{1.5, 128.9, -1}},
+		},
+		{
+			{Name: "neck", Position: []float64{1, 126.9, 0.5}},
+		},
+		{
+			{Name: "body1", Position: []float64{0, 125.9, 0}},
+			{Name: "body2", Position: []float64{1, 125.9, 0}},
+			{Name: "body3", Position: []float64{2, 125.9, 0}},
+			{Name: "body4", Position: []float64{0, 125.9, 1}},
+			{Name: "body5", Position: []float64{1, 125.9, 1}},
+			{Name: "body6", Position: []float64{2, 125.9, 1}},
+			{Name: "body7", Position: []float64{0, 124.9, 0}},
+			{Name: "body8", Position: []float64{1, 124.9, 0}},
+			{Name: "body9", Position: []float64{2, 124.9, 0}},
+			{Name: "body10", Position: []float64{0, 124.9, 1}},
+			{Name: "body11", Position: []float64{1, 124.9, 1}},
+			{Name: "body12", Position: []float64{2, 124.9, 1}},
+			{Name: "body13", Position: []float64{0, 125.9, 2}},
+			{Name: "body14", Position: []float64{1, 125.9, 2}},
+			{Name: "body15", Position: []float64{2, 125.9, 2}},
+			{Name: "body16", Position: []float64{0, 125.9, 3}},
+			{Name: "body17", Position: []float64{1, 125.9, 3}},
+			{Name: "body18", Position: []float64{2, 125.9, 3}},
+			{Name: "body19", Position: []float64{0, 124.9, 2}},
+			{Name: "body20", Position: []float64{1, 124.9, 2}},
+			{Name: "body21", Position: []float64{2, 124.9, 2}},
+			{Name: "body22", Position: []float64{0, 124.9, 3}},
+			{Name: "body23", Position: []float64{1, 124.9, 3}},
+			{Name: "body24", Position: []float64{2, 124.9, 3}},
+		},
+		{
+			{Name: "leftbackleg1", Position: []float64{2, 123.7, 3}},
+			{Name: "leftbackknee1", Position: []float64{2, 122.5, 3}},
+			{Name: "leftbackleg2", Position: []float64{2, 121.3, 3}},
+		},
+		{
+			{Name: "leftfrontleg1", Position: []float64{2, 123.7, 0}},
+			{Name: "leftfrontknee1", Position: []float64{2, 122.5, 0}},
+			{Name: "leftfrontleg2", Position: []float64{2, 121.3, 0}},
+		},
+		{
+			{Name: "rightbackleg1", Position: []float64{0, 123.7, 3}},
+			{Name: "rightbackknee1", Position: []float64{0, 122.5, 3}},
+			{Name: "rightbackleg2", Position: []float64{0, 121.3, 3}},
+		},
+		{
+			{Name: "rightfrontleg1", Position: []float64{0, 123.7, 0}},
+			{Name: "rightfrontknee1", Position: []float64{0, 122.5, 0}},
+			{Name: "rightfrontleg2", Position: []float64{0, 121.3, 0}},
+		},
+		{
+			{Name: "tail1", Position: []float64{1, 127.2, 3}},
+			{Name: "tail2", Position: []float64{1, 128.4, 3}},
+			{Name: "tail3", Position: []float64{1, 129.6, 3}},
+		},
+	}
+}
+
+// dogGroupNames names the entries of dogCubeGroups in order.
+var dogGroupNames = []string{
+	"ears", "head", "mouth", "neck", "body",
+	"leftbackleg", "leftfrontleg", "rightbackleg", "rightfrontleg", "tail",
+}
+
+// dogCubes flattens dogCubeGroups into a single model, putting each cube in
+// its group and tagging the mouth cubes.
+func dogCubes() []Cube {
+	var cubes []Cube
+	for i, group := range dogCubeGroups() {
+		for _, cube := range group {
+			cube.Group = dogGroupNames[i]
+			if slices.Contains(dogMouthCubes, cube.Name) {
+				cube.Tags = []string{"mouth"}
+			}
+			cubes = append(cubes, cube)
+		}
+	}
+	return cubes
+}
+
+// dogChains lists the hinge chains that hold the legs, tail, ears, mouth and
+// neck to the body, using logical cube names.
+func dogChains() [][]string {
+	return [][]string{
+		{"leftbackleg1", "leftbackknee1", "leftbackleg2"},
+		{"rightbackleg1", "rightbackknee1", "rightbackleg2"},
+		{"leftfrontleg1", "leftfrontknee1", "leftfrontleg2"},
+		{"rightfrontleg1", "rightfrontknee1", "rightfrontleg2"},
+		{"tail1", "tail2", "tail3"},
+		{"body24", "leftbackleg1"},
+		{"body22", "rightbackleg1"},
+		{"body9", "leftfrontleg1"},
+		{"body7", "rightfrontleg1"},
+		{"body17", "tail3"},
+		{"head1", "rightear"},
+		{"head3", "leftear"},
+		{"head2", "leftmouth"},
+		{"head2", "rightmouth"},
+		{"head8", "neck", "body2"},
+	}
+}
+
+// dogMouthCubes are the cubes painted yellow around the dog's mouth.
+var dogMouthCubes = []string{
+	"leftmouth", "rightmouth",
+	"body24", "body22", "body9", "body7", "body17",
+	"head1", "head3", "head2", "head8",
+	"body2",
+}
+
+// dogJointParams keeps every dog joint rigid until something drives it.
+func dogJointParams() map[string]float64 {
+	return map[string]float64{
+		"limit_upper":           0.0,
+		"limit_lower":           0.0,
+		"motor_enable":          1.0,
+		"motor_target_velocity": 0.0,
+		"motor_max_impulse":     1000.0,
+	}
+}
+
+// dogMirrors builds the right legs from the left ones, across the plane
+// through the middle of the body.
+var dogMirrors = []MirrorDef{
+	{Group: "leftbackleg", Axis: "x", At: 1},
+	{Group: "leftfrontleg", Axis: "x", At: 1},
+}
+
+// dogCreature returns the dog as a creature definition, with the mouth painted
+// yellow, a gradient down the tail and every chain hinged. Only the left legs
+// are written out; dogMirrors generates the right ones.
+func dogCreature(name string, offset []float64) *Creature {
+	mirrored := make(map[string]bool)
+	var cubes []Cube
+	for _, cube := range dogCubes() {
+		if cube.Group == "rightbackleg" || cube.Group == "rightfrontleg" {
+			mirrored[cube.Name] = true
+			continue
+		}
+		if slices.Contains(cube.Tags, "mouth") {
+			cube.Material = "mouth"
+		}
+		cubes = append(cubes, cube)
+	}
+	var joints []JointDef
+	for _, joint := range chainJoints(dogChains(), "hinge", dogJointParams()) {
+		if !mirrored[joint.CubeA] && !mirrored[joint.CubeB] {
+			joints = append(joints, joint)
+		}
+	}
+	return &Creature{
+		Name:    name,
+		Offset:  offset,
+		Palette: Palette{"mouth": "#FFFF00", "fur": "#8B5A2B"},
+		Cubes:   cubes,
+		Gradients: []GradientDef{
+			{Cubes: []string{"tail1", "tail2", "tail3"}, Stops: []string{"fur", "white"}},
+		},
+		Joints:  joints,
+		Mirrors: dogMirrors,
+	}
+}
@@ -3,8 +3,13 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"math"
 	"net"
+	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -19,23 +24,24 @@ const (
 type Message map[string]interface{}
 
 type Cube struct {
-	Name     string
-	Position []float64
+	Name     string    `json:"name"`
+	Position []float64 `json:"position"`
+	Rotation []float64 `json:"rotation,omitempty"` // degrees, defaults to 0,0,0
+	Color    string    `json:"color,omitempty"`    // hex, e.g. "#FFFF00"
+	Material string    `json:"material,omitempty"` // palette entry, overrides Color
+	Size     []float64 `json:"size,omitempty"`     // edge lengths, defaults to a unit cube
+	Mass     float64   `json:"mass,omitempty"`     // defaults to the server's cube mass
+	Group    string    `json:"group,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
 }
 
 type CubeLink struct {
 	JointName string
 	CubeA     string
 	CubeB     string
+	Type      JointKind
 }
 
-var (
-	globalCubeList  []string
-	cubeListMutex   sync.Mutex
-	globalCubeLinks []CubeLink
-	linkListMutex   sync.Mutex
-)
-
 func sendJSONMessage(conn net.Conn, msg Message) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
@@ -47,16 +53,27 @@ func sendJSONMessage(conn net.Conn, msg Message) error {
 }
 
 func readResponse(conn net.Conn) (string, error) {
-	reader := bufio.NewReader(conn)
 	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	return readReply(bufio.NewReader(conn))
+}
+
+// readReply reads one delimited reply. Pipelined replies must share one
+// reader, since it may buffer the start of the next reply. If the
+// connection fails before the delimiter, whatever was read is returned with
+// the error.
+func readReply(reader *bufio.Reader) (string, error) {
 	var builder strings.Builder
 	for {
 		line, err := reader.ReadString('-')
+		builder.WriteString(line)
 		if err != nil {
-			break
+			if err == io.EOF && builder.Len() > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return strings.TrimSpace(builder.String()), err
 		}
-		builder.WriteString(line)
-		if strings.Contains(line, delimiter) {
+		// The delimiter itself contains '-', so it spans several reads.
+		if strings.HasSuffix(builder.String(), delimiter) {
 			break
 		}
 	}
@@ -64,61 +81,98 @@ func readResponse(conn net.Conn) (string, error) {
 	return strings.TrimSpace(full), nil
 }
 
-func spawnCube(cube Cube, wg *sync.WaitGroup) {
-	defer wg.Done()
-	conn, err := net.Dial("tcp", serverAddr)
-	if err != nil {
-		fmt.Println("[Spawn] Failed to connect:", err)
-		return
-	}
-	defer conn.Close()
-
-	if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-		fmt.Println("[Spawn] Auth write error:", err)
-		return
+// spawnMessage builds the spawn_cube command for a cube. Size and mass are
+// only sent when set, so plain cubes keep the server's defaults.
+func spawnMessage(cube Cube) Message {
+	rotation := cube.Rotation
+	if len(rotation) != 3 {
+		rotation = []float64{0, 0, 0}
 	}
-	_, err = readResponse(conn)
-	if err != nil {
-		fmt.Println("[Spawn] Failed to read auth response:", err)
-		return
-	}
-
 	spawn := Message{
 		"type":      "spawn_cube",
 		"cube_name": cube.Name,
 		"position":  cube.Position,
-		"rotation":  []float64{0, 0, 0},
+		"rotation":  rotation,
 		"is_base":   true,
 	}
-	if err := sendJSONMessage(conn, spawn); err != nil {
+	if len(cube.Size) == 3 {
+		spawn["size"] = cube.Size
+	}
+	if cube.Mass > 0 {
+		spawn["mass"] = cube.Mass
+	}
+	return spawn
+}
+
+func (s *Session) spawnCube(cube Cube, wg *sync.WaitGroup) {
+	defer wg.Done()
+	conn, err := s.connect()
+	if err != nil {
+		fmt.Println("[Spawn]", err)
+		return
+	}
+	defer conn.Close()
+
+	if err := sendJSONMessage(conn, spawnMessage(cube)); err != nil {
 		fmt.Println("[Spawn] Failed to spawn cube:", err)
 		return
 	}
 
-	fullCubeName := cube.Name + "_BASE"
-	cubeListMutex.Lock()
-	globalCubeList = append(globalCubeList, fullCubeName)
-	cubeListMutex.Unlock()
+	cube.Name = serverCubeName(cube.Name)
+	s.trackCube(cube)
+}
+
+// spawnCubes spawns many cubes over a single connection. It is the bulk
+// counterpart of spawnCube for walls and imported models with thousands of
+// cubes.
+func (s *Session) spawnCubes(cubes []Cube) error {
+	msgs := make([]Message, len(cubes))
+	tracked := make([]Cube, len(cubes))
+	for i, cube := range cubes {
+		msgs[i] = spawnMessage(cube)
+		cube.Name = serverCubeName(cube.Name)
+		tracked[i] = cube
+	}
+	replies, err := s.requestBatch(msgs)
+	if len(replies) == 0 && err != nil {
+		return fmt.Errorf("[Spawn] Failed to spawn %d cubes: %v", len(cubes), err)
+	}
+	// Cubes the server did not answer for may still exist, so only the
+	// refused ones go untracked; a tracked cube that is missing costs
+	// nothing at cleanup, an untracked one is leaked.
+	refused := refusedReplies(replies)
+	var spawned []Cube
+	var failed []string
+	for i, cube := range tracked {
+		if msg, bad := refused[i]; bad {
+			failed = append(failed, fmt.Sprintf("%s: %s", cube.Name, msg))
+			continue
+		}
+		spawned = append(spawned, cube)
+	}
+	s.trackCubes(spawned)
+	if err != nil {
+		return fmt.Errorf("[Spawn] %d of %d cubes unconfirmed: %v", len(cubes)-len(replies), len(cubes), err)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("[Spawn] Server refused %d cubes: %s", len(failed), strings.Join(failed, "; "))
+	}
+	return nil
 }
 
-func unfreezeAllCubes() {
+func (s *Session) unfreezeAllCubes() {
 	var wg sync.WaitGroup
-	for _, cube := range globalCubeList {
+	for _, cube := range s.CubeNames() {
 		wg.Add(1)
 		go func(name string) {
 			defer wg.Done()
-			conn, err := net.Dial("tcp", serverAddr)
+			conn, err := s.connect()
 			if err != nil {
-				fmt.Println("[Unfreeze] Failed to connect:", err)
+				fmt.Println("[Unfreeze]", err)
 				return
 			}
 			defer conn.Close()
 
-			if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-				return
-			}
-			_, _ = readResponse(conn)
-
 			unfreeze := Message{
 				"type":      "freeze_cube",
 				"cube_name": name,
@@ -130,74 +184,168 @@ func unfreezeAllCubes() {
 	wg.Wait()
 }
 
-func despawnAllCubes() {
+func (s *Session) despawnAllCubes() {
 	var wg sync.WaitGroup
-	for _, cube := range globalCubeList {
+	var mu sync.Mutex
+	var despawned []string
+	for _, cube := range s.CubeNames() {
 		wg.Add(1)
 		go func(name string) {
 			defer wg.Done()
-			conn, err := net.Dial("tcp", serverAddr)
+			conn, err := s.connect()
 			if err != nil {
-				fmt.Println("[Despawn] Failed to connect:", err)
+				fmt.Println("[Despawn]", err)
 				return
 			}
 			defer conn.Close()
 
-			if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-				return
-			}
-			_, _ = readResponse(conn)
-
 			despawn := Message{
 				"type":      "despawn_cube",
 				"cube_name": name,
 			}
-			sendJSONMessage(conn, despawn)
+			if err := sendJSONMessage(conn, despawn); err != nil {
+				fmt.Println("[Despawn] Failed to despawn cube:", err)
+				return
+			}
+			mu.Lock()
+			despawned = append(despawned, name)
+			mu.Unlock()
 		}(cube)
 	}
 	wg.Wait()
+	s.untrackCubes(despawned)
 }
 
-func linkCubes(cubeA, cubeB, jointType, jointName string) {
-	conn, err := net.Dial("tcp", serverAddr)
+// linkCubes creates one joint. Parts of the frame left unset default from
+// the face the cubes share, when the session knows both cubes.
+func (s *Session) linkCubes(cubeA, cubeB string, jointType JointKind, jointName string, frame JointFrame) error {
+	if err := validateJointKind(jointType); err != nil {
+		return fmt.Errorf("[Link] %v", err)
+	}
+	conn, err := s.connect()
 	if err != nil {
-		fmt.Println("[Link] Failed to connect:", err)
-		return
+		return fmt.Errorf("[Link] %v", err)
 	}
 	defer conn.Close()
 
-	if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-		fmt.Println("[Link] Auth write error:", err)
-		return
-	}
-	_, _ = readResponse(conn)
+	link := jointMessage(s.resolveJointFrame(JointDef{
+		Name:       jointName,
+		CubeA:      cubeA,
+		CubeB:      cubeB,
+		Type:       jointType,
+		JointFrame: frame,
+	}))
 
-	link := Message{
-		"type":       "create_joint",
-		"cube1":      cubeA,
-		"cube2":      cubeB,
-		"joint_type": jointType,
-		"joint_name": jointName,
+	if err := sendJSONMessage(conn, link); err != nil {
+		return fmt.Errorf("[Link] Failed to send link command: %v", err)
+	}
+	resp, err := readResponse(conn)
+	if err != nil {
+		return fmt.Errorf("[Link] Failed to read reply: %v", err)
+	}
+	links, err := parseJointReply(resp)
+	if err != nil {
+		return fmt.Errorf("[Link] %s <--> %s: %v", cubeA, cubeB, err)
 	}
+	if len(links) == 0 {
+		// The server did not say otherwise, so it kept the requested name.
+		links = []CubeLink{{JointName: jointName, CubeA: cubeA, CubeB: cubeB}}
+	}
+	for i := range links {
+		links[i].Type = jointType
+	}
+	s.trackLinks(links)
 
-	if err := sendJSONMessage(conn, link); err != nil {
-		fmt.Println("[Link] Failed to send link command:", err)
-		return
+	fmt.Printf("🔗 Linked %s <--> %s with joint '%s' (%s)\n", cubeA, cubeB, links[0].JointName, jointType)
+	return nil
+}
+
+// jointReply is what the server answers to commands that create joints:
+// one joint for create_joint, a list for the chain commands.
+type jointReply struct {
+	Type      string `json:"type"`
+	Message   string `json:"message"`
+	JointName string `json:"joint_name"`
+	Cube1     string `json:"cube1"`
+	Cube2     string `json:"cube2"`
+	Joints    []struct {
+		JointName string `json:"joint_name"`
+		Cube1     string `json:"cube1"`
+		Cube2     string `json:"cube2"`
+	} `json:"joints"`
+}
+
+// parseJointReply returns the joints a reply says were created. A reply that
+// names no joints yields none; an error reply yields its message.
+func parseJointReply(resp string) ([]CubeLink, error) {
+	var reply jointReply
+	if err := json.Unmarshal([]byte(resp), &reply); err != nil {
+		return nil, fmt.Errorf("unreadable reply %q: %v", resp, err)
 	}
+	if reply.Type == "error" {
+		return nil, fmt.Errorf("server refused: %s", reply.Message)
+	}
+	var links []CubeLink
+	if reply.JointName != "" {
+		links = append(links, CubeLink{JointName: reply.JointName, CubeA: reply.Cube1, CubeB: reply.Cube2})
+	}
+	for _, j := range reply.Joints {
+		links = append(links, CubeLink{JointName: j.JointName, CubeA: j.Cube1, CubeB: j.Cube2})
+	}
+	return links, nil
+}
 
-	linkListMutex.Lock()
-	globalCubeLinks = append(globalCubeLinks, CubeLink{
-		JointName: jointName,
-		CubeA:     cubeA,
-		CubeB:     cubeB,
-	})
-	linkListMutex.Unlock()
+// createJoints creates many joints in one batch. Cube names are server names.
+func (s *Session) createJoints(joints []JointDef) error {
+	msgs := make([]Message, len(joints))
+	for i, joint := range joints {
+		if err := validateJointKind(joint.Type); err != nil {
+			return fmt.Errorf("[Link] Joint %s: %v", joint.Name, err)
+		}
+		msgs[i] = jointMessage(s.resolveJointFrame(joint))
+	}
+	replies, err := s.requestBatch(msgs)
+	if len(replies) == 0 && err != nil {
+		return fmt.Errorf("[Link] Failed to create %d joints: %v", len(joints), err)
+	}
+	if err != nil {
+		fmt.Printf("[Link] %v; run refreshJoints to track the rest\n", err)
+	}
 
-	fmt.Printf("🔗 Linked %s <--> %s with joint '%s' (%s)\n", cubeA, cubeB, jointName, jointType)
+	var links []CubeLink
+	var failed []string
+	for i, resp := range replies {
+		joint := joints[i]
+		confirmed, err := parseJointReply(resp)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", joint.Name, err))
+			continue
+		}
+		if len(confirmed) == 0 {
+			confirmed = []CubeLink{{JointName: joint.Name, CubeA: joint.CubeA, CubeB: joint.CubeB}}
+		}
+		for _, link := range confirmed {
+			if link.JointName != joint.Name {
+				fmt.Printf("[Link] Server named joint %s %s\n", joint.Name, link.JointName)
+			}
+			link.Type = joint.Type
+			links = append(links, link)
+		}
+	}
+	s.trackLinks(links)
+	fmt.Printf("🔗 Created %d joints\n", len(links))
+	if len(failed) > 0 {
+		return fmt.Errorf("[Link] %d joints failed: %s", len(failed), strings.Join(failed, "; "))
+	}
+	return nil
 }
 
 // setJointParam sends a JSON command to set a specific parameter for a joint.
 func setJointParam(conn net.Conn, jointName, paramName string, value float64) {
+	if err := validateJointParams("", map[string]float64{paramName: value}); err != nil {
+		fmt.Printf("[setJointParam] Not sending to joint %s: %v\n", jointName, err)
+		return
+	}
 	// Build the command message.
 	cmd := Message{
 		"type":       "set_joint_param",
@@ -220,27 +368,16 @@ func setJointParam(conn net.Conn, jointName, paramName string, value float64) {
 }
 
 // stiffenAllJoints opens a TCP connection, authenticates, and then loops over all joints
-// (stored in globalCubeLinks) to apply a set of stiffening parameters.
-func SingleThreadedstiffenAllJoints() {
-	// Open a connection.
-	conn, err := net.Dial("tcp", serverAddr)
+// tracked by the session to apply a set of stiffening parameters.
+func (s *Session) SingleThreadedstiffenAllJoints() {
+	// Open an authenticated connection.
+	conn, err := s.connect()
 	if err != nil {
-		fmt.Println("[stiffenAllJoints] Failed to connect:", err)
+		fmt.Println("[stiffenAllJoints]", err)
 		return
 	}
 	defer conn.Close()
 
-	// Authenticate.
-	if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-		fmt.Println("[stiffenAllJoints] Auth write error:", err)
-		return
-	}
-	_, err = readResponse(conn)
-	if err != nil {
-		fmt.Println("[stiffenAllJoints] Failed to read auth response:", err)
-		return
-	}
-
 	// Define the parameters to enforce stiffness.
 	/*params := map[string]float64{
 		"limit_upper":           0.0, // both 0 => no swing
@@ -261,15 +398,15 @@ func SingleThreadedstiffenAllJoints() {
 		"motor_max_impulse":     1000.0,
 	}
 
-	// Loop over each joint stored in globalCubeLinks.
-	for _, link := range globalCubeLinks {
+	// Loop over each joint tracked by the session.
+	for _, link := range s.Links() {
 		for param, value := range params {
 			setJointParam(conn, link.JointName, param, value)
 		}
 	}
 }
 
-func SingleTCPConnectionExamplestiffenAllJoints() {
+func (s *Session) SingleTCPConnectionExamplestiffenAllJoints() {
 	// Define the parameters for stiffening.
 	params := map[string]float64{
 		"limit_upper":           0.0,
@@ -279,26 +416,16 @@ func SingleTCPConnectionExamplestiffenAllJoints() {
 		"motor_max_impulse":     1000.0,
 	}
 
-	// 1) Open ONE TCP connection for all joints.
-	conn, err := net.Dial("tcp", serverAddr)
+	// 1) Open ONE authenticated TCP connection for all joints.
+	conn, err := s.connect()
 	if err != nil {
-		fmt.Println("[stiffenAllJoints] Failed to connect:", err)
+		fmt.Println("[stiffenAllJoints]", err)
 		return
 	}
 	defer conn.Close()
 
-	// Authenticate once.
-	if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-		fmt.Println("[stiffenAllJoints] Auth write error:", err)
-		return
-	}
-	if _, err := readResponse(conn); err != nil {
-		fmt.Println("[stiffenAllJoints] Auth response error:", err)
-		return
-	}
-
-	// 2) For each joint in globalCubeLinks...
-	for _, link := range globalCubeLinks {
+	// 2) For each joint tracked by the session...
+	for _, link := range s.Links() {
 		// 3) For each parameter, send the command via setJointParam.
 		for paramName, val := range params {
 			setJointParam(conn, link.JointName, paramName, val)
@@ -315,7 +442,7 @@ func SingleTCPConnectionExamplestiffenAllJoints() {
 	fmt.Println("[stiffenAllJoints] All joints have been stiffened using a single connection.")
 }
 
-func stiffenAllJoints() {
+func (s *Session) stiffenAllJoints() {
 	// The parameter set we want for each joint.
 	params := map[string]float64{
 		"limit_upper":           0.0,
@@ -325,31 +452,21 @@ func stiffenAllJoints() {
 		"motor_max_impulse":     1000.0,
 	}
 
-	// We'll spawn one goroutine per joint in globalCubeLinks.
+	// We'll spawn one goroutine per joint tracked by the session.
 	var wg sync.WaitGroup
-	for _, link := range globalCubeLinks {
+	for _, link := range s.Links() {
 		wg.Add(1)
 		go func(joint CubeLink) {
 			defer wg.Done()
 
-			// Open a fresh TCP connection for this joint.
-			conn, err := net.Dial("tcp", serverAddr)
+			// Open a fresh authenticated TCP connection for this joint.
+			conn, err := s.connect()
 			if err != nil {
-				fmt.Printf("[stiffenAllJoints] Failed to connect for joint %s: %v\n", joint.JointName, err)
+				fmt.Printf("[stiffenAllJoints] Joint %s: %v\n", joint.JointName, err)
 				return
 			}
 			defer conn.Close()
 
-			// Authenticate
-			if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-				fmt.Printf("[stiffenAllJoints] Auth write error for joint %s: %v\n", joint.JointName, err)
-				return
-			}
-			if _, err := readResponse(conn); err != nil {
-				fmt.Printf("[stiffenAllJoints] Auth response error for joint %s: %v\n", joint.JointName, err)
-				return
-			}
-
 			// For each parameter, set it on this joint.
 			for paramName, val := range params {
 				setJointParam(conn, joint.JointName, paramName, val)
@@ -362,25 +479,38 @@ func stiffenAllJoints() {
 	fmt.Println("[stiffenAllJoints] All joints have been stiffened.")
 }
 
-func setJointParams(conn net.Conn, jointName string, params map[string]float64) {
+// setJointParams sends params for one joint and checks the reply. Names and
+// ranges are checked against every joint kind's schema first, since the
+// joint's own kind is not known here; callers that know it should validate
+// against it.
+func setJointParams(conn net.Conn, jointName string, params map[string]float64) error {
+	if err := validateJointParams("", params); err != nil {
+		return fmt.Errorf("[setJointParams] Not sending to joint %s: %v", jointName, err)
+	}
 	cmd := Message{
 		"type":       "set_joint_params",
 		"joint_name": jointName,
 		"params":     params,
 	}
 	if err := sendJSONMessage(conn, cmd); err != nil {
-		fmt.Printf("[setJointParams] Failed to send joint params for %s: %v\n", jointName, err)
-		return
+		return fmt.Errorf("[setJointParams] Failed to send joint params for %s: %v", jointName, err)
 	}
 	resp, err := readResponse(conn)
 	if err != nil {
-		fmt.Printf("[setJointParams] Read error for %s: %v\n", jointName, err)
-		return
+		return fmt.Errorf("[setJointParams] Read error for %s: %v", jointName, err)
+	}
+	var reply struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal([]byte(resp), &reply) == nil && reply.Type == "error" {
+		return fmt.Errorf("[setJointParams] %s: server refused: %s", jointName, reply.Message)
 	}
 	fmt.Printf("[setJointParams] %s response: %s\n", jointName, resp)
+	return nil
 }
 
-func stiffenAllJointsBULK() {
+func (s *Session) stiffenAllJointsBULK() {
 	params := map[string]float64{
 		"limit_upper":           0.0,
 		"limit_lower":           0.0,
@@ -390,103 +520,43 @@ func stiffenAllJointsBULK() {
 	}
 
 	var wg sync.WaitGroup
-	for _, link := range globalCubeLinks {
+	for _, link := range s.Links() {
 		wg.Add(1)
 		go func(joint CubeLink) {
 			defer wg.Done()
 
-			conn, err := net.Dial("tcp", serverAddr)
+			conn, err := s.connect()
 			if err != nil {
-				fmt.Printf("[stiffenAllJoints] Failed to connect for joint %s: %v\n", joint.JointName, err)
+				fmt.Printf("[stiffenAllJoints] Joint %s: %v\n", joint.JointName, err)
 				return
 			}
 			defer conn.Close()
 
-			if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-				fmt.Printf("[stiffenAllJoints] Auth write error for joint %s: %v\n", joint.JointName, err)
-				return
+			if err := setJointParams(conn, joint.JointName, params); err != nil {
+				fmt.Println(err)
 			}
-			if _, err := readResponse(conn); err != nil {
-				fmt.Printf("[stiffenAllJoints] Auth response error for joint %s: %v\n", joint.JointName, err)
-				return
-			}
-
-			setJointParams(conn, joint.JointName, params)
 		}(link)
 	}
 	wg.Wait()
 	fmt.Println("[stiffenAllJoints] All joints updated.")
 }
 
-func setMouthColorYellow() {
-	var mouthCubes = []string{"leftmouth_BASE",
-		"rightmouth_BASE", "body24_BASE", "body22_BASE", "body9_BASE", "body7_BASE",
-		"body17_BASE",
-		"head1_BASE",
-		"head3_BASE",
-		"head2_BASE",
-		"head8_BASE",
-		"body2_BASE",
-	}
-
-	var wg sync.WaitGroup
-	for _, cubeName := range mouthCubes {
-		wg.Add(1)
-		go func(name string) {
-			defer wg.Done()
-			conn, err := net.Dial("tcp", serverAddr)
-			if err != nil {
-				fmt.Printf("[Color] Failed to connect for cube %s: %v\n", name, err)
-				return
-			}
-			defer conn.Close()
-
-			if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-				fmt.Printf("[Color] Auth write error for cube %s: %v\n", name, err)
-				return
-			}
-			if _, err := readResponse(conn); err != nil {
-				fmt.Printf("[Color] Auth response error for cube %s: %v\n", name, err)
-				return
-			}
-
-			colorMsg := Message{
-				"type":      "set_color",
-				"cube_name": name,
-				"hex":       "#FFFF00", // Yellow
-			}
-
-			if err := sendJSONMessage(conn, colorMsg); err != nil {
-				fmt.Printf("[Color] Failed to send color change for cube %s: %v\n", name, err)
-			}
-		}(cubeName)
-	}
-	wg.Wait()
-}
-
 // testLinkBodyCubes creates a TCP connection, authenticates, and sends a JSON command
 // to link all cubes whose names start with the given prefix.
-// It prints both the authentication response and the command response.
-func testLinkBodyCubes(prefix string, jointType string, jointParams map[string]float64) {
-	// Connect to the server.
-	conn, err := net.Dial("tcp", serverAddr)
-	if err != nil {
-		fmt.Println("[testLinkBodyCubes] Error connecting:", err)
+// It prints the command response.
+func (s *Session) testLinkBodyCubes(prefix string, jointType JointKind, jointParams map[string]float64) {
+	if err := validateJointParams(jointType, jointParams); err != nil {
+		fmt.Println("[testLinkBodyCubes]", err)
 		return
 	}
-	defer conn.Close()
 
-	// Authenticate with the server.
-	if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-		fmt.Println("[testLinkBodyCubes] Auth write error:", err)
-		return
-	}
-	authResp, err := readResponse(conn)
+	// Connect to the server and authenticate.
+	conn, err := s.connect()
 	if err != nil {
-		fmt.Println("[testLinkBodyCubes] Failed to read auth response:", err)
+		fmt.Println("[testLinkBodyCubes]", err)
 		return
 	}
-	fmt.Println("[testLinkBodyCubes] Auth response:", authResp)
+	defer conn.Close()
 
 	// Build the JSON command message.
 	cmdMsg := Message{
@@ -502,39 +572,67 @@ func testLinkBodyCubes(prefix string, jointType string, jointParams map[string]f
 		return
 	}
 
-	// Optionally read the server's response to the command.
 	cmdResp, err := readResponse(conn)
 	if err != nil {
 		fmt.Println("[testLinkBodyCubes] Error reading command response:", err)
 		return
 	}
 	fmt.Println("[testLinkBodyCubes] Command response:", cmdResp)
+	s.trackReplyJoints("testLinkBodyCubes", cmdResp, jointType)
 }
 
-func linkCubeChains(chains [][]string, jointType string, jointParams map[string]float64) error {
-	// Establish TCP connection
-	conn, err := net.Dial("tcp", serverAddr)
+// trackReplyJoints records the joints a chain command's reply reports. A
+// reply that lists none leaves the session to find them on the server.
+func (s *Session) trackReplyJoints(caller, resp string, jointType JointKind) {
+	links, err := parseJointReply(resp)
 	if err != nil {
-		return fmt.Errorf("[linkCubeChains] Failed to connect: %v", err)
+		fmt.Printf("[%s] %v\n", caller, err)
+		return
 	}
-	defer conn.Close()
+	if len(links) == 0 {
+		s.refreshJoints()
+		return
+	}
+	for i := range links {
+		links[i].Type = jointType
+	}
+	s.trackLinks(links)
+}
 
-	// Authenticate
-	if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-		return fmt.Errorf("[linkCubeChains] Auth write error: %v", err)
+func (s *Session) linkCubeChains(chains [][]string, jointType JointKind, jointParams map[string]float64) error {
+	if err := validateJointParams(jointType, jointParams); err != nil {
+		return fmt.Errorf("[linkCubeChains] %v", err)
 	}
-	authResp, err := readResponse(conn)
+
+	// Establish an authenticated TCP connection
+	conn, err := s.connect()
 	if err != nil {
-		return fmt.Errorf("[linkCubeChains] Failed to read auth response: %v", err)
+		return fmt.Errorf("[linkCubeChains] %v", err)
 	}
-	fmt.Println("[linkCubeChains] Auth response:", authResp)
+	defer conn.Close()
 
-	// Construct the command
+	// Construct the command, placing each link on the face its cubes share
+	// where the session knows them.
+	frames := make([][]Message, len(chains))
+	for i, chain := range chains {
+		for j := 0; j < len(chain)-1; j++ {
+			joint := s.resolveJointFrame(JointDef{CubeA: chain[j], CubeB: chain[j+1], Type: jointType})
+			frame := Message{}
+			if len(joint.Anchor) == 3 {
+				frame["anchor"] = joint.Anchor
+			}
+			if len(joint.Axis) == 3 {
+				frame["axis"] = joint.Axis
+			}
+			frames[i] = append(frames[i], frame)
+		}
+	}
 	cmd := Message{
 		"type":         "link_cube_chains",
 		"chains":       chains,
 		"joint_type":   jointType,
 		"joint_params": jointParams,
+		"joint_frames": frames,
 	}
 
 	// Send the command
@@ -549,119 +647,44 @@ func linkCubeChains(chains [][]string, jointType string, jointParams map[string]
 	}
 	fmt.Println("[linkCubeChains] Server response:", resp)
 
-	// Update globalCubeLinks for tracking (optional, adjust as needed)
-	linkListMutex.Lock()
-	defer linkListMutex.Unlock()
-	for _, chain := range chains {
-		for i := 0; i < len(chain)-1; i++ {
-			cubeA := chain[i]
-			cubeB := chain[i+1]
-			jointName := fmt.Sprintf("joint_%s_%s_%s", jointType, cubeA, cubeB) // Simplified name
-			globalCubeLinks = append(globalCubeLinks, CubeLink{
-				JointName: jointName,
-				CubeA:     cubeA,
-				CubeB:     cubeB,
-			})
-		}
-	}
-
+	s.trackReplyJoints("linkCubeChains", resp, jointType)
 	return nil
 }
 
 func main() {
-	// Position offset for moving the whole structure
-	var offset = []float64{40, -20, -3} // Example: move dog +10 X, +5 Y, -3 Z
-
-	// Cube groups with offset applied manually
-	cubeGroups := [][]Cube{
-		{
-			{Name: "rightear", Position: []float64{0 + offset[0], 130 + offset[1], 0 + offset[2]}},
-			{Name: "leftear", Position: []float64{2 + offset[0], 130 + offset[1], 0 + offset[2]}},
-		},
-		{
-			{Name: "head1", Position: []float64{0 + offset[0], 128.9 + offset[1], 0 + offset[2]}},
-			{Name: "head2", Position: []float64{1 + offset[0], 128.9 + offset[1], 0 + offset[2]}},
-			{Name: "head3", Position: []float64{2 + offset[0], 128.9 + offset[1], 0 + offset[2]}},
-			{Name: "head4", Position: []float64{0 + offset[0], 128.9 + offset[1], 1 + offset[2]}},
-			{Name: "head5", Position: []float64{1 + offset[0], 128.9 + offset[1], 1 + offset[2]}},
-			{Name: "head6", Position: []float64{2 + offset[0], 128.9 + offset[1], 1 + offset[2]}},
-			{Name: "head7", Position: []float64{0 + offset[0], 127.9 + offset[1], 0 + offset[2]}},
-			{Name: "head8", Position: []float64{1 + offset[0], 127.9 + offset[1], 0 + offset[2]}},
-			{Name: "head9", Position: []float64{2 + offset[0], 127.9 + offset[1], 0 + offset[2]}},
-			{Name: "head10", Position: []float64{0 + offset[0], 127.9 + offset[1], 1 + offset[2]}},
-			{Name: "head11", Position: []float64{1 + offset[0], 127.9 + offset[1], 1 + offset[2]}},
-			{Name: "head12", Position: []float64{2 + offset[0], 127.9 + offset[1], 1 + offset[2]}},
-		},
-		{
-			{Name: "leftmouth", Position: []float64{0.5 + offset[0], 128.9 + offset[1], -1 + offset[2]}},
-			{Name: "rightmouth", Position: []float64{1.5 + offset[0], 128.9 + offset[1], -1 + offset[2]}},
-		},
-		{
-			{Name: "neck", Position: []float64{1 + offset[0], 126.9 + offset[1], 0.5 + offset[2]}},
-		},
-		{
-			{Name: "body1", Position: []float64{0 + offset[0], 125.9 + offset[1], 0 + offset[2]}},
-			{Name: "body2", Position: []float64{1 + offset[0], 125.9 + offset[1], 0 + offset[2]}},
-			{Name: "body3", Position: []float64{2 + offset[0], 125.9 + offset[1], 0 + offset[2]}},
-			{Name: "body4", Position: []float64{0 + offset[0], 125.9 + offset[1], 1 + offset[2]}},
-			{Name: "body5", Position: []float64{1 + offset[0], 125.9 + offset[1], 1 + offset[2]}},
-			{Name: "body6", Position: []float64{2 + offset[0], 125.9 + offset[1], 1 + offset[2]}},
-			{Name: "body7", Position: []float64{0 + offset[0], 124.9 + offset[1], 0 + offset[2]}},
-			{Name: "body8", Position: []float64{1 + offset[0], 124.9 + offset[1], 0 + offset[2]}},
-			{Name: "body9", Position: []float64{2 + offset[0], 124.9 + offset[1], 0 + offset[2]}},
-			{Name: "body10", Position: []float64{0 + offset[0], 124.9 + offset[1], 1 + offset[2]}},
-			{Name: "body11", Position: []float64{1 + offset[0], 124.9 + offset[1], 1 + offset[2]}},
-			{Name: "body12", Position: []float64{2 + offset[0], 124.9 + offset[1], 1 + offset[2]}},
-			{Name: "body13", Position: []float64{0 + offset[0], 125.9 + offset[1], 2 + offset[2]}},
-			{Name: "body14", Position: []float64{1 + offset[0], 125.9 + offset[1], 2 + offset[2]}},
-			{Name: "body15", Position: []float64{2 + offset[0], 125.9 + offset[1], 2 + offset[2]}},
-			{Name: "body16", Position: []float64{0 + offset[0], 125.9 + offset[1], 3 + offset[2]}},
-			{Name: "body17", Position: []float64{1 + offset[0], 125.9 + offset[1], 3 + offset[2]}},
-			{Name: "body18", Position: []float64{2 + offset[0], 125.9 + offset[1], 3 + offset[2]}},
-			{Name: "body19", Position: []float64{0 + offset[0], 124.9 + offset[1], 2 + offset[2]}},
-			{Name: "body20", Position: []float64{1 + offset[0], 124.9 + offset[1], 2 + offset[2]}},
-			{Name: "body21", Position: []float64{2 + offset[0], 124.9 + offset[1], 2 + offset[2]}},
-			{Name: "body22", Position: []float64{0 + offset[0], 124.9 + offset[1], 3 + offset[2]}},
-			{Name: "body23", Position: []float64{1 + offset[0], 124.9 + offset[1], 3 + offset[2]}},
-			{Name: "body24", Position: []float64{2 + offset[0], 124.9 + offset[1], 3 + offset[2]}},
-		},
-		{
-			{Name: "leftbackleg1", Position: []float64{2 + offset[0], 123.7 + offset[1], 3 + offset[2]}},
-			{Name: "leftbackknee1", Position: []float64{2 + offset[0], 122.5 + offset[1], 3 + offset[2]}},
-			{Name: "leftbackleg2", Position: []float64{2 + offset[0], 121.3 + offset[1], 3 + offset[2]}},
-		},
-		{
-			{Name: "leftfrontleg1", Position: []float64{2 + offset[0], 123.7 + offset[1], 0 + offset[2]}},
-			{Name: "leftfrontknee1", Position: []float64{2 + offset[0], 122.5 + offset[1], 0 + offset[2]}},
-			{Name: "leftfrontleg2", Position: []float64{2 + offset[0], 121.3 + offset[1], 0 + offset[2]}},
-		},
-		{
-			{Name: "rightbackleg1", Position: []float64{0 + offset[0], 123.7 + offset[1], 3 + offset[2]}},
-			{Name: "rightbackknee1", Position: []float64{0 + offset[0], 122.5 + offset[1], 3 + offset[2]}},
-			{Name: "rightbackleg2", Position: []float64{0 + offset[0], 121.3 + offset[1], 3 + offset[2]}},
-		},
-		{
-			{Name: "rightfrontleg1", Position: []float64{0 + offset[0], 123.7 + offset[1], 0 + offset[2]}},
-			{Name: "rightfrontknee1", Position: []float64{0 + offset[0], 122.5 + offset[1], 0 + offset[2]}},
-			{Name: "rightfrontleg2", Position: []float64{0 + offset[0], 121.3 + offset[1], 0 + offset[2]}},
-		},
-		{
-			{Name: "tail1", Position: []float64{1 + offset[0], 127.2 + offset[1], 3 + offset[2]}},
-			{Name: "tail2", Position: []float64{1 + offset[0], 128.4 + offset[1], 3 + offset[2]}},
-			{Name: "tail3", Position: []float64{1 + offset[0], 129.6 + offset[1], 3 + offset[2]}},
-		},
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		runCommand(os.Args[1], os.Args[2:])
+		return
 	}
 
-	var wg sync.WaitGroup
-	for _, group := range cubeGroups {
-		for _, cube := range group {
-			wg.Add(1)
-			go spawnCube(cube, &wg)
-		}
+	dogCount := flag.Int("dogs", 1, "number of dogs to spawn side by side")
+	exportPath := flag.String("export", "", "write the spawned dogs to this .glb or .gltf file")
+	flag.Parse()
+
+	// Position offset for moving the whole structure; extra dogs are laid
+	// out on a grid next to the first one.
+	layout := GridLayout{Origin: []float64{40, -20, -3}, Columns: 4, Spacing: []float64{6, 8}}
+	dogs := []*Instance{newInstance("", layout.Offset(0))}
+	if *dogCount > 1 {
+		dogs = newInstances("dog", *dogCount, layout)
 	}
-	wg.Wait()
 
-	setMouthColorYellow()
+	session := newSession(serverAddr, authPass)
+	if err := session.enableManifest(defaultManifestDir); err != nil {
+		fmt.Println(err)
+	}
+	session.cleanupOnExit()
+	defer session.closeOnPanic()
+
+	if err := session.spawnInstances(dogCubes(), dogs); err != nil {
+		fmt.Println(err)
+	}
+
+	for _, dog := range dogs {
+		if err := session.colorSelection(dog, "tag:mouth", "yellow"); err != nil {
+			fmt.Println(err)
+		}
+	}
 
 	//linkCubes("head6_BASE", "leftmouth_BASE", "hinge", "jaw_joint_left")
 	//linkCubes("head7_BASE", "rightmouth_BASE", "hinge", "jaw_joint_right")
@@ -699,22 +722,22 @@ func main() {
 	*/
 	// Apply stiffening to all joints.
 	/*start := time.Now()
-	stiffenAllJoints()
+	session.stiffenAllJoints()
 	duration := time.Since(start) // End timer
 	fmt.Println("stiffenAllJoints Function took:", duration)
 
 	start = time.Now()
-	SingleTCPConnectionExamplestiffenAllJoints()
+	session.SingleTCPConnectionExamplestiffenAllJoints()
 	duration = time.Since(start) // End timer
 	fmt.Println("SingleTCPConnectionExamplestiffenAllJoints Function took:", duration)
 
 	start = time.Now()
-	SingleThreadedstiffenAllJoints()
+	session.SingleThreadedstiffenAllJoints()
 	duration = time.Since(start) // End timer
 	fmt.Println("SingleThreadedstiffenAllJoints Function took:", duration)*/
 
 	start := time.Now()
-	stiffenAllJointsBULK()
+	session.stiffenAllJointsBULK()
 	duration := time.Since(start) // End timer
 	fmt.Println("stiffenAllJointsBULK Function took:", duration)
 
@@ -727,31 +750,15 @@ func main() {
 		"motor_max_impulse":     1000.0,
 	}
 
-	// Call testLinkBodyCubes with prefix "body" and joint type "hinge".
-	testLinkBodyCubes("body", "hinge", jointParams)
+	for _, dog := range dogs {
+		// Call testLinkBodyCubes with prefix "body" and joint type "hinge".
+		session.testLinkBodyCubes(dog.Name("body"), "hinge", jointParams)
 
-	testLinkBodyCubes("head", "hinge", jointParams)
-
-	chains := [][]string{
-		{"leftbackleg1_BASE", "leftbackknee1_BASE", "leftbackleg2_BASE"},
-		{"rightbackleg1_BASE", "rightbackknee1_BASE", "rightbackleg2_BASE"},
-		{"leftfrontleg1_BASE", "leftfrontknee1_BASE", "leftfrontleg2_BASE"},
-		{"rightfrontleg1_BASE", "rightfrontknee1_BASE", "rightfrontleg2_BASE"},
-		{"tail1_BASE", "tail2_BASE", "tail3_BASE"},
-		{"body24_BASE", "leftbackleg1_BASE"},
-		{"body22_BASE", "rightbackleg1_BASE"},
-		{"body9_BASE", "leftfrontleg1_BASE"},
-		{"body7_BASE", "rightfrontleg1_BASE"},
-		{"body17_BASE", "tail3_BASE"},
-		{"head1_BASE", "rightear_BASE"},
-		{"head3_BASE", "leftear_BASE"},
-		{"head2_BASE", "leftmouth_BASE"},
-		{"head2_BASE", "rightmouth_BASE"},
-		{"head8_BASE", "neck_BASE", "body2_BASE"},
-	}
+		session.testLinkBodyCubes(dog.Name("head"), "hinge", jointParams)
 
-	if err := linkCubeChains(chains, "hinge", jointParams); err != nil {
-		fmt.Println("Error linking cube chains:", err)
+		if err := session.linkCubeChains(dog.Chains(dogChains()), "hinge", jointParams); err != nil {
+			fmt.Println("Error linking cube chains:", err)
+		}
 	}
 
 	/*groups := [][]string{
@@ -764,29 +771,42 @@ func main() {
 	//linkCubeGroups(groups, "hinge", jointParams)
 
 	fmt.Println("Spawned all cubes.")
-	unfreezeAllCubes()
+	if *exportPath != "" {
+		if err := writeGLTF(*exportPath, session.scene()); err != nil {
+			fmt.Println(err)
+		}
+	}
+	// Wake each dog from its body outward while the joint motors firm up,
+	// so a bad spawn freezes again instead of flying apart.
+	activation := ActivationOptions{
+		Ramps: []ParamRamp{{Param: "motor_max_impulse", From: 100, To: 1000}},
+	}
+	for _, dog := range dogs {
+		activation.Roots = append(activation.Roots, dog.Resolve("body2"))
+	}
+	if err := session.activate(session.scene(), activation); err != nil {
+		fmt.Println(err)
+	}
 
-	//rotateLegDemo("joint_hinge_leftbackknee1_BASE_leftbackleg2_BASE")
+	//session.rotateLegDemo("joint_hinge_leftbackknee1_BASE_leftbackleg2_BASE")
 
 	/*fmt.Println("➡️ Rotating leftbackleg2_BASE +90° Y")
-	rotateCube("leftbackleg2_BASE", []float64{0, 90, 0})
+	session.rotateCube("leftbackleg2_BASE", []float64{0, 90, 0})
 	time.Sleep(2 * time.Second)
 
 	fmt.Println("⬅️ Rotating leftbackleg2_BASE -90° Y")
-	rotateCube("leftbackleg2_BASE", []float64{0, -90, 0})*/
+	session.rotateCube("leftbackleg2_BASE", []float64{0, -90, 0})*/
 
 	// 🔎 Find joint for leftbackleg2_BASE and animate it
-	/*joint := findClosestJoint("leftbackleg2_BASE")
+	/*joint := session.findClosestJoint("leftbackleg2_BASE")
 	if joint != "" {
-		rotateLegDemo(joint)
+		session.rotateLegDemo(joint)
 
 		// Wait and try rotating on another axis by reversing again
 		time.Sleep(1 * time.Second)
 		fmt.Println("⏩ Rotating again in new direction...")
-		conn, _ := net.Dial("tcp", serverAddr)
+		conn, _ := session.connect()
 		defer conn.Close()
-		conn.Write([]byte(authPass + delimiter))
-		readResponse(conn)
 
 		setJointParam(conn, joint, "motor_target_velocity", 0.0)
 		setJointParam(conn, joint, "motor_enable", 1.0)
@@ -797,29 +817,42 @@ func main() {
 		setJointParam(conn, joint, "motor_target_velocity", 0.0)
 	}*/
 
-	/*rotateAllJointsForCube("leftbackleg1_BASE")
-	rotateAllJointsForCube("leftbackknee1_BASE")
-	rotateAllJointsForCube("leftbackleg2_BASE")*/
+	/*session.rotateAllJointsForCube("leftbackleg1_BASE")
+	session.rotateAllJointsForCube("leftbackknee1_BASE")
+	session.rotateAllJointsForCube("leftbackleg2_BASE")*/
 
-	//rotateCubeJoints("leftbackleg1_BASE", 2.5, 1*time.Second)
+	//session.rotateCubeJoints("leftbackleg1_BASE", 2.5, 1*time.Second)
 
+	// Wag every dog's tail together, five times with a rest in between.
+	wag := newTimelinePlayer(session)
+	wag.MaxImpulse = 500
+	for _, dog := range dogs {
+		tail, err := session.getJointsForCube(dog.Resolve("tail3"))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if err := wag.Add(swingTimeline(tail, -3.0, 800*time.Millisecond), nil); err != nil {
+			fmt.Println(err)
+		}
+	}
 	for i := 0; i < 5; i++ {
-		rotateCubeJoints("tail3_BASE", -3.0, 800*time.Millisecond)
+		if err := wag.Play(nil); err != nil {
+			fmt.Println(err)
+			break
+		}
 		time.Sleep(2 * time.Second)
 	}
 
 	fmt.Println("Waiting 3 seconds before despawning...")
 	time.Sleep(3 * time.Second)
 
-	despawnAllCubes()
+	session.close()
 	fmt.Println("Despawned all cubes.")
 }
 
-func findClosestJoint(targetCube string) string {
-	linkListMutex.Lock()
-	defer linkListMutex.Unlock()
-
-	for _, link := range globalCubeLinks {
+func (s *Session) findClosestJoint(targetCube string) string {
+	for _, link := range s.Links() {
 		if link.CubeA == targetCube || link.CubeB == targetCube {
 			fmt.Printf("🔍 Found joint: %s (%s <-> %s)\n", link.JointName, link.CubeA, link.CubeB)
 			return link.JointName
@@ -829,59 +862,32 @@ func findClosestJoint(targetCube string) string {
 	return ""
 }
 
-func rotateLegDemo(jointName string) {
-	conn, err := net.Dial("tcp", serverAddr)
-	if err != nil {
-		fmt.Printf("[rotateLegDemo] Failed to connect: %v\n", err)
-		return
-	}
-	defer conn.Close()
+func (s *Session) rotateLegDemo(jointName string) {
+	pc := newPoseController(s)
+	pc.MaxImpulse = 1000
 
-	if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-		fmt.Println("[rotateLegDemo] Auth write error:", err)
-		return
-	}
-	if _, err := readResponse(conn); err != nil {
-		fmt.Println("[rotateLegDemo] Auth response error:", err)
+	fmt.Println("↪️ Rotating forward...")
+	if err := pc.Transition(Pose{jointName: math.Pi / 2}, time.Second, easings["in-out"]); err != nil {
+		fmt.Println("[rotateLegDemo]", err)
 		return
 	}
 
-	// First 90-degree rotation (approx via velocity)
-	fmt.Println("↪️ Rotating forward...")
-	setJointParam(conn, jointName, "motor_enable", 1)
-	setJointParam(conn, jointName, "motor_target_velocity", 5.0) // adjust speed as needed
-	setJointParam(conn, jointName, "motor_max_impulse", 1000)
-
-	time.Sleep(1 * time.Second) // Let it move for a second
-
-	// Reverse direction
 	fmt.Println("↩️ Rotating back...")
-	setJointParam(conn, jointName, "motor_target_velocity", -5.0)
-
-	time.Sleep(1 * time.Second)
-
-	// Stop movement
-	setJointParam(conn, jointName, "motor_target_velocity", 0.0)
+	if err := pc.Transition(Pose{jointName: 0}, time.Second, easings["in-out"]); err != nil {
+		fmt.Println("[rotateLegDemo]", err)
+		return
+	}
 	fmt.Println("🛑 Leg motion complete.")
 }
 
-func rotateCube(cubeName string, rotationDelta []float64) {
-	conn, err := net.Dial("tcp", serverAddr)
+func (s *Session) rotateCube(cubeName string, rotationDelta []float64) {
+	conn, err := s.connect()
 	if err != nil {
-		fmt.Printf("[rotateCube] Failed to connect: %v\n", err)
+		fmt.Println("[rotateCube]", err)
 		return
 	}
 	defer conn.Close()
 
-	if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-		fmt.Println("[rotateCube] Auth write error:", err)
-		return
-	}
-	if _, err := readResponse(conn); err != nil {
-		fmt.Println("[rotateCube] Auth response error:", err)
-		return
-	}
-
 	cmd := Message{
 		"type":   "apply_force",
 		"rotate": rotationDelta, // in degrees
@@ -902,140 +908,304 @@ func rotateCube(cubeName string, rotationDelta []float64) {
 	fmt.Printf("[rotateCube] Server response: %s\n", resp)
 }
 
-func rotateAllJointsForCube(targetCube string) {
+func (s *Session) rotateAllJointsForCube(targetCube string) {
 	fmt.Printf("🐾 Brute-forcing all joints for cube: %s\n", targetCube)
 
-	for _, link := range globalCubeLinks {
+	for _, link := range s.Links() {
 		if link.CubeA == targetCube || link.CubeB == targetCube {
 			fmt.Printf("➡️ Rotating joint: %s (%s <-> %s)\n", link.JointName, link.CubeA, link.CubeB)
 
-			conn, err := net.Dial("tcp", serverAddr)
-			if err != nil {
-				fmt.Printf("[rotateAllJointsForCube] Failed to connect for joint %s: %v\n", link.JointName, err)
+			player := newTimelinePlayer(s)
+			player.MaxImpulse = 1000
+			player.Add(swingTimeline([]string{link.JointName}, 5.0, 500*time.Millisecond), nil)
+			if err := player.Play(nil); err != nil {
+				fmt.Printf("[rotateAllJointsForCube] Joint %s: %v\n", link.JointName, err)
 				continue
 			}
-
-			if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-				conn.Close()
-				continue
-			}
-			_, _ = readResponse(conn)
-
-			setJointParam(conn, link.JointName, "motor_enable", 1.0)
-			setJointParam(conn, link.JointName, "motor_target_velocity", 5.0)
-			setJointParam(conn, link.JointName, "motor_max_impulse", 1000.0)
-
-			time.Sleep(500 * time.Millisecond)
-
-			setJointParam(conn, link.JointName, "motor_target_velocity", -5.0)
-
-			time.Sleep(500 * time.Millisecond)
-
-			setJointParam(conn, link.JointName, "motor_target_velocity", 0.0)
-
-			conn.Close()
 			fmt.Printf("✅ Done rotating joint: %s\n", link.JointName)
 		}
 	}
 }
 
-func getJointsForCube(cubeName string) []string {
-	conn, err := net.Dial("tcp", serverAddr)
+func (s *Session) getJointsForCube(cubeName string) ([]string, error) {
+	conn, err := s.connect()
 	if err != nil {
-		fmt.Println("[getJointsForCube] Failed to connect:", err)
-		return nil
+		return nil, fmt.Errorf("[getJointsForCube] %v", err)
 	}
 	defer conn.Close()
 
-	// Authenticate
-	if _, err := conn.Write([]byte(authPass + delimiter)); err != nil {
-		fmt.Println("[getJointsForCube] Auth write error:", err)
-		return nil
-	}
-	if _, err := readResponse(conn); err != nil {
-		fmt.Println("[getJointsForCube] Auth response error:", err)
-		return nil
-	}
-
 	// Send command
 	cmd := Message{
 		"type":      "get_joints_for_cube",
 		"cube_name": cubeName,
 	}
 	if err := sendJSONMessage(conn, cmd); err != nil {
-		fmt.Println("[getJointsForCube] Failed to send command:", err)
-		return nil
+		return nil, fmt.Errorf("[getJointsForCube] Failed to send command: %v", err)
 	}
 
 	respRaw, err := readResponse(conn)
 	if err != nil {
-		fmt.Println("[getJointsForCube] Failed to read response:", err)
-		return nil
+		return nil, fmt.Errorf("[getJointsForCube] Failed to read response: %v", err)
 	}
 
 	var resp struct {
 		Type     string   `json:"type"`
+		Message  string   `json:"message"`
 		CubeName string   `json:"cube_name"`
 		Joints   []string `json:"joints"`
 	}
 	if err := json.Unmarshal([]byte(respRaw), &resp); err != nil {
-		fmt.Println("[getJointsForCube] JSON unmarshal failed:", err)
-		return nil
+		return nil, fmt.Errorf("[getJointsForCube] JSON unmarshal failed: %v", err)
+	}
+	if resp.Type == "error" {
+		return nil, fmt.Errorf("[getJointsForCube] %s: %s", cubeName, resp.Message)
 	}
 
-	return resp.Joints
+	return resp.Joints, nil
 }
 
-func rotateCubeJoints(cubeName string, velocity float64, duration time.Duration) {
-	joints := getJointsForCube(cubeName)
-	if len(joints) == 0 {
-		fmt.Printf("[rotateCubeJoints] No joints found for cube %s\n", cubeName)
-		return
+// despawnCube removes a single cube from the world and stops tracking it.
+func (s *Session) despawnCube(name string) error {
+	despawn := Message{
+		"type":      "despawn_cube",
+		"cube_name": name,
 	}
+	if err := s.send(despawn); err != nil {
+		return fmt.Errorf("[Despawn] %s: %v", name, err)
+	}
+	s.untrackCube(name)
+	return nil
+}
 
-	fmt.Printf("🦴 Found %d joints for %s. Applying rotation...\n", len(joints), cubeName)
+// despawnCubes removes many cubes over a single connection. Unlike
+// despawnCube it waits for the server to answer every command, so a cube
+// spawned again under the same name afterwards cannot race its despawn.
+func (s *Session) despawnCubes(names []string) error {
+	msgs := make([]Message, len(names))
+	for i, name := range names {
+		msgs[i] = Message{
+			"type":      "despawn_cube",
+			"cube_name": name,
+		}
+	}
+	replies, err := s.requestBatch(msgs)
+	refused := refusedReplies(replies)
+	var failed, despawned []string
+	for i := range replies {
+		if msg, bad := refused[i]; bad {
+			failed = append(failed, fmt.Sprintf("%s: %s", names[i], msg))
+			continue
+		}
+		despawned = append(despawned, names[i])
+	}
+	s.untrackCubes(despawned)
+	if err != nil {
+		return fmt.Errorf("[Despawn] %d of %d cubes unconfirmed: %v", len(names)-len(replies), len(names), err)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("[Despawn] Server refused %d cubes: %s", len(failed), strings.Join(failed, "; "))
+	}
+	return nil
+}
 
-	for _, joint := range joints {
-		go func(jn string) {
-			conn, err := net.Dial("tcp", serverAddr)
+// freezeCubes freezes or unfreezes the given cubes in one batch.
+func (s *Session) freezeCubes(names []string, freeze bool) error {
+	msgs := make([]Message, len(names))
+	for i, name := range names {
+		msgs[i] = Message{
+			"type":      "freeze_cube",
+			"cube_name": name,
+			"freeze":    freeze,
+		}
+	}
+	if err := s.sendBatch(msgs); err != nil {
+		return fmt.Errorf("[Freeze] Failed to send %d commands: %v", len(msgs), err)
+	}
+	return nil
+}
+
+// listCubes asks the server for the names of every cube in the world.
+func (s *Session) listCubes() ([]string, error) {
+	respRaw, err := s.request(Message{"type": "list_cubes"})
+	if err != nil {
+		return nil, fmt.Errorf("[listCubes] %v", err)
+	}
+
+	var resp struct {
+		Type  string   `json:"type"`
+		Cubes []string `json:"cubes"`
+	}
+	if err := json.Unmarshal([]byte(respRaw), &resp); err != nil {
+		return nil, fmt.Errorf("[listCubes] JSON unmarshal failed: %v", err)
+	}
+	return resp.Cubes, nil
+}
+
+// CubeState is a cube's live physics state as reported by get_cube_state.
+type CubeState struct {
+	Position        []float64 `json:"position"`
+	Rotation        []float64 `json:"rotation"` // degrees
+	LinearVelocity  []float64 `json:"linear_velocity"`
+	AngularVelocity []float64 `json:"angular_velocity"`
+}
+
+// getCubeStates asks the server for the state of each cube, one request
+// after the other over a single connection. Cubes the server does not know
+// are left out.
+func (s *Session) getCubeStates(names []string) (map[string]CubeState, error) {
+	conn, err := s.connect()
+	if err != nil {
+		return nil, fmt.Errorf("[getCubeStates] %v", err)
+	}
+	defer conn.Close()
+
+	states := make(map[string]CubeState, len(names))
+	for _, name := range names {
+		cmd := Message{
+			"type":      "get_cube_state",
+			"cube_name": name,
+		}
+		if err := sendJSONMessage(conn, cmd); err != nil {
+			return nil, fmt.Errorf("[getCubeStates] Failed to send command: %v", err)
+		}
+		respRaw, err := readResponse(conn)
+		if err != nil {
+			return nil, fmt.Errorf("[getCubeStates] Failed to read response for %s: %v", name, err)
+		}
+		var resp struct {
+			Type string `json:"type"`
+			CubeState
+		}
+		if err := json.Unmarshal([]byte(respRaw), &resp); err != nil {
+			return nil, fmt.Errorf("[getCubeStates] JSON unmarshal failed: %v", err)
+		}
+		if resp.Type == "error" || len(resp.Position) != 3 {
+			continue
+		}
+		states[name] = resp.CubeState
+	}
+	return states, nil
+}
+
+// maxJointQueries caps how many get_joints_for_cube connections
+// jointsForCubes keeps open at once.
+const maxJointQueries = 8
+
+// jointsForCubes asks the server which joints are attached to each cube and
+// returns, per joint, the cubes reporting it. If any cube could not be asked
+// the map is incomplete and an error says how many failed.
+func (s *Session) jointsForCubes(names []string) (map[string][]string, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, maxJointQueries)
+	joints := make(map[string][]string)
+	var errs []error
+	for _, name := range names {
+		wg.Add(1)
+		go func(cube string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			found, err := s.getJointsForCube(cube)
+			<-slots
+			mu.Lock()
+			defer mu.Unlock()
 			if err != nil {
-				fmt.Printf("[rotateCubeJoints] Connect failed: %v\n", err)
+				errs = append(errs, err)
 				return
 			}
-			defer conn.Close()
+			for _, joint := range found {
+				joints[joint] = append(joints[joint], cube)
+			}
+		}(name)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return joints, fmt.Errorf("[jointsForCubes] %d of %d cubes could not be queried; first: %v", len(errs), len(names), errs[0])
+	}
+	return joints, nil
+}
 
-			// Authenticate
-			conn.Write([]byte(authPass + delimiter))
-			readResponse(conn)
-
-			// Enable motor
-			params := Message{
-				"type":       "set_joint_params",
-				"joint_name": jn,
-				"params": map[string]float64{
-					"motor_enable":          1.0,
-					"motor_target_velocity": velocity,
-					"motor_max_impulse":     500.0,
-				},
+// refreshJoints rebuilds the session's joint table from what the server
+// reports for the tracked cubes. Joints the server no longer has are dropped
+// and ones it has but the session missed are added; joints already known
+// keep their recorded cubes and type. Added joints are of unknown kind. If
+// any cube could not be queried the table is left as it was, rather than
+// dropping the joints of the cubes that went unanswered.
+func (s *Session) refreshJoints() {
+	names := s.CubeNames()
+	if len(names) == 0 {
+		return
+	}
+	observed, err := s.jointsForCubes(names)
+	if err != nil {
+		fmt.Println("[refreshJoints] Joint table left unchanged:", err)
+		return
+	}
+
+	known := make(map[string]CubeLink)
+	for _, link := range s.Links() {
+		known[link.JointName] = link
+	}
+	jointNames := make([]string, 0, len(observed))
+	for name := range observed {
+		jointNames = append(jointNames, name)
+	}
+	sort.Strings(jointNames)
+
+	links := make([]CubeLink, 0, len(jointNames))
+	added := 0
+	for _, name := range jointNames {
+		link, ok := known[name]
+		if !ok {
+			cubes := observed[name]
+			sort.Strings(cubes)
+			link = CubeLink{JointName: name, CubeA: cubes[0], Type: JointUnknown}
+			if len(cubes) > 1 {
+				link.CubeB = cubes[1]
 			}
-			sendJSONMessage(conn, params)
-			readResponse(conn) // optional
+			added++
+		}
+		links = append(links, link)
+	}
+	s.replaceLinks(links)
+	fmt.Printf("[refreshJoints] %d joints on the server: %d added, %d dropped\n",
+		len(links), added, len(known)-(len(links)-added))
+}
 
-			// Reverse after delay
-			time.Sleep(duration)
+func (s *Session) rotateCubeJoints(cubeName string, velocity float64, duration time.Duration) {
+	joints, err := s.getJointsForCube(cubeName)
+	if err != nil {
+		fmt.Println("[rotateCubeJoints]", err)
+		return
+	}
+	if len(joints) == 0 {
+		fmt.Printf("[rotateCubeJoints] No joints found for cube %s\n", cubeName)
+		return
+	}
 
-			// Reverse
-			params["params"].(map[string]float64)["motor_target_velocity"] = -velocity
-			sendJSONMessage(conn, params)
-			readResponse(conn)
+	fmt.Printf("🦴 Found %d joints for %s. Applying rotation...\n", len(joints), cubeName)
 
-			// Stop after another duration
-			time.Sleep(duration)
-			params["params"].(map[string]float64)["motor_target_velocity"] = 0.0
-			sendJSONMessage(conn, params)
-			readResponse(conn)
+	player := newTimelinePlayer(s)
+	player.MaxImpulse = 500
+	player.Add(swingTimeline(joints, velocity, duration), nil)
+	if err := player.Play(nil); err != nil {
+		fmt.Printf("[rotateCubeJoints] %v\n", err)
+		return
+	}
+	fmt.Printf("↩️ Completed joint cycle for: %s\n", cubeName)
+}
 
-			fmt.Printf("↩️ Completed joint cycle for: %s\n", jn)
-		}(joint)
+// swingTimeline turns joints at velocity for d, back as fast for d, then
+// stops them.
+func swingTimeline(joints []string, velocity float64, d time.Duration) *Timeline {
+	back, still := -velocity, 0.0
+	tl := &Timeline{Tracks: make(map[string][]Keyframe, len(joints))}
+	for _, joint := range joints {
+		tl.Tracks[joint] = []Keyframe{
+			{T: 0, Velocity: &velocity},
+			{T: d.Seconds(), Velocity: &back, Interp: "step"},
+			{T: 2 * d.Seconds(), Velocity: &still, Interp: "step"},
+		}
 	}
+	return tl
 }
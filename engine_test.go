@@ -0,0 +1,84 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseJointReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    string
+		want    []CubeLink
+		wantErr string
+	}{
+		{
+			name: "create_joint",
+			resp: `{"type":"joint_created","joint_name":"j1","cube1":"a_BASE","cube2":"b_BASE"}`,
+			want: []CubeLink{{JointName: "j1", CubeA: "a_BASE", CubeB: "b_BASE"}},
+		},
+		{
+			name: "chain",
+			resp: `{"type":"chain_created","joints":[{"joint_name":"j1","cube1":"a","cube2":"b"},{"joint_name":"j2","cube1":"b","cube2":"c"}]}`,
+			want: []CubeLink{{JointName: "j1", CubeA: "a", CubeB: "b"}, {JointName: "j2", CubeA: "b", CubeB: "c"}},
+		},
+		{
+			name: "both",
+			resp: `{"joint_name":"j0","cube1":"x","cube2":"y","joints":[{"joint_name":"j1","cube1":"a","cube2":"b"}]}`,
+			want: []CubeLink{{JointName: "j0", CubeA: "x", CubeB: "y"}, {JointName: "j1", CubeA: "a", CubeB: "b"}},
+		},
+		{name: "names none", resp: `{"type":"ok"}`},
+		{name: "refused", resp: `{"type":"error","message":"cube a missing"}`, wantErr: "server refused: cube a missing"},
+		{name: "unreadable", resp: `joint made`, wantErr: `unreadable reply "joint made"`},
+		{name: "empty", resp: ``, wantErr: "unreadable reply"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJointReply(tt.resp)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("links = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateJointsTracksServerNames(t *testing.T) {
+	startFakeServer(t, func(msg Message) Message {
+		switch msg["joint_name"] {
+		case "renamed":
+			return Message{"type": "joint_created", "joint_name": "joint_7", "cube1": msg["cube1"], "cube2": msg["cube2"]}
+		case "refused":
+			return Message{"type": "error", "message": "no such cube"}
+		}
+		return Message{"type": "joint_created"}
+	})
+	s := newSession("pipe", "pw")
+	err := s.createJoints([]JointDef{
+		{Name: "kept", CubeA: "a_BASE", CubeB: "b_BASE", Type: JointHinge},
+		{Name: "renamed", CubeA: "b_BASE", CubeB: "c_BASE", Type: JointFixed},
+		{Name: "refused", CubeA: "c_BASE", CubeB: "d_BASE", Type: JointFixed},
+	})
+	if err == nil || !strings.Contains(err.Error(), "refused: server refused: no such cube") {
+		t.Errorf("err = %v, want the refused joint", err)
+	}
+	want := []CubeLink{
+		{JointName: "kept", CubeA: "a_BASE", CubeB: "b_BASE", Type: JointHinge},
+		{JointName: "joint_7", CubeA: "b_BASE", CubeB: "c_BASE", Type: JointFixed},
+	}
+	if got := s.Links(); !slices.Equal(got, want) {
+		t.Errorf("tracked %+v, want %+v", got, want)
+	}
+	if got := s.trackedJointName(JointDef{Name: "renamed", CubeA: "c_BASE", CubeB: "b_BASE"}); got != "joint_7" {
+		t.Errorf("trackedJointName = %q, want the server's name", got)
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Scene is a set of cubes and the joints between them, with server names,
+// ready to be exported.
+type Scene struct {
+	Cubes  []Cube
+	Joints []JointDef
+}
+
+// scene places the creature's definition in the world, as apply would spawn
+// it.
+func (c *Creature) scene() Scene {
+	inst := c.instance()
+	var scene Scene
+	for _, cube := range inst.Cubes(c.Cubes) {
+		cube.Name = serverCubeName(cube.Name)
+		scene.Cubes = append(scene.Cubes, cube)
+	}
+	for _, joint := range c.Joints {
+		scene.Joints = append(scene.Joints, c.placedJoint(inst, joint))
+	}
+	return scene
+}
+
+// scene returns what the session has spawned, as it was spawned.
+func (s *Session) scene() Scene {
+	scene := Scene{Cubes: s.Cubes()}
+	for _, link := range s.Links() {
+		scene.Joints = append(scene.Joints, JointDef{Name: link.JointName, CubeA: link.CubeA, CubeB: link.CubeB, Type: link.Type})
+	}
+	return scene
+}
+
+// liveScene snapshots the world as the server currently has it. Positions
+// and rotations come from get_cube_state and joints from get_joints_for_cube.
+// The server cannot report colors, sizes or joint details, so those are taken
+// from base wherever a cube or joint name matches. With only set, just the
+// cubes in base are snapshotted; otherwise the whole world is.
+func (s *Session) liveScene(base Scene, only bool) (Scene, error) {
+	known := make(map[string]Cube, len(base.Cubes))
+	for _, cube := range base.Cubes {
+		known[cube.Name] = cube
+	}
+	knownJoints := make(map[string]JointDef, len(base.Joints))
+	for _, joint := range base.Joints {
+		knownJoints[joint.Name] = joint
+	}
+
+	names, err := s.listCubes()
+	if err != nil {
+		return Scene{}, err
+	}
+	if only {
+		names = slices.DeleteFunc(names, func(name string) bool {
+			_, ok := known[name]
+			return !ok
+		})
+	}
+	states, err := s.getCubeStates(names)
+	if err != nil {
+		return Scene{}, err
+	}
+
+	var scene Scene
+	for _, name := range names {
+		state, ok := states[name]
+		if !ok {
+			continue
+		}
+		cube := known[name]
+		cube.Name = name
+		cube.Position = state.Position
+		cube.Rotation = state.Rotation
+		scene.Cubes = append(scene.Cubes, cube)
+	}
+
+	observed, err := s.jointsForCubes(names)
+	if err != nil {
+		return Scene{}, err
+	}
+	jointNames := make([]string, 0, len(observed))
+	for name := range observed {
+		jointNames = append(jointNames, name)
+	}
+	sort.Strings(jointNames)
+	for _, name := range jointNames {
+		joint, ok := knownJoints[name]
+		if !ok {
+			cubes := observed[name]
+			sort.Strings(cubes)
+			joint = JointDef{Name: name, CubeA: cubes[0]}
+			if len(cubes) > 1 {
+				joint.CubeB = cubes[1]
+			}
+		}
+		scene.Joints = append(scene.Joints, joint)
+	}
+	return scene, nil
+}
+
+// writeGLTF exports a scene as glTF 2.0: a binary .glb, or a .gltf with the
+// geometry embedded as a data URI. Every cube is a node instancing one shared
+// unit cube mesh per color, scaled by its size. Joints are empty nodes at
+// their anchor, or the midpoint of their cubes, carrying the joint's type,
+// cubes, params and axis in extras, so viewers show them in the outline
+// without drawing anything.
+func writeGLTF(path string, scene Scene) error {
+	doc, bin := encodeGLTF(scene)
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".glb") {
+		data, err = glbContainer(doc, bin)
+	} else {
+		doc.Buffers[0].URI = "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(bin)
+		data, err = json.MarshalIndent(doc, "", "  ")
+	}
+	if err != nil {
+		return fmt.Errorf("[Export] %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("[Export] Failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+type gltfDoc struct {
+	Asset       map[string]string `json:"asset"`
+	Scene       int               `json:"scene"`
+	Scenes      []gltfScene       `json:"scenes"`
+	Nodes       []gltfNode        `json:"nodes,omitempty"`
+	Meshes      []gltfMesh        `json:"meshes,omitempty"`
+	Materials   []gltfMaterial    `json:"materials,omitempty"`
+	Accessors   []gltfAccessor    `json:"accessors"`
+	BufferViews []gltfBufferView  `json:"bufferViews"`
+	Buffers     []gltfBuffer      `json:"buffers"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes,omitempty"`
+}
+
+type gltfNode struct {
+	Name        string         `json:"name,omitempty"`
+	Mesh        *int           `json:"mesh,omitempty"`
+	Children    []int          `json:"children,omitempty"`
+	Translation []float64      `json:"translation,omitempty"`
+	Rotation    []float64      `json:"rotation,omitempty"`
+	Scale       []float64      `json:"scale,omitempty"`
+	Extras      map[string]any `json:"extras,omitempty"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name"`
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    int            `json:"indices"`
+	Material   int            `json:"material"`
+}
+
+type gltfMaterial struct {
+	Name string `json:"name"`
+	PBR  struct {
+		BaseColorFactor []float64 `json:"baseColorFactor"`
+		MetallicFactor  float64   `json:"metallicFactor"`
+		RoughnessFactor float64   `json:"roughnessFactor"`
+	} `json:"pbrMetallicRoughness"`
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float64 `json:"min,omitempty"`
+	Max           []float64 `json:"max,omitempty"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target"`
+}
+
+type gltfBuffer struct {
+	ByteLength int    `json:"byteLength"`
+	URI        string `json:"uri,omitempty"`
+}
+
+const (
+	gltfFloat         = 5126
+	gltfUnsignedShort = 5123
+	gltfArrayBuffer   = 34962
+	gltfElementBuffer = 34963
+)
+
+// unitCubeGeometry returns the 24 vertices (four per face, so each face gets
+// its own normal) and 36 indices of a cube with edge 1 centered on the origin.
+func unitCubeGeometry() (positions, normals [][3]float32, indices []uint16) {
+	for axis := 0; axis < 3; axis++ {
+		for _, sign := range []float32{1, -1} {
+			u, v := (axis+1)%3, (axis+2)%3
+			if sign < 0 {
+				u, v = v, u // keep the winding counter-clockwise from outside
+			}
+			base := uint16(len(positions))
+			for _, corner := range [][2]float32{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}} {
+				var p, n [3]float32
+				p[axis], n[axis] = sign/2, sign
+				p[u], p[v] = corner[0]/2, corner[1]/2
+				positions = append(positions, p)
+				normals = append(normals, n)
+			}
+			indices = append(indices, base, base+1, base+2, base, base+2, base+3)
+		}
+	}
+	return positions, normals, indices
+}
+
+// encodeGLTF builds the glTF document and its binary buffer.
+func encodeGLTF(scene Scene) (*gltfDoc, []byte) {
+	doc := &gltfDoc{Asset: map[string]string{"version": "2.0", "generator": "pixel export"}}
+
+	positions, normals, indices := unitCubeGeometry()
+	var bin bytes.Buffer
+	binary.Write(&bin, binary.LittleEndian, positions)
+	binary.Write(&bin, binary.LittleEndian, normals)
+	binary.Write(&bin, binary.LittleEndian, indices)
+	for bin.Len()%4 != 0 {
+		bin.WriteByte(0)
+	}
+	vertexBytes := len(positions) * 12
+	doc.BufferViews = []gltfBufferView{
+		{Buffer: 0, ByteOffset: 0, ByteLength: vertexBytes, Target: gltfArrayBuffer},
+		{Buffer: 0, ByteOffset: vertexBytes, ByteLength: vertexBytes, Target: gltfArrayBuffer},
+		{Buffer: 0, ByteOffset: 2 * vertexBytes, ByteLength: len(indices) * 2, Target: gltfElementBuffer},
+	}
+	doc.Accessors = []gltfAccessor{
+		{BufferView: 0, ComponentType: gltfFloat, Count: len(positions), Type: "VEC3",
+			Min: []float64{-0.5, -0.5, -0.5}, Max: []float64{0.5, 0.5, 0.5}},
+		{BufferView: 1, ComponentType: gltfFloat, Count: len(normals), Type: "VEC3"},
+		{BufferView: 2, ComponentType: gltfUnsignedShort, Count: len(indices), Type: "SCALAR"},
+	}
+	doc.Buffers = []gltfBuffer{{ByteLength: bin.Len()}}
+
+	// One material and mesh per color.
+	meshFor := make(map[string]int)
+	mesh := func(color string) int {
+		if color == "" {
+			color = defaultPalette["gray"]
+		}
+		color = strings.ToUpper(color)
+		if i, ok := meshFor[color]; ok {
+			return i
+		}
+		rgb, err := parseHex(color)
+		if err != nil {
+			rgb = [3]uint8{0x80, 0x80, 0x80}
+		}
+		m := gltfMaterial{Name: color}
+		m.PBR.BaseColorFactor = []float64{srgbToLinear(rgb[0]), srgbToLinear(rgb[1]), srgbToLinear(rgb[2]), 1}
+		m.PBR.RoughnessFactor = 1
+		doc.Materials = append(doc.Materials, m)
+		doc.Meshes = append(doc.Meshes, gltfMesh{
+			Name: "cube " + color,
+			Primitives: []gltfPrimitive{{
+				Attributes: map[string]int{"POSITION": 0, "NORMAL": 1},
+				Indices:    2,
+				Material:   len(doc.Materials) - 1,
+			}},
+		})
+		meshFor[color] = len(doc.Meshes) - 1
+		return meshFor[color]
+	}
+
+	cubesNode := gltfNode{Name: "cubes"}
+	positionOf := make(map[string][]float64, len(scene.Cubes))
+	for _, cube := range scene.Cubes {
+		m := mesh(cube.Color)
+		node := gltfNode{
+			Name:        cube.Name,
+			Mesh:        &m,
+			Translation: cube.Position,
+			Rotation:    eulerQuaternion(cube.Rotation),
+			Scale:       cube.Size,
+		}
+		extras := map[string]any{}
+		if cube.Group != "" {
+			extras["group"] = cube.Group
+		}
+		if len(cube.Tags) > 0 {
+			extras["tags"] = cube.Tags
+		}
+		if cube.Mass > 0 {
+			extras["mass"] = cube.Mass
+		}
+		if len(extras) > 0 {
+			node.Extras = extras
+		}
+		positionOf[cube.Name] = cube.Position
+		cubesNode.Children = append(cubesNode.Children, len(doc.Nodes))
+		doc.Nodes = append(doc.Nodes, node)
+	}
+
+	jointsNode := gltfNode{Name: "joints"}
+	for _, joint := range scene.Joints {
+		extras := map[string]any{"cube_a": joint.CubeA, "cube_b": joint.CubeB}
+		if joint.Type != "" {
+			extras["joint_type"] = joint.Type
+		}
+		if len(joint.Params) > 0 {
+			extras["params"] = joint.Params
+		}
+		if len(joint.Axis) == 3 {
+			extras["axis"] = joint.Axis
+		}
+		node := gltfNode{Name: joint.Name, Extras: extras}
+		if len(joint.Anchor) == 3 && !joint.Local {
+			node.Translation = joint.Anchor
+		} else if a, b := positionOf[joint.CubeA], positionOf[joint.CubeB]; len(a) == 3 && len(b) == 3 {
+			node.Translation = []float64{(a[0] + b[0]) / 2, (a[1] + b[1]) / 2, (a[2] + b[2]) / 2}
+		}
+		jointsNode.Children = append(jointsNode.Children, len(doc.Nodes))
+		doc.Nodes = append(doc.Nodes, node)
+	}
+
+	var root []int
+	for _, group := range []gltfNode{cubesNode, jointsNode} {
+		if len(group.Children) > 0 {
+			root = append(root, len(doc.Nodes))
+			doc.Nodes = append(doc.Nodes, group)
+		}
+	}
+	doc.Scenes = []gltfScene{{Nodes: root}}
+	return doc, bin.Bytes()
+}
+
+// glbContainer packs the document and buffer into a binary glTF file.
+func glbContainer(doc *gltfDoc, bin []byte) ([]byte, error) {
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	for len(js)%4 != 0 {
+		js = append(js, ' ')
+	}
+	var out bytes.Buffer
+	binary.Write(&out, binary.LittleEndian, []uint32{0x46546C67, 2, uint32(12 + 8 + len(js) + 8 + len(bin))})
+	binary.Write(&out, binary.LittleEndian, []uint32{uint32(len(js)), 0x4E4F534A}) // "JSON"
+	out.Write(js)
+	binary.Write(&out, binary.LittleEndian, []uint32{uint32(len(bin)), 0x004E4942}) // "BIN\0"
+	out.Write(bin)
+	return out.Bytes(), nil
+}
+
+// srgbToLinear converts an 8-bit sRGB channel to the linear values glTF
+// material colors use.
+func srgbToLinear(c uint8) float64 {
+	v := float64(c) / 255
+	if v <= 0.04045 {
+		v /= 12.92
+	} else {
+		v = math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return math.Round(v*1e4) / 1e4
+}
+
+// eulerQuaternion converts a rotation in degrees about X, then Y, then Z (as
+// spawn_cube takes it) to a glTF [x, y, z, w] quaternion. No rotation yields
+// nil so the node keeps the default.
+func eulerQuaternion(deg []float64) []float64 {
+	if len(deg) != 3 || (deg[0] == 0 && deg[1] == 0 && deg[2] == 0) {
+		return nil
+	}
+	half := func(d float64) (float64, float64) { return math.Sincos(d * math.Pi / 360) }
+	sr, cr := half(deg[0])
+	sp, cp := half(deg[1])
+	sy, cy := half(deg[2])
+	return []float64{
+		sr*cp*cy - cr*sp*sy,
+		cr*sp*cy + sr*cp*sy,
+		cr*cp*sy - sr*sp*cy,
+		cr*cp*cy + sr*sp*sy,
+	}
+}
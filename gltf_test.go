@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testScene() Scene {
+	return Scene{
+		Cubes: []Cube{
+			{Name: "a_BASE", Position: []float64{0, 0, 0}, Color: "#ff0000", Group: "body"},
+			{Name: "b_BASE", Position: []float64{2, 0, 0}, Color: "#FF0000", Size: []float64{1, 2, 1}},
+			{Name: "c_BASE", Position: []float64{0, 4, 0}},
+		},
+		Joints: []JointDef{
+			{Name: "ab", CubeA: "a_BASE", CubeB: "b_BASE", Type: JointHinge},
+			{Name: "ac", CubeA: "a_BASE", CubeB: "c_BASE", Type: JointFixed, JointFrame: JointFrame{Anchor: []float64{0, 1, 0}}},
+		},
+	}
+}
+
+func TestGLBContainer(t *testing.T) {
+	doc, bin := encodeGLTF(testScene())
+	glb, err := glbContainer(doc, bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Header: magic, version 2, total length.
+	if !bytes.Equal(glb[:8], []byte("glTF\x02\x00\x00\x00")) {
+		t.Errorf("header = % x", glb[:8])
+	}
+	if n := binary.LittleEndian.Uint32(glb[8:]); int(n) != len(glb) {
+		t.Errorf("length field = %d, file is %d bytes", n, len(glb))
+	}
+
+	// The JSON chunk, padded with spaces to a 4-byte boundary.
+	jsonLen := int(binary.LittleEndian.Uint32(glb[12:]))
+	if string(glb[16:20]) != "JSON" {
+		t.Errorf("first chunk type = %q", glb[16:20])
+	}
+	if jsonLen%4 != 0 {
+		t.Errorf("JSON chunk is %d bytes, not 4-byte aligned", jsonLen)
+	}
+	js := glb[20 : 20+jsonLen]
+	var parsed gltfDoc
+	if err := json.Unmarshal(bytes.TrimRight(js, " "), &parsed); err != nil {
+		t.Fatalf("JSON chunk: %v", err)
+	}
+
+	// The binary chunk starts aligned and runs to the end of the file.
+	off := 20 + jsonLen
+	binLen := int(binary.LittleEndian.Uint32(glb[off:]))
+	if !bytes.Equal(glb[off+4:off+8], []byte("BIN\x00")) {
+		t.Errorf("second chunk type = %q", glb[off+4:off+8])
+	}
+	if off%4 != 0 || binLen%4 != 0 || off+8+binLen != len(glb) {
+		t.Errorf("BIN chunk of %d bytes at %d in a %d byte file", binLen, off, len(glb))
+	}
+	// 24 positions and normals of 3 floats, 36 two-byte indices.
+	if binLen != 24*12*2+36*2 || parsed.Buffers[0].ByteLength != binLen {
+		t.Errorf("BIN chunk is %d bytes, buffer declares %d", binLen, parsed.Buffers[0].ByteLength)
+	}
+	for _, view := range parsed.BufferViews {
+		if view.ByteOffset%4 != 0 || view.ByteOffset+view.ByteLength > binLen {
+			t.Errorf("buffer view %+v is misaligned or out of range", view)
+		}
+	}
+}
+
+func TestEncodeGLTF(t *testing.T) {
+	doc, _ := encodeGLTF(testScene())
+
+	// The two reds share a mesh; the uncolored cube is gray.
+	var meshes []string
+	for _, m := range doc.Meshes {
+		meshes = append(meshes, m.Name)
+	}
+	if want := []string{"cube #FF0000", "cube #808080"}; !slices.Equal(meshes, want) {
+		t.Errorf("meshes = %v, want %v", meshes, want)
+	}
+
+	byName := make(map[string]gltfNode)
+	for _, n := range doc.Nodes {
+		byName[n.Name] = n
+	}
+	if b := byName["b_BASE"]; *b.Mesh != 0 || !slices.Equal(b.Scale, []float64{1, 2, 1}) {
+		t.Errorf("b = %+v", b)
+	}
+	if a := byName["a_BASE"]; a.Extras["group"] != "body" {
+		t.Errorf("a extras = %v", a.Extras)
+	}
+	// A joint without an anchor sits between its cubes.
+	if ab := byName["ab"]; !slices.Equal(ab.Translation, []float64{1, 0, 0}) || ab.Extras["joint_type"] != JointHinge {
+		t.Errorf("ab = %+v", ab)
+	}
+	if ac := byName["ac"]; !slices.Equal(ac.Translation, []float64{0, 1, 0}) {
+		t.Errorf("ac = %+v", ac)
+	}
+	root := doc.Scenes[0].Nodes
+	if len(root) != 2 || doc.Nodes[root[0]].Name != "cubes" || len(doc.Nodes[root[1]].Children) != 2 {
+		t.Errorf("scene root = %v", root)
+	}
+}
+
+func TestWriteGLTF(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scene.gltf")
+	if err := writeGLTF(path, testScene()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc gltfDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	uri, ok := strings.CutPrefix(doc.Buffers[0].URI, "data:application/octet-stream;base64,")
+	if !ok {
+		t.Fatalf("buffer URI = %.40q", doc.Buffers[0].URI)
+	}
+	bin, err := base64.StdEncoding.DecodeString(uri)
+	if err != nil || len(bin) != doc.Buffers[0].ByteLength {
+		t.Errorf("embedded buffer is %d bytes (%v), want %d", len(bin), err, doc.Buffers[0].ByteLength)
+	}
+
+	glb := filepath.Join(dir, "scene.GLB")
+	if err := writeGLTF(glb, testScene()); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(glb); !bytes.HasPrefix(data, []byte("glTF")) {
+		t.Errorf(".GLB was not written as binary glTF")
+	}
+}
+
+func TestEulerQuaternion(t *testing.T) {
+	h := math.Sqrt(0.5)
+	tests := []struct {
+		deg  []float64
+		want []float64
+	}{
+		{nil, nil},
+		{[]float64{0, 0, 0}, nil},
+		{[]float64{90, 0, 0}, []float64{h, 0, 0, h}},
+		{[]float64{0, 0, 90}, []float64{0, 0, h, h}},
+		{[]float64{0, 180, 0}, []float64{0, 1, 0, 0}},
+	}
+	for _, tt := range tests {
+		got := eulerQuaternion(tt.deg)
+		if len(got) != len(tt.want) {
+			t.Errorf("eulerQuaternion(%v) = %v, want %v", tt.deg, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+				t.Errorf("eulerQuaternion(%v) = %v, want %v", tt.deg, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSRGBToLinear(t *testing.T) {
+	for c, want := range map[uint8]float64{0: 0, 10: 0.003, 128: 0.2159, 255: 1} {
+		if got := srgbToLinear(c); got != want {
+			t.Errorf("srgbToLinear(%d) = %v, want %v", c, got, want)
+		}
+	}
+}
@@ -1,4 +1,4 @@
-module main
+module github.com/OpenFluke/pixel
 
 go 1.24.0
 
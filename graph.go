@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// graphGroupColors are the fill colors handed out to cube groups, in order of
+// group name. Ungrouped cubes stay white.
+var graphGroupColors = []string{
+	"#AEC7E8", "#FFBB78", "#98DF8A", "#FF9896", "#C5B0D5",
+	"#C49C94", "#F7B6D2", "#DBDB8D", "#9EDAE5", "#C7C7C7",
+}
+
+// graphLayout is a scene prepared for drawing: cubes grouped and given stable
+// node ids, groups given colors.
+type graphLayout struct {
+	groups []string            // sorted, "" (ungrouped) last
+	cubes  map[string][]string // group -> cube names
+	ids    map[string]string   // cube name -> node id
+	colors map[string]string   // group -> fill color
+	joints []JointDef
+}
+
+func newGraphLayout(scene Scene) *graphLayout {
+	g := &graphLayout{
+		cubes:  make(map[string][]string),
+		ids:    make(map[string]string),
+		colors: make(map[string]string),
+	}
+	addCube := func(name, group string) {
+		if _, ok := g.ids[name]; ok {
+			return
+		}
+		g.ids[name] = "c" + strconv.Itoa(len(g.ids))
+		if _, ok := g.cubes[group]; !ok {
+			g.groups = append(g.groups, group)
+		}
+		g.cubes[group] = append(g.cubes[group], name)
+	}
+	for _, cube := range scene.Cubes {
+		addCube(cube.Name, cube.Group)
+	}
+	// Joints may reference cubes the scene does not describe, such as
+	// cubes from another creature.
+	for _, joint := range scene.Joints {
+		for _, name := range []string{joint.CubeA, joint.CubeB} {
+			if name != "" {
+				addCube(name, "")
+			}
+		}
+		if joint.CubeA != "" && joint.CubeB != "" {
+			g.joints = append(g.joints, joint)
+		}
+	}
+
+	sort.Slice(g.groups, func(i, j int) bool {
+		a, b := g.groups[i], g.groups[j]
+		if (a == "") != (b == "") {
+			return b == ""
+		}
+		return a < b
+	})
+	for i, group := range g.groups {
+		if group == "" {
+			g.colors[group] = "#FFFFFF"
+		} else {
+			g.colors[group] = graphGroupColors[i%len(graphGroupColors)]
+		}
+	}
+	return g
+}
+
+// nodeLabel shows a cube by the name it was spawned with.
+func nodeLabel(name string) string {
+	return strings.TrimSuffix(name, baseSuffix)
+}
+
+// jointLabel describes a joint by its type and the params that matter when
+// reading the graph: its limits and how hard its motor may push.
+func jointLabel(joint JointDef) string {
+	label := string(joint.Type)
+	if label == "" {
+		label = "joint"
+	}
+	lo, hasLo := joint.Params["limit_lower"]
+	hi, hasHi := joint.Params["limit_upper"]
+	if hasLo || hasHi {
+		label += fmt.Sprintf(" [%g, %g]", lo, hi)
+	}
+	if impulse, ok := joint.Params["motor_max_impulse"]; ok && joint.Params["motor_enable"] != 0 {
+		label += fmt.Sprintf(" motor %g", impulse)
+	}
+	return label
+}
+
+// writeGraph writes the cube/joint graph of a scene as "dot" or "mermaid".
+func writeGraph(w io.Writer, scene Scene, format string) error {
+	switch format {
+	case "dot":
+		return writeDOT(w, scene)
+	case "mermaid":
+		return writeMermaid(w, scene)
+	}
+	return fmt.Errorf("[Graph] Unknown format %q, want dot or mermaid", format)
+}
+
+// writeDOT writes the scene as a Graphviz graph: one cluster per cube group,
+// filled with the group's color, and one labeled edge per joint.
+func writeDOT(w io.Writer, scene Scene) error {
+	g := newGraphLayout(scene)
+	var b strings.Builder
+	b.WriteString("graph cubes {\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=Helvetica];\n")
+	b.WriteString("  edge [fontname=Helvetica, fontsize=10];\n")
+	for i, group := range g.groups {
+		indent := "  "
+		if group != "" {
+			fmt.Fprintf(&b, "  subgraph cluster_%d {\n    label=%s;\n", i, strconv.Quote(group))
+			indent = "    "
+		}
+		for _, name := range g.cubes[group] {
+			fmt.Fprintf(&b, "%s%s [label=%s, fillcolor=%s];\n",
+				indent, g.ids[name], strconv.Quote(nodeLabel(name)), strconv.Quote(g.colors[group]))
+		}
+		if group != "" {
+			b.WriteString("  }\n")
+		}
+	}
+	for _, joint := range g.joints {
+		fmt.Fprintf(&b, "  %s -- %s [label=%s, tooltip=%s];\n",
+			g.ids[joint.CubeA], g.ids[joint.CubeB], strconv.Quote(jointLabel(joint)), strconv.Quote(joint.Name))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMermaid writes the scene as a Mermaid flowchart: one subgraph per cube
+// group, styled with the group's color, and one labeled link per joint.
+func writeMermaid(w io.Writer, scene Scene) error {
+	g := newGraphLayout(scene)
+	// Mermaid labels are quoted strings without an escape for quotes.
+	text := func(s string) string { return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"` }
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for i, group := range g.groups {
+		indent := "  "
+		if group != "" {
+			fmt.Fprintf(&b, "  subgraph g%d[%s]\n", i, text(group))
+			indent = "    "
+		}
+		for _, name := range g.cubes[group] {
+			fmt.Fprintf(&b, "%s%s(%s):::g%d\n", indent, g.ids[name], text(nodeLabel(name)), i)
+		}
+		if group != "" {
+			b.WriteString("  end\n")
+		}
+	}
+	for _, joint := range g.joints {
+		fmt.Fprintf(&b, "  %s ---|%s| %s\n", g.ids[joint.CubeA], text(jointLabel(joint)), g.ids[joint.CubeB])
+	}
+	for i, group := range g.groups {
+		fmt.Fprintf(&b, "  classDef g%d fill:%s,stroke:#555\n", i, g.colors[group])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// graphScene is a small creature: a head and a two-cube body in groups, an
+// ungrouped tail, and a joint to a cube the scene does not describe.
+func graphScene() Scene {
+	return Scene{
+		Cubes: []Cube{
+			{Name: "dog_head_BASE", Group: "head"},
+			{Name: "dog_body1_BASE", Group: "body"},
+			{Name: "dog_body2_BASE", Group: "body"},
+			{Name: "dog_tail_BASE"},
+		},
+		Joints: []JointDef{
+			{Name: "neck", CubeA: "dog_body1_BASE", CubeB: "dog_head_BASE", Type: JointHinge, Params: map[string]float64{"limit_lower": -0.5, "limit_upper": 0.5}},
+			{Name: "spine", CubeA: "dog_body1_BASE", CubeB: "dog_body2_BASE", Type: JointFixed},
+			{Name: "wag", CubeA: "dog_body2_BASE", CubeB: "dog_tail_BASE", Type: JointHinge, Params: map[string]float64{"motor_enable": 1, "motor_max_impulse": 40}},
+			{Name: "leash", CubeA: "dog_head_BASE", CubeB: "post_BASE"},
+			{Name: "dangling", CubeA: "dog_tail_BASE"},
+		},
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	want := `graph cubes {
+  node [shape=box, style="rounded,filled", fontname=Helvetica];
+  edge [fontname=Helvetica, fontsize=10];
+  subgraph cluster_0 {
+    label="body";
+    c1 [label="dog_body1", fillcolor="#AEC7E8"];
+    c2 [label="dog_body2", fillcolor="#AEC7E8"];
+  }
+  subgraph cluster_1 {
+    label="head";
+    c0 [label="dog_head", fillcolor="#FFBB78"];
+  }
+  c3 [label="dog_tail", fillcolor="#FFFFFF"];
+  c4 [label="post", fillcolor="#FFFFFF"];
+  c1 -- c0 [label="hinge [-0.5, 0.5]", tooltip="neck"];
+  c1 -- c2 [label="fixed", tooltip="spine"];
+  c2 -- c3 [label="hinge motor 40", tooltip="wag"];
+  c0 -- c4 [label="joint", tooltip="leash"];
+}
+`
+	var b strings.Builder
+	if err := writeGraph(&b, graphScene(), "dot"); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != want {
+		t.Errorf("DOT:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	want := `flowchart LR
+  subgraph g0["body"]
+    c1("dog_body1"):::g0
+    c2("dog_body2"):::g0
+  end
+  subgraph g1["head"]
+    c0("dog_head"):::g1
+  end
+  c3("dog_tail"):::g2
+  c4("post"):::g2
+  c1 ---|"hinge [-0.5, 0.5]"| c0
+  c1 ---|"fixed"| c2
+  c2 ---|"hinge motor 40"| c3
+  c0 ---|"joint"| c4
+  classDef g0 fill:#AEC7E8,stroke:#555
+  classDef g1 fill:#FFBB78,stroke:#555
+  classDef g2 fill:#FFFFFF,stroke:#555
+`
+	var b strings.Builder
+	if err := writeGraph(&b, graphScene(), "mermaid"); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != want {
+		t.Errorf("Mermaid:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestGraphLabels(t *testing.T) {
+	scene := Scene{Cubes: []Cube{{Name: `say "hi"_BASE`, Group: `a "b"`}}}
+	var b strings.Builder
+	writeMermaid(&b, scene)
+	if !strings.Contains(b.String(), `c0("say #quot;hi#quot;")`) || !strings.Contains(b.String(), `g0["a #quot;b#quot;"]`) {
+		t.Errorf("Mermaid quotes not escaped:\n%s", b.String())
+	}
+	b.Reset()
+	writeDOT(&b, scene)
+	if !strings.Contains(b.String(), `label="say \"hi\""`) {
+		t.Errorf("DOT quotes not escaped:\n%s", b.String())
+	}
+	if err := writeGraph(&b, scene, "svg"); err == nil {
+		t.Error("writeGraph accepted an unknown format")
+	}
+	// Motor limits only show when the motor is on.
+	if got := jointLabel(JointDef{Type: JointHinge, Params: map[string]float64{"motor_max_impulse": 5}}); got != "hinge" {
+		t.Errorf("jointLabel = %q", got)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+)
+
+// ImageWallOptions controls how an image is laid out as a wall of cubes.
+type ImageWallOptions struct {
+	Width, Height int       // grid size in cubes; 0 derives it from the other, keeping aspect
+	Plane         string    // "xy" (upright wall, default), "xz" (floor) or "zy"
+	Origin        []float64 // world position of the top-left pixel
+	Spacing       float64   // distance between cube centers, default 1
+	Prefix        string    // cube name prefix, default "px"
+	MinAlpha      uint8     // cells less opaque than this are skipped; 0 keeps every cell
+}
+
+// withDefaults fills in unset options for an image of the given size.
+func (o ImageWallOptions) withDefaults(srcW, srcH int) ImageWallOptions {
+	switch {
+	case o.Width <= 0 && o.Height <= 0:
+		o.Width, o.Height = min(srcW, 32), 0
+		fallthrough
+	case o.Height <= 0:
+		o.Height = max(1, o.Width*srcH/srcW)
+	case o.Width <= 0:
+		o.Width = max(1, o.Height*srcW/srcH)
+	}
+	if o.Plane == "" {
+		o.Plane = "xy"
+	}
+	if len(o.Origin) != 3 {
+		o.Origin = []float64{0, 0, 0}
+	}
+	if o.Spacing <= 0 {
+		o.Spacing = 1
+	}
+	if o.Prefix == "" {
+		o.Prefix = "px"
+	}
+	return o
+}
+
+// pixelName names the cube showing grid cell (x, y).
+func (o ImageWallOptions) pixelName(x, y int) string {
+	return fmt.Sprintf("%s_%d_%d", o.Prefix, x, y)
+}
+
+// pixelPosition places grid cell (x, y) in the world. Row 0 is the top of the
+// image, so on upright planes it gets the highest Y.
+func (o ImageWallOptions) pixelPosition(x, y int) []float64 {
+	u, v := float64(x)*o.Spacing, float64(y)*o.Spacing
+	p := []float64{o.Origin[0], o.Origin[1], o.Origin[2]}
+	switch o.Plane {
+	case "xz":
+		p[0] += u
+		p[2] += v
+	case "zy":
+		p[2] += u
+		p[1] -= v
+	default:
+		p[0] += u
+		p[1] -= v
+	}
+	return p
+}
+
+// downsample box-filters img onto a w×h grid. Each cell holds the average
+// color of the source pixels it covers, weighted by their alpha, and the
+// average alpha.
+func downsample(img image.Image, w, h int) [][]cellColor {
+	b := img.Bounds()
+	cells := make([][]cellColor, h)
+	for y := range cells {
+		cells[y] = make([]cellColor, w)
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(y0+1, b.Min.Y+(y+1)*b.Dy()/h)
+		for x := range cells[y] {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(x0+1, b.Min.X+(x+1)*b.Dx()/w)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// RGBA is alpha-premultiplied, 16 bits per channel.
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(pr), g+uint64(pg), bl+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			cell := cellColor{A: uint8(a / n >> 8)}
+			if a > 0 {
+				cell.R = uint8(r * 0xffff / a >> 8)
+				cell.G = uint8(g * 0xffff / a >> 8)
+				cell.B = uint8(bl * 0xffff / a >> 8)
+			}
+			cells[y][x] = cell
+		}
+	}
+	return cells
+}
+
+// cellColor is the straight (non-premultiplied) color of one grid cell.
+type cellColor struct {
+	R, G, B, A uint8
+}
+
+func (c cellColor) hex() string {
+	return formatHex(c.R, c.G, c.B)
+}
+
+// imageWallCubes lays an image out as one colored cube per grid cell,
+// skipping cells that are mostly transparent. Cube names are logical.
+func imageWallCubes(img image.Image, opts ImageWallOptions) ([]Cube, ImageWallOptions) {
+	b := img.Bounds()
+	opts = opts.withDefaults(b.Dx(), b.Dy())
+	cells := downsample(img, opts.Width, opts.Height)
+
+	var cubes []Cube
+	for y, row := range cells {
+		for x, cell := range row {
+			if cell.A < opts.MinAlpha {
+				continue
+			}
+			cubes = append(cubes, Cube{
+				Name:     opts.pixelName(x, y),
+				Position: opts.pixelPosition(x, y),
+				Color:    cell.hex(),
+				Group:    opts.Prefix,
+			})
+		}
+	}
+	return cubes, opts
+}
+
+// loadImage decodes a PNG, GIF (first frame) or JPEG file.
+func loadImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("[Image] %v", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("[Image] Failed to decode %s: %v", path, err)
+	}
+	return img, nil
+}
+
+// spawnImageWall spawns an image as a wall of frozen, colored cubes and
+// returns the cubes with their server names.
+func (s *Session) spawnImageWall(path string, opts ImageWallOptions) ([]Cube, error) {
+	img, err := loadImage(path)
+	if err != nil {
+		return nil, err
+	}
+	cubes, opts := imageWallCubes(img, opts)
+	fmt.Printf("[Image] %s: %dx%d grid, %d visible cubes on the %s plane\n",
+		path, opts.Width, opts.Height, len(cubes), opts.Plane)
+
+	if err := s.spawnCubes(cubes); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(cubes))
+	colors := make(map[string]string, len(cubes))
+	for i := range cubes {
+		cubes[i].Name = serverCubeName(cubes[i].Name)
+		names[i] = cubes[i].Name
+		colors[names[i]] = cubes[i].Color
+	}
+	if err := s.freezeCubes(names, true); err != nil {
+		return nil, err
+	}
+	if err := s.setColors(colors); err != nil {
+		return nil, err
+	}
+	return cubes, nil
+}
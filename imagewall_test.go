@@ -0,0 +1,166 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+// testImage builds an image at origin from rows of color letters; "." is
+// transparent.
+func testImage(origin image.Point, rows ...string) *image.NRGBA {
+	colors := map[byte]color.NRGBA{
+		'r': {0xff, 0, 0, 0xff},
+		'g': {0, 0xff, 0, 0xff},
+		'b': {0, 0, 0xff, 0xff},
+		'h': {0xff, 0, 0, 0x80}, // half-transparent red
+		'.': {},
+	}
+	img := image.NewNRGBA(image.Rectangle{origin, origin.Add(image.Pt(len(rows[0]), len(rows)))})
+	for y, row := range rows {
+		for x := range row {
+			img.SetNRGBA(origin.X+x, origin.Y+y, colors[row[x]])
+		}
+	}
+	return img
+}
+
+func TestDownsample(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		w, h int
+		want [][]cellColor
+	}{
+		{
+			name: "halves",
+			img:  testImage(image.Point{}, "rrbb", "rrbb"),
+			w:    2, h: 1,
+			want: [][]cellColor{{{0xff, 0, 0, 0xff}, {0, 0, 0xff, 0xff}}},
+		},
+		{
+			name: "average",
+			img:  testImage(image.Point{}, "rb", "br"),
+			w:    1, h: 1,
+			want: [][]cellColor{{{0x7f, 0, 0x7f, 0xff}}},
+		},
+		{
+			// Transparent pixels lower the alpha but not the color.
+			name: "alpha weighted",
+			img:  testImage(image.Point{}, "r."),
+			w:    1, h: 1,
+			want: [][]cellColor{{{0xff, 0, 0, 0x7f}}},
+		},
+		{
+			name: "translucent",
+			img:  testImage(image.Point{}, "h"),
+			w:    1, h: 1,
+			want: [][]cellColor{{{0xff, 0, 0, 0x80}}},
+		},
+		{name: "transparent", img: testImage(image.Point{}, ".."), w: 1, h: 1, want: [][]cellColor{{{}}}},
+		{
+			name: "upsampled",
+			img:  testImage(image.Point{}, "g"),
+			w:    2, h: 2,
+			want: [][]cellColor{{{0, 0xff, 0, 0xff}, {0, 0xff, 0, 0xff}}, {{0, 0xff, 0, 0xff}, {0, 0xff, 0, 0xff}}},
+		},
+		{
+			// Three pixels onto two cells: the first cell covers one.
+			name: "uneven",
+			img:  testImage(image.Point{}, "rbb"),
+			w:    2, h: 1,
+			want: [][]cellColor{{{0xff, 0, 0, 0xff}, {0, 0, 0xff, 0xff}}},
+		},
+		{
+			name: "offset bounds",
+			img:  testImage(image.Pt(10, -4), "rg", "bb"),
+			w:    2, h: 2,
+			want: [][]cellColor{{{0xff, 0, 0, 0xff}, {0, 0xff, 0, 0xff}}, {{0, 0, 0xff, 0xff}, {0, 0, 0xff, 0xff}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := downsample(tt.img, tt.w, tt.h)
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d rows, want %d", len(got), len(tt.want))
+			}
+			for y := range got {
+				if !slices.Equal(got[y], tt.want[y]) {
+					t.Errorf("row %d = %v, want %v", y, got[y], tt.want[y])
+				}
+			}
+		})
+	}
+}
+
+func TestImageWallDefaults(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       ImageWallOptions
+		srcW, srcH int
+		w, h       int
+	}{
+		{"capped", ImageWallOptions{}, 64, 32, 32, 16},
+		{"small image kept", ImageWallOptions{}, 8, 4, 8, 4},
+		{"width given", ImageWallOptions{Width: 10}, 64, 32, 10, 5},
+		{"height given", ImageWallOptions{Height: 4}, 64, 32, 8, 4},
+		{"both given", ImageWallOptions{Width: 3, Height: 7}, 64, 32, 3, 7},
+		{"never zero", ImageWallOptions{Width: 10}, 100, 1, 10, 1},
+	}
+	for _, tt := range tests {
+		o := tt.opts.withDefaults(tt.srcW, tt.srcH)
+		if o.Width != tt.w || o.Height != tt.h {
+			t.Errorf("%s: %d×%d, want %d×%d", tt.name, o.Width, o.Height, tt.w, tt.h)
+		}
+	}
+}
+
+func TestImageWallCubes(t *testing.T) {
+	img := testImage(image.Point{}, "r.", "hb")
+	tests := []struct {
+		name string
+		opts ImageWallOptions
+		want []Cube
+	}{
+		{
+			name: "upright",
+			opts: ImageWallOptions{Width: 2, Origin: []float64{1, 10, 0}, Spacing: 2, MinAlpha: 0x40},
+			want: []Cube{
+				{Name: "px_0_0", Position: []float64{1, 10, 0}, Color: "#FF0000"},
+				{Name: "px_0_1", Position: []float64{1, 8, 0}, Color: "#FF0000"},
+				{Name: "px_1_1", Position: []float64{3, 8, 0}, Color: "#0000FF"},
+			},
+		},
+		{
+			name: "floor, opaque only",
+			opts: ImageWallOptions{Width: 2, Plane: "xz", Prefix: "tile", MinAlpha: 0xff},
+			want: []Cube{
+				{Name: "tile_0_0", Position: []float64{0, 0, 0}, Color: "#FF0000"},
+				{Name: "tile_1_1", Position: []float64{1, 0, 1}, Color: "#0000FF"},
+			},
+		},
+		{
+			name: "side wall",
+			opts: ImageWallOptions{Width: 2, Plane: "zy", MinAlpha: 0xff},
+			want: []Cube{
+				{Name: "px_0_0", Position: []float64{0, 0, 0}, Color: "#FF0000"},
+				{Name: "px_1_1", Position: []float64{0, -1, 1}, Color: "#0000FF"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cubes, opts := imageWallCubes(img, tt.opts)
+			if len(cubes) != len(tt.want) {
+				t.Fatalf("cubes = %+v, want %+v", cubes, tt.want)
+			}
+			for i, cube := range cubes {
+				want := tt.want[i]
+				if cube.Name != want.Name || !slices.Equal(cube.Position, want.Position) || cube.Color != want.Color || cube.Group != opts.Prefix {
+					t.Errorf("cube %d = %+v, want %+v", i, cube, want)
+				}
+			}
+		})
+	}
+}
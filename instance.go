@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// baseSuffix is appended by the server to every cube spawned with is_base.
+const baseSuffix = "_BASE"
+
+// serverCubeName returns the name the server uses for a spawned cube.
+func serverCubeName(name string) string {
+	return name + baseSuffix
+}
+
+// Instance is one copy of a model in the world. Every cube it owns is
+// namespaced with Prefix, so several copies of the same model can be spawned
+// side by side without their names colliding on the server.
+type Instance struct {
+	Prefix string
+	Offset []float64
+}
+
+// newInstance creates an instance with the given prefix and world offset.
+// An empty prefix keeps the model's names untouched.
+func newInstance(prefix string, offset []float64) *Instance {
+	if len(offset) != 3 {
+		offset = []float64{0, 0, 0}
+	}
+	return &Instance{Prefix: prefix, Offset: offset}
+}
+
+// Name maps a logical cube name ("tail3") to its namespaced spawn name
+// ("dog2_tail3").
+func (inst *Instance) Name(logical string) string {
+	if inst == nil || inst.Prefix == "" {
+		return logical
+	}
+	return inst.Prefix + "_" + logical
+}
+
+// Resolve maps a logical cube name ("tail3") to the name the server knows it
+// by ("dog2_tail3_BASE").
+func (inst *Instance) Resolve(logical string) string {
+	return serverCubeName(inst.Name(logical))
+}
+
+// ResolveAll resolves a list of logical names.
+func (inst *Instance) ResolveAll(logical []string) []string {
+	names := make([]string, len(logical))
+	for i, name := range logical {
+		names[i] = inst.Resolve(name)
+	}
+	return names
+}
+
+// Logical maps a server cube name back to the logical name within this
+// instance. It reports false if the cube does not belong to the instance.
+func (inst *Instance) Logical(serverName string) (string, bool) {
+	name, ok := strings.CutSuffix(serverName, baseSuffix)
+	if !ok {
+		return "", false
+	}
+	if inst == nil || inst.Prefix == "" {
+		return name, true
+	}
+	return strings.CutPrefix(name, inst.Prefix+"_")
+}
+
+// Cubes returns a copy of the model with names namespaced and positions
+// shifted by the instance offset.
+func (inst *Instance) Cubes(model []Cube) []Cube {
+	cubes := make([]Cube, len(model))
+	for i, cube := range model {
+		cube.Name = inst.Name(cube.Name)
+		cube.Position = addVec(cube.Position, inst.Offset)
+		cubes[i] = cube
+	}
+	return cubes
+}
+
+// Chains resolves chains of logical cube names to server names.
+func (inst *Instance) Chains(chains [][]string) [][]string {
+	resolved := make([][]string, len(chains))
+	for i, chain := range chains {
+		resolved[i] = inst.ResolveAll(chain)
+	}
+	return resolved
+}
+
+// findInstance returns the instance owning a server cube name together with
+// the cube's logical name. Longer prefixes win so "dog10" is not mistaken for
+// "dog1".
+func findInstance(instances []*Instance, serverName string) (*Instance, string) {
+	var best *Instance
+	var bestName string
+	for _, inst := range instances {
+		logical, ok := inst.Logical(serverName)
+		if !ok {
+			continue
+		}
+		if best == nil || len(inst.Prefix) > len(best.Prefix) {
+			best, bestName = inst, logical
+		}
+	}
+	return best, bestName
+}
+
+// GridLayout places instances on a grid in the XZ plane, filling rows of
+// Columns instances before moving on along Z.
+type GridLayout struct {
+	Origin  []float64
+	Columns int
+	Spacing []float64 // distance between neighbours along X and Z
+}
+
+// Offset returns the world offset of the i-th instance.
+func (g GridLayout) Offset(i int) []float64 {
+	columns := g.Columns
+	if columns <= 0 {
+		columns = 1
+	}
+	origin := g.Origin
+	if len(origin) != 3 {
+		origin = []float64{0, 0, 0}
+	}
+	spacing := g.Spacing
+	if len(spacing) != 2 {
+		spacing = []float64{5, 5}
+	}
+	return []float64{
+		origin[0] + float64(i%columns)*spacing[0],
+		origin[1],
+		origin[2] + float64(i/columns)*spacing[1],
+	}
+}
+
+// newInstances creates count instances named prefix1..prefixN laid out on
+// the grid.
+func newInstances(prefix string, count int, layout GridLayout) []*Instance {
+	instances := make([]*Instance, count)
+	for i := range instances {
+		instances[i] = newInstance(fmt.Sprintf("%s%d", prefix, i+1), layout.Offset(i))
+	}
+	return instances
+}
+
+// spawnInstances spawns the model once per instance, in one batch.
+func (s *Session) spawnInstances(model []Cube, instances []*Instance) error {
+	var cubes []Cube
+	for _, inst := range instances {
+		cubes = append(cubes, inst.Cubes(model)...)
+	}
+	return s.spawnCubes(cubes)
+}
+
+func addVec(a, b []float64) []float64 {
+	out := make([]float64, len(a))
+	for i := range a {
+		out[i] = a[i]
+		if i < len(b) {
+			out[i] += b[i]
+		}
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestInstanceNames(t *testing.T) {
+	tests := []struct {
+		inst    *Instance
+		logical string
+		server  string
+	}{
+		{newInstance("dog2", nil), "tail3", "dog2_tail3_BASE"},
+		{newInstance("", nil), "tail3", "tail3_BASE"},
+		{nil, "tail3", "tail3_BASE"},
+		// Names containing the suffix or the separator survive the trip.
+		{newInstance("dog", nil), "left_ear", "dog_left_ear_BASE"},
+		{newInstance("dog", nil), "x_BASE", "dog_x_BASE_BASE"},
+	}
+	for _, tt := range tests {
+		if got := tt.inst.Resolve(tt.logical); got != tt.server {
+			t.Errorf("Resolve(%q) = %q, want %q", tt.logical, got, tt.server)
+		}
+		if got, ok := tt.inst.Logical(tt.server); !ok || got != tt.logical {
+			t.Errorf("Logical(%q) = %q, %v, want %q", tt.server, got, ok, tt.logical)
+		}
+	}
+}
+
+func TestInstanceLogicalRejects(t *testing.T) {
+	dog := newInstance("dog", nil)
+	for _, server := range []string{
+		"dog_tail3",      // spawned without is_base
+		"cat_tail3_BASE", // another prefix
+		"dogtail3_BASE",  // prefix without the separator
+		"_BASE",
+	} {
+		if logical, ok := dog.Logical(server); ok {
+			t.Errorf("Logical(%q) = %q, want no match", server, logical)
+		}
+	}
+}
+
+func TestFindInstance(t *testing.T) {
+	instances := []*Instance{newInstance("dog1", nil), newInstance("dog10", nil), newInstance("dog", nil)}
+	tests := []struct {
+		server      string
+		wantPrefix  string
+		wantLogical string
+	}{
+		{"dog1_tail_BASE", "dog1", "tail"},
+		{"dog10_tail_BASE", "dog10", "tail"},
+		{"dog_tail_BASE", "dog", "tail"},
+		// "dog" also owns this name, but "dog1" is the longer prefix.
+		{"dog1_x_BASE", "dog1", "x"},
+		{"cat_tail_BASE", "", ""},
+		{"dog1_tail", "", ""},
+	}
+	for _, tt := range tests {
+		inst, logical := findInstance(instances, tt.server)
+		prefix := ""
+		if inst != nil {
+			prefix = inst.Prefix
+		}
+		if prefix != tt.wantPrefix || logical != tt.wantLogical {
+			t.Errorf("findInstance(%q) = %q, %q, want %q, %q", tt.server, prefix, logical, tt.wantPrefix, tt.wantLogical)
+		}
+	}
+}
+
+func TestGridLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout GridLayout
+		i      int
+		want   []float64
+	}{
+		{"defaults", GridLayout{}, 2, []float64{0, 0, 10}},
+		{"first", GridLayout{Origin: []float64{1, 2, 3}, Columns: 3, Spacing: []float64{4, 6}}, 0, []float64{1, 2, 3}},
+		{"along a row", GridLayout{Origin: []float64{1, 2, 3}, Columns: 3, Spacing: []float64{4, 6}}, 2, []float64{9, 2, 3}},
+		{"next row", GridLayout{Origin: []float64{1, 2, 3}, Columns: 3, Spacing: []float64{4, 6}}, 4, []float64{5, 2, 9}},
+		{"bad spacing", GridLayout{Columns: 2, Spacing: []float64{1}}, 3, []float64{5, 0, 5}},
+	}
+	for _, tt := range tests {
+		if got := tt.layout.Offset(tt.i); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Offset(%d) = %v, want %v", tt.name, tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestInstanceCubes(t *testing.T) {
+	inst := newInstance("dog2", []float64{10, 0, -5})
+	model := []Cube{{Name: "body", Position: []float64{1, 2, 3}}}
+	cubes := inst.Cubes(model)
+	if cubes[0].Name != "dog2_body" || !slices.Equal(cubes[0].Position, []float64{11, 2, -2}) {
+		t.Errorf("Cubes = %+v", cubes[0])
+	}
+	if model[0].Name != "body" || !slices.Equal(model[0].Position, []float64{1, 2, 3}) {
+		t.Errorf("Cubes changed the model: %+v", model[0])
+	}
+}
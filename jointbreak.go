@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// removeJoint deletes a joint from the world and stops tracking it. Both
+// cubes stay where they are.
+func (s *Session) removeJoint(name string) error {
+	resp, err := s.request(Message{
+		"type":       "remove_joint",
+		"joint_name": name,
+	})
+	if err != nil {
+		return fmt.Errorf("[removeJoint] %s: %v", name, err)
+	}
+	var reply struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal([]byte(resp), &reply) == nil && reply.Type == "error" {
+		return fmt.Errorf("[removeJoint] %s: server refused: %s", name, reply.Message)
+	}
+	s.untrackLink(name)
+	fmt.Printf("✂️ Removed joint %s\n", name)
+	return nil
+}
+
+// JointBreak is the server's report of a joint that gave way because the
+// force or torque on it passed its break threshold.
+type JointBreak struct {
+	JointName string  `json:"joint_name"`
+	Force     float64 `json:"force"`  // N, when the break was reported
+	Torque    float64 `json:"torque"` // N·m
+}
+
+// watchJointBreaks subscribes to the server's joint_broken events. Each
+// broken joint is dropped from the joint table and handed to onBreak, which
+// may be nil. It returns when stop is closed or the connection is lost.
+func (s *Session) watchJointBreaks(stop <-chan struct{}, onBreak func(JointBreak)) error {
+	conn, err := s.connect()
+	if err != nil {
+		return fmt.Errorf("[Breaks] %v", err)
+	}
+	defer conn.Close()
+	if err := sendJSONMessage(conn, Message{"type": "subscribe", "events": []string{"joint_broken"}}); err != nil {
+		return fmt.Errorf("[Breaks] Failed to subscribe: %v", err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	// Events come whenever joints break, so reads wait indefinitely; closing
+	// the connection on stop unblocks them.
+	conn.SetReadDeadline(time.Time{})
+	reader := bufio.NewReader(conn)
+	for {
+		resp, err := readReply(reader)
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return fmt.Errorf("[Breaks] Connection lost: %v", err)
+			}
+		}
+
+		var event struct {
+			Type string `json:"type"`
+			JointBreak
+		}
+		if err := json.Unmarshal([]byte(resp), &event); err != nil || event.Type != "joint_broken" {
+			continue
+		}
+		s.untrackLink(event.JointName)
+		if onBreak != nil {
+			onBreak(event.JointBreak)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// JointFrame places a joint: the pivot it turns about and the axis it turns
+// around or, for sliders, moves along. Anchor and Axis are in world
+// coordinates (creature coordinates in a definition) unless Local is set, in
+// which case they are relative to cube A's center and rotation. Whatever is
+// left out defaults from the face the two cubes share.
+type JointFrame struct {
+	Anchor []float64 `json:"anchor,omitempty"`
+	Axis   []float64 `json:"axis,omitempty"`
+	Local  bool      `json:"local,omitempty"`
+}
+
+func (f JointFrame) equal(g JointFrame) bool {
+	return slices.Equal(f.Anchor, g.Anchor) && slices.Equal(f.Axis, g.Axis) && f.Local == g.Local
+}
+
+func (f JointFrame) validate() error {
+	if len(f.Anchor) != 0 && len(f.Anchor) != 3 {
+		return fmt.Errorf("anchor must be a 3D point")
+	}
+	if len(f.Axis) != 0 && (len(f.Axis) != 3 || vecLength(f.Axis) == 0) {
+		return fmt.Errorf("axis must be a non-zero 3D vector")
+	}
+	return nil
+}
+
+// resolve returns the frame in world coordinates with defaults filled in,
+// given the cubes the joint links as they sit in the world. Rotations are
+// ignored when finding the shared face, so joints between rotated cubes
+// should spell out their frame.
+func (f JointFrame) resolve(kind JointKind, a, b Cube) JointFrame {
+	f = f.world(a)
+	normal, face := sharedFace(a, b)
+
+	out := JointFrame{Anchor: face, Axis: defaultJointAxis(kind, normal)}
+	if len(f.Anchor) == 3 {
+		out.Anchor = f.Anchor
+	}
+	if len(f.Axis) == 3 {
+		out.Axis = f.Axis
+	}
+	switch kind {
+	case JointFixed, JointPin:
+		// Neither constrains rotation about an axis.
+		return JointFrame{Anchor: roundVec(out.Anchor)}
+	}
+	return JointFrame{Anchor: roundVec(out.Anchor), Axis: roundVec(normalize(out.Axis))}
+}
+
+// world converts a frame local to cube a into world coordinates.
+func (f JointFrame) world(a Cube) JointFrame {
+	if !f.Local {
+		return f
+	}
+	rot := cubeRotation(a)
+	var out JointFrame
+	if len(f.Anchor) == 3 {
+		out.Anchor = addVec(rot.apply([3]float64(f.Anchor)), a.Position)
+	}
+	if len(f.Axis) == 3 {
+		out.Axis = rot.apply([3]float64(f.Axis))
+	}
+	return out
+}
+
+// defaultJointAxis picks an axis from the direction the cubes are stacked
+// in, normal being the signed unit vector from cube A to cube B. Sliders and
+// cone-twist joints follow the stack. Hinges bend across it: vertical
+// stacks like legs swing about X, horizontal ones like tails about Y.
+func defaultJointAxis(kind JointKind, normal []float64) []float64 {
+	switch kind {
+	case JointSlider, JointConeTwist:
+		return slices.Clone(normal)
+	}
+	if normal[1] != 0 {
+		return []float64{1, 0, 0}
+	}
+	return []float64{0, 1, 0}
+}
+
+// sharedFace finds where two cubes meet: the signed axis the line between
+// their centers mostly follows, and the middle of the face between them.
+// Cubes that do not touch get the point midway between their facing sides.
+func sharedFace(a, b Cube) (normal, point []float64) {
+	ha, hb := halfExtents(a), halfExtents(b)
+	pa, pb := cubeCenter(a), cubeCenter(b)
+
+	axis := 0
+	for i := 1; i < 3; i++ {
+		if math.Abs(pb[i]-pa[i]) > math.Abs(pb[axis]-pa[axis]) {
+			axis = i
+		}
+	}
+	sign := 1.0
+	if pb[axis] < pa[axis] {
+		sign = -1
+	}
+	normal = make([]float64, 3)
+	normal[axis] = sign
+
+	point = make([]float64, 3)
+	for i := range point {
+		if i == axis {
+			point[i] = (pa[i] + sign*ha[i] + pb[i] - sign*hb[i]) / 2
+			continue
+		}
+		lo, hi := max(pa[i]-ha[i], pb[i]-hb[i]), min(pa[i]+ha[i], pb[i]+hb[i])
+		if lo <= hi {
+			point[i] = (lo + hi) / 2
+		} else {
+			point[i] = (pa[i] + pb[i]) / 2
+		}
+	}
+	return normal, point
+}
+
+func cubeCenter(c Cube) [3]float64 {
+	var p [3]float64
+	copy(p[:], c.Position)
+	return p
+}
+
+// halfExtents is half the cube's size, a unit cube's when it has none.
+func halfExtents(c Cube) [3]float64 {
+	h := [3]float64{0.5, 0.5, 0.5}
+	if len(c.Size) == 3 {
+		for i := range h {
+			h[i] = c.Size[i] / 2
+		}
+	}
+	return h
+}
+
+// cubeRotation returns the rotation matrix for the cube's rotation in degrees.
+func cubeRotation(c Cube) mat3 {
+	if len(c.Rotation) != 3 {
+		return identityPose().r
+	}
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	return rpyMatrix(rad(c.Rotation[0]), rad(c.Rotation[1]), rad(c.Rotation[2]))
+}
+
+// placedJoint returns the joint as the server should create it: names
+// namespaced by inst and its frame resolved to world coordinates.
+func (c *Creature) placedJoint(inst *Instance, joint JointDef) JointDef {
+	a, _ := c.cube(joint.CubeA)
+	b, _ := c.cube(joint.CubeB)
+	cubes := inst.Cubes([]Cube{a, b})
+
+	frame := joint.JointFrame
+	if !frame.Local && len(frame.Anchor) == 3 {
+		frame.Anchor = addVec(frame.Anchor, inst.Offset)
+	}
+	joint.Name = inst.Name(joint.Name)
+	joint.CubeA, joint.CubeB = inst.Resolve(joint.CubeA), inst.Resolve(joint.CubeB)
+	joint.JointFrame = frame.resolve(joint.Type, cubes[0], cubes[1])
+	return joint
+}
+
+// resolveJointFrame fills in the frame of a joint between tracked cubes.
+// Joints between cubes the session does not know keep a world frame as given
+// and otherwise leave placement to the server.
+func (s *Session) resolveJointFrame(joint JointDef) JointDef {
+	var a, b Cube
+	var hasA, hasB bool
+	for _, cube := range s.Cubes() {
+		switch cube.Name {
+		case joint.CubeA:
+			a, hasA = cube, true
+		case joint.CubeB:
+			b, hasB = cube, true
+		}
+	}
+	switch {
+	case hasA && hasB:
+		joint.JointFrame = joint.JointFrame.resolve(joint.Type, a, b)
+	case joint.Local:
+		joint.JointFrame = JointFrame{}
+	}
+	return joint
+}
+
+// jointMessage builds the create_joint command for a joint. The frame is
+// sent only when it is known in world coordinates, break thresholds only
+// when set.
+func jointMessage(joint JointDef) Message {
+	msg := Message{
+		"type":       "create_joint",
+		"cube1":      joint.CubeA,
+		"cube2":      joint.CubeB,
+		"joint_type": joint.Type,
+		"joint_name": joint.Name,
+	}
+	if !joint.Local {
+		if len(joint.Anchor) == 3 {
+			msg["anchor"] = joint.Anchor
+		}
+		if len(joint.Axis) == 3 {
+			msg["axis"] = joint.Axis
+		}
+	}
+	if joint.BreakForce > 0 {
+		msg["break_force"] = joint.BreakForce
+	}
+	if joint.BreakTorque > 0 {
+		msg["break_torque"] = joint.BreakTorque
+	}
+	return msg
+}
+
+// mirror reflects the frame of a joint mirrored across m. Anchors are points
+// and reflect as such. Hinge-like axes are axial vectors, so they also flip
+// sign: the same motor command then turns both sides in mirror image.
+// Slider axes are plain directions.
+func (f JointFrame) mirror(m MirrorDef, axis int, kind JointKind) JointFrame {
+	out := JointFrame{Local: f.Local}
+	if len(f.Anchor) == 3 {
+		if f.Local {
+			out.Anchor = slices.Clone(f.Anchor)
+			out.Anchor[axis] = -out.Anchor[axis]
+		} else {
+			out.Anchor = m.reflect(f.Anchor, axis)
+		}
+	}
+	if len(f.Axis) == 3 {
+		out.Axis = slices.Clone(f.Axis)
+		out.Axis[axis] = -out.Axis[axis]
+		if kind != JointSlider {
+			for i := range out.Axis {
+				out.Axis[i] = -out.Axis[i]
+			}
+		}
+		out.Axis = roundVec(out.Axis)
+	}
+	return out
+}
+
+func vecLength(v []float64) float64 {
+	sum := 0.0
+	for _, x := range v {
+		sum += x * x
+	}
+	return math.Sqrt(sum)
+}
+
+func normalize(v []float64) []float64 {
+	n := vecLength(v)
+	out := make([]float64, len(v))
+	for i := range v {
+		out[i] = v[i] / n
+	}
+	return out
+}
+
+// roundVec drops floating-point noise so resolved frames compare and print
+// cleanly.
+func roundVec(v []float64) []float64 {
+	return scaleVec(v, 1)
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JointKind is a joint type create_joint accepts.
+type JointKind string
+
+const (
+	JointHinge       JointKind = "hinge"
+	JointSlider      JointKind = "slider"
+	JointConeTwist   JointKind = "cone_twist"
+	JointGeneric6DOF JointKind = "generic_6dof"
+	JointFixed       JointKind = "fixed"
+	JointPin         JointKind = "pin"
+
+	// JointUnknown marks a joint found on the server whose kind was never
+	// recorded; get_joints_for_cube does not report one.
+	JointUnknown JointKind = ""
+)
+
+// jointParamTypes maps each kind to the struct describing its parameters.
+// The struct tags are the schema: `param` is the name set_joint_params
+// takes, `range` the allowed values ("pi" is accepted, "inf" means
+// unbounded), `unit` what the number measures, and `upper` on a lower limit
+// names the upper limit it must not exceed. Nested structs add a prefix.
+var jointParamTypes = map[JointKind]reflect.Type{
+	JointHinge:       reflect.TypeOf(HingeParams{}),
+	JointSlider:      reflect.TypeOf(SliderParams{}),
+	JointConeTwist:   reflect.TypeOf(ConeTwistParams{}),
+	JointGeneric6DOF: reflect.TypeOf(Generic6DOFParams{}),
+	JointFixed:       reflect.TypeOf(FixedParams{}),
+	JointPin:         reflect.TypeOf(PinParams{}),
+}
+
+// HingeParams rotates around one axis, optionally limited and motorized.
+type HingeParams struct {
+	Bias                float64 `param:"bias" range:"0,1"`
+	LimitLower          float64 `param:"limit_lower" range:"-pi,pi" unit:"rad" upper:"limit_upper"`
+	LimitUpper          float64 `param:"limit_upper" range:"-pi,pi" unit:"rad"`
+	LimitBias           float64 `param:"limit_bias" range:"0,1"`
+	LimitSoftness       float64 `param:"limit_softness" range:"0,16"`
+	LimitRelaxation     float64 `param:"limit_relaxation" range:"0,16"`
+	MotorEnable         bool    `param:"motor_enable"`
+	MotorTargetVelocity float64 `param:"motor_target_velocity" range:"-inf,inf" unit:"rad/s"`
+	MotorMaxImpulse     float64 `param:"motor_max_impulse" range:"0,inf" unit:"N·m·s"`
+}
+
+// SliderParams moves along one axis and may twist around it.
+type SliderParams struct {
+	LinearLimitLower       float64 `param:"linear_limit_lower" range:"-inf,inf" unit:"m" upper:"linear_limit_upper"`
+	LinearLimitUpper       float64 `param:"linear_limit_upper" range:"-inf,inf" unit:"m"`
+	LinearLimitSoftness    float64 `param:"linear_limit_softness" range:"0,16"`
+	LinearLimitRestitution float64 `param:"linear_limit_restitution" range:"0,16"`
+	LinearLimitDamping     float64 `param:"linear_limit_damping" range:"0,16"`
+	AngularLimitLower      float64 `param:"angular_limit_lower" range:"-pi,pi" unit:"rad" upper:"angular_limit_upper"`
+	AngularLimitUpper      float64 `param:"angular_limit_upper" range:"-pi,pi" unit:"rad"`
+	AngularLimitSoftness   float64 `param:"angular_limit_softness" range:"0,16"`
+	AngularLimitDamping    float64 `param:"angular_limit_damping" range:"0,16"`
+}
+
+// ConeTwistParams swings within a cone and twists around its axis, like a
+// shoulder.
+type ConeTwistParams struct {
+	SwingSpan  float64 `param:"swing_span" range:"0,pi" unit:"rad"`
+	TwistSpan  float64 `param:"twist_span" range:"0,pi" unit:"rad"`
+	Bias       float64 `param:"bias" range:"0,1"`
+	Softness   float64 `param:"softness" range:"0,1"`
+	Relaxation float64 `param:"relaxation" range:"0,16"`
+}
+
+// Generic6DOFParams limits and drives each axis separately; its parameters
+// are prefixed with the axis, as in "y_angular_motor_target_velocity".
+type Generic6DOFParams struct {
+	X Generic6DOFAxis `param:"x_"`
+	Y Generic6DOFAxis `param:"y_"`
+	Z Generic6DOFAxis `param:"z_"`
+}
+
+// Generic6DOFAxis is the per-axis part of Generic6DOFParams.
+type Generic6DOFAxis struct {
+	LinearLimitEnable          bool    `param:"linear_limit_enable"`
+	LinearLowerLimit           float64 `param:"linear_lower_limit" range:"-inf,inf" unit:"m" upper:"linear_upper_limit"`
+	LinearUpperLimit           float64 `param:"linear_upper_limit" range:"-inf,inf" unit:"m"`
+	LinearMotorEnable          bool    `param:"linear_motor_enable"`
+	LinearMotorTargetVelocity  float64 `param:"linear_motor_target_velocity" range:"-inf,inf" unit:"m/s"`
+	LinearMotorForceLimit      float64 `param:"linear_motor_force_limit" range:"0,inf" unit:"N"`
+	AngularLimitEnable         bool    `param:"angular_limit_enable"`
+	AngularLowerLimit          float64 `param:"angular_lower_limit" range:"-pi,pi" unit:"rad" upper:"angular_upper_limit"`
+	AngularUpperLimit          float64 `param:"angular_upper_limit" range:"-pi,pi" unit:"rad"`
+	AngularMotorEnable         bool    `param:"angular_motor_enable"`
+	AngularMotorTargetVelocity float64 `param:"angular_motor_target_velocity" range:"-inf,inf" unit:"rad/s"`
+	AngularMotorForceLimit     float64 `param:"angular_motor_force_limit" range:"0,inf" unit:"N·m"`
+}
+
+// FixedParams is empty: a fixed joint welds its cubes together.
+type FixedParams struct{}
+
+// PinParams holds two cubes together at a point, free to rotate.
+type PinParams struct {
+	Bias         float64 `param:"bias" range:"0,1"`
+	Damping      float64 `param:"damping" range:"0,16"`
+	ImpulseClamp float64 `param:"impulse_clamp" range:"0,inf" unit:"N·s"`
+}
+
+// Params returns every parameter, zero values included, for set_joint_params.
+func (p HingeParams) Params() map[string]float64 { return paramMap(p) }
+
+// Params returns every parameter, zero values included, for set_joint_params.
+func (p SliderParams) Params() map[string]float64 { return paramMap(p) }
+
+// Params returns every parameter, zero values included, for set_joint_params.
+func (p ConeTwistParams) Params() map[string]float64 { return paramMap(p) }
+
+// Params returns every parameter, zero values included, for set_joint_params.
+func (p Generic6DOFParams) Params() map[string]float64 { return paramMap(p) }
+
+// Params returns every parameter, zero values included, for set_joint_params.
+func (p PinParams) Params() map[string]float64 { return paramMap(p) }
+
+// ParamSpec describes one joint parameter.
+type ParamSpec struct {
+	Name     string
+	Min, Max float64
+	Unit     string
+	Bool     bool   // only 0 and 1 are allowed
+	Upper    string // for a lower limit, the upper limit it pairs with
+	field    []int  // index path into the params struct
+}
+
+func (p ParamSpec) String() string {
+	switch {
+	case p.Bool:
+		return p.Name + " (0 or 1)"
+	case p.Unit != "":
+		return fmt.Sprintf("%s [%s, %s] %s", p.Name, formatBound(p.Min), formatBound(p.Max), p.Unit)
+	}
+	return fmt.Sprintf("%s [%s, %s]", p.Name, formatBound(p.Min), formatBound(p.Max))
+}
+
+func formatBound(v float64) string {
+	switch {
+	case math.IsInf(v, 0):
+		return strings.TrimPrefix(strconv.FormatFloat(v, 'g', -1, 64), "+")
+	case math.Abs(math.Abs(v)-math.Pi) < 1e-12:
+		return strings.Replace(strconv.FormatFloat(v/math.Pi, 'g', -1, 64), "1", "π", 1)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	schemaOnce sync.Once
+	schemas    map[JointKind][]ParamSpec
+)
+
+// jointSchema returns the parameters a joint kind accepts.
+func jointSchema(kind JointKind) ([]ParamSpec, bool) {
+	schemaOnce.Do(func() {
+		schemas = make(map[JointKind][]ParamSpec, len(jointParamTypes))
+		for k, t := range jointParamTypes {
+			schemas[k] = schemaOf(t, "", nil)
+		}
+	})
+	specs, ok := schemas[kind]
+	return specs, ok
+}
+
+// schemaOf reads the parameter specs from a params struct's tags.
+func schemaOf(t reflect.Type, prefix string, index []int) []ParamSpec {
+	var specs []ParamSpec
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		path := append(append([]int{}, index...), i)
+		name := prefix + f.Tag.Get("param")
+		if f.Type.Kind() == reflect.Struct {
+			specs = append(specs, schemaOf(f.Type, name, path)...)
+			continue
+		}
+		spec := ParamSpec{Name: name, Unit: f.Tag.Get("unit"), field: path, Min: 0, Max: 1}
+		if upper := f.Tag.Get("upper"); upper != "" {
+			spec.Upper = prefix + upper
+		}
+		if f.Type.Kind() == reflect.Bool {
+			spec.Bool = true
+		} else {
+			lo, hi, _ := strings.Cut(f.Tag.Get("range"), ",")
+			spec.Min, spec.Max = parseBound(lo), parseBound(hi)
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+func parseBound(s string) float64 {
+	s = strings.TrimSpace(s)
+	sign := 1.0
+	if rest, ok := strings.CutPrefix(s, "-"); ok {
+		sign, s = -1, rest
+	}
+	switch s {
+	case "pi":
+		return sign * math.Pi
+	case "inf":
+		return math.Inf(int(sign))
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		panic(fmt.Sprintf("joint schema: bad bound %q", s))
+	}
+	return sign * v
+}
+
+// paramMap flattens a params struct into the map set_joint_params takes.
+func paramMap(params any) map[string]float64 {
+	v := reflect.ValueOf(params)
+	kind := JointKind("")
+	for k, t := range jointParamTypes {
+		if t == v.Type() {
+			kind = k
+		}
+	}
+	specs, _ := jointSchema(kind)
+	out := make(map[string]float64, len(specs))
+	for _, spec := range specs {
+		f := v.FieldByIndex(spec.field)
+		if spec.Bool {
+			out[spec.Name] = 0
+			if f.Bool() {
+				out[spec.Name] = 1
+			}
+		} else {
+			out[spec.Name] = f.Float()
+		}
+	}
+	return out
+}
+
+// validateJointKind checks that create_joint will understand the kind.
+func validateJointKind(kind JointKind) error {
+	if _, ok := jointParamTypes[kind]; ok {
+		return nil
+	}
+	kinds := make([]string, 0, len(jointParamTypes))
+	for k := range jointParamTypes {
+		kinds = append(kinds, string(k))
+	}
+	sort.Strings(kinds)
+	return fmt.Errorf("unknown joint type %q, want one of %s", kind, strings.Join(kinds, ", "))
+}
+
+// validateJointParams checks params against the kind's schema: every name
+// must exist, every value must be in range, and lower limits must not
+// exceed their upper limits. An empty kind accepts any parameter that some
+// kind defines, within that kind's range; it is used where the joint's kind
+// is not known, and still catches misspelled names.
+func validateJointParams(kind JointKind, params map[string]float64) error {
+	var specs []ParamSpec
+	if kind == "" {
+		for _, k := range sortedJointKinds() {
+			s, _ := jointSchema(k)
+			specs = append(specs, s...)
+		}
+	} else {
+		if err := validateJointKind(kind); err != nil {
+			return err
+		}
+		specs, _ = jointSchema(kind)
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var problems []string
+	for _, name := range names {
+		value := params[name]
+		var candidates []ParamSpec
+		for _, spec := range specs {
+			if spec.Name == name {
+				candidates = append(candidates, spec)
+			}
+		}
+		if len(candidates) == 0 {
+			problems = append(problems, unknownParam(kind, name, specs))
+			continue
+		}
+		ok := false
+		for _, spec := range candidates {
+			ok = ok || spec.allows(value)
+		}
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s = %g is out of range, want %s", name, value, candidates[0]))
+		}
+		for _, spec := range candidates {
+			if upper, has := params[spec.Upper]; has && spec.Upper != "" && value > upper {
+				problems = append(problems, fmt.Sprintf("%s = %g is above %s = %g", name, value, spec.Upper, upper))
+				break
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid joint params: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (p ParamSpec) allows(v float64) bool {
+	if math.IsNaN(v) {
+		return false
+	}
+	if p.Bool {
+		return v == 0 || v == 1
+	}
+	return v >= p.Min && v <= p.Max
+}
+
+func sortedJointKinds() []JointKind {
+	kinds := make([]JointKind, 0, len(jointParamTypes))
+	for k := range jointParamTypes {
+		kinds = append(kinds, k)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+	return kinds
+}
+
+// unknownParam explains a parameter name that is not in the schema,
+// suggesting the closest known name when it looks like a typo.
+func unknownParam(kind JointKind, name string, specs []ParamSpec) string {
+	best, bestDist := "", 4
+	for _, spec := range specs {
+		if d := editDistance(name, spec.Name); d < bestDist {
+			best, bestDist = spec.Name, d
+		}
+	}
+	msg := fmt.Sprintf("unknown param %q", name)
+	if kind != "" {
+		msg = fmt.Sprintf("%s joints have no param %q", kind, name)
+	}
+	if best != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", best)
+	}
+	return msg
+}
+
+// editDistance is the Levenshtein distance between two names.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
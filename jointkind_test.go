@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValidateJointParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    JointKind
+		params  map[string]float64
+		wantErr []string // all must appear; none means valid
+	}{
+		{name: "no params", kind: JointHinge},
+		{name: "hinge limits", kind: JointHinge, params: map[string]float64{"limit_lower": -1, "limit_upper": 1}},
+		{name: "hinge pi", kind: JointHinge, params: map[string]float64{"limit_lower": -math.Pi, "limit_upper": math.Pi}},
+		{name: "motor", kind: JointHinge, params: map[string]float64{"motor_enable": 1, "motor_target_velocity": -40, "motor_max_impulse": 1e9}},
+		{name: "6dof axis prefix", kind: JointGeneric6DOF, params: map[string]float64{"y_angular_motor_enable": 1, "z_linear_lower_limit": -2, "z_linear_upper_limit": 2}},
+		{name: "fixed takes none", kind: JointFixed},
+		{
+			name: "unknown kind", kind: "ball", params: map[string]float64{"bias": 0.5},
+			wantErr: []string{`unknown joint type "ball"`, "cone_twist, fixed, generic_6dof, hinge, pin, slider"},
+		},
+		{name: "misspelled", kind: JointHinge, params: map[string]float64{"limit_uper": 1}, wantErr: []string{"limit_uper"}},
+		{name: "other kind's param", kind: JointHinge, params: map[string]float64{"swing_span": 1}, wantErr: []string{"swing_span"}},
+		{name: "fixed with params", kind: JointFixed, params: map[string]float64{"bias": 0.5}, wantErr: []string{"bias"}},
+		{name: "6dof without prefix", kind: JointGeneric6DOF, params: map[string]float64{"angular_motor_enable": 1}, wantErr: []string{"angular_motor_enable"}},
+		{
+			name: "out of range", kind: JointHinge, params: map[string]float64{"bias": 2},
+			wantErr: []string{"bias = 2 is out of range, want bias [0, 1]"},
+		},
+		{
+			name: "angle past pi", kind: JointHinge, params: map[string]float64{"limit_upper": 4},
+			wantErr: []string{"limit_upper = 4 is out of range, want limit_upper [-π, π] rad"},
+		},
+		{name: "negative impulse", kind: JointHinge, params: map[string]float64{"motor_max_impulse": -1}, wantErr: []string{"motor_max_impulse = -1 is out of range"}},
+		{name: "bool", kind: JointHinge, params: map[string]float64{"motor_enable": 0.5}, wantErr: []string{"motor_enable = 0.5 is out of range, want motor_enable (0 or 1)"}},
+		{name: "NaN", kind: JointPin, params: map[string]float64{"damping": math.NaN()}, wantErr: []string{"damping = NaN is out of range"}},
+		{
+			name: "lower above upper", kind: JointHinge, params: map[string]float64{"limit_lower": 1, "limit_upper": -1},
+			wantErr: []string{"limit_lower = 1 is above limit_upper = -1"},
+		},
+		{
+			name: "6dof lower above upper", kind: JointGeneric6DOF, params: map[string]float64{"x_angular_lower_limit": 0.5, "x_angular_upper_limit": 0.2},
+			wantErr: []string{"x_angular_lower_limit = 0.5 is above x_angular_upper_limit = 0.2"},
+		},
+		{
+			name: "every problem reported", kind: JointSlider, params: map[string]float64{"bogus": 1, "angular_limit_softness": 20},
+			wantErr: []string{"bogus", "angular_limit_softness = 20 is out of range"},
+		},
+
+		// An empty kind is used where the joint's kind is unknown: any
+		// kind's param is allowed, within that kind's range.
+		{name: "any kind", params: map[string]float64{"swing_span": 1, "limit_upper": 1, "x_linear_motor_enable": 0}},
+		{name: "any kind, widest range", params: map[string]float64{"relaxation": 10}},
+		{name: "any kind, misspelled", params: map[string]float64{"motor_enabled": 1}, wantErr: []string{"motor_enabled"}},
+		{name: "any kind, out of every range", params: map[string]float64{"bias": -1}, wantErr: []string{"bias = -1 is out of range"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateJointParams(tt.kind, tt.params)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("validateJointParams: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("validateJointParams accepted %v", tt.params)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q lacks %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParamMap(t *testing.T) {
+	params := HingeParams{LimitLower: -1, LimitUpper: 1, MotorEnable: true}.Params()
+	if len(params) != 9 {
+		t.Errorf("%d hinge params, want 9: %v", len(params), params)
+	}
+	if params["limit_lower"] != -1 || params["limit_upper"] != 1 || params["motor_enable"] != 1 || params["bias"] != 0 {
+		t.Errorf("params = %v", params)
+	}
+	if err := validateJointParams(JointHinge, params); err != nil {
+		t.Errorf("a hinge's own params do not validate: %v", err)
+	}
+	axes := Generic6DOFParams{Y: Generic6DOFAxis{AngularMotorEnable: true}}.Params()
+	if len(axes) != 36 || axes["y_angular_motor_enable"] != 1 {
+		t.Errorf("6dof params = %v", axes)
+	}
+}
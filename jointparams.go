@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// getJointParams asks the server for a joint's current params. Besides the
+// settable ones the server may report read-only values such as "angle".
+func getJointParams(conn net.Conn, jointName string) (map[string]float64, error) {
+	cmd := Message{
+		"type":       "get_joint_params",
+		"joint_name": jointName,
+	}
+	if err := sendJSONMessage(conn, cmd); err != nil {
+		return nil, fmt.Errorf("[getJointParams] Failed to send command for %s: %v", jointName, err)
+	}
+	resp, err := readResponse(conn)
+	if err != nil {
+		return nil, fmt.Errorf("[getJointParams] Read error for %s: %v", jointName, err)
+	}
+	var reply struct {
+		Type    string             `json:"type"`
+		Message string             `json:"message"`
+		Params  map[string]float64 `json:"params"`
+	}
+	if err := json.Unmarshal([]byte(resp), &reply); err != nil {
+		return nil, fmt.Errorf("[getJointParams] Unreadable reply for %s: %q", jointName, resp)
+	}
+	if reply.Type == "error" {
+		return nil, fmt.Errorf("[getJointParams] %s: %s", jointName, reply.Message)
+	}
+	return reply.Params, nil
+}
+
+// ParamMismatch is a joint param that reads back different from what was
+// written, or not at all.
+type ParamMismatch struct {
+	Joint   string
+	Param   string
+	Want    float64
+	Got     float64
+	Missing bool // the server did not report the param
+}
+
+func (m ParamMismatch) String() string {
+	if m.Missing {
+		return fmt.Sprintf("%s: %s = %g was not reported back", m.Joint, m.Param, m.Want)
+	}
+	return fmt.Sprintf("%s: %s wrote %g, reads %g", m.Joint, m.Param, m.Want, m.Got)
+}
+
+// compareJointParams lists the wanted params that got does not match.
+// Servers store params as 32-bit floats, so small differences are allowed.
+func compareJointParams(joint string, want, got map[string]float64) []ParamMismatch {
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var mismatches []ParamMismatch
+	for _, name := range names {
+		value, ok := got[name]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, ParamMismatch{Joint: joint, Param: name, Want: want[name], Missing: true})
+		case math.Abs(value-want[name]) > 1e-4*max(1, math.Abs(want[name])):
+			mismatches = append(mismatches, ParamMismatch{Joint: joint, Param: name, Want: want[name], Got: value})
+		}
+	}
+	return mismatches
+}
+
+// verifyJointParams reads a joint's params back and compares them with what
+// was just written.
+func verifyJointParams(conn net.Conn, jointName string, params map[string]float64) ([]ParamMismatch, error) {
+	got, err := getJointParams(conn, jointName)
+	if err != nil {
+		return nil, err
+	}
+	return compareJointParams(jointName, params, got), nil
+}
+
+// writeJointParams sets params on each joint over one connection and, in
+// verify mode, reads every joint back. Joints the server refused or could
+// not be sent, and in verify mode all mismatches, are reported together as
+// one error.
+func (s *Session) writeJointParams(params map[string]map[string]float64) error {
+	conn, err := s.connect()
+	if err != nil {
+		return fmt.Errorf("[setJointParams] %v", err)
+	}
+	defer conn.Close()
+
+	joints := make([]string, 0, len(params))
+	for joint := range params {
+		joints = append(joints, joint)
+	}
+	sort.Strings(joints)
+	var problems []string
+	for _, joint := range joints {
+		if err := setJointParams(conn, joint, params[joint]); err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if !s.VerifyParams {
+			continue
+		}
+		mismatches, err := verifyJointParams(conn, joint, params[joint])
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		for _, m := range mismatches {
+			fmt.Println("[verify] ⚠️", m)
+			problems = append(problems, m.String())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("[setJointParams] %d joint params did not take: %s", len(problems), strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// JointParamsReport is one joint's params as the server reports them, next
+// to what the creature defines.
+type JointParamsReport struct {
+	Joint      string             `json:"joint"`
+	Type       JointKind          `json:"type"`
+	Params     map[string]float64 `json:"params,omitempty"`
+	Defined    map[string]float64 `json:"defined,omitempty"`
+	Mismatches []ParamMismatch    `json:"-"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// dumpJointParams reads the params of every joint the creature defines.
+func (s *Session) dumpJointParams(c *Creature) ([]JointParamsReport, error) {
+	conn, err := s.connect()
+	if err != nil {
+		return nil, fmt.Errorf("[dumpJointParams] %v", err)
+	}
+	defer conn.Close()
+
+	inst := c.instance()
+	reports := make([]JointParamsReport, 0, len(c.Joints))
+	for _, joint := range c.Joints {
+		name := inst.Name(joint.Name)
+		report := JointParamsReport{Joint: name, Type: joint.Type, Defined: joint.Params}
+		got, err := getJointParams(conn, name)
+		if err != nil {
+			report.Error = err.Error()
+		} else {
+			report.Params = got
+			report.Mismatches = compareJointParams(name, joint.Params, got)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// writeJointParamsReport prints reports as one block per joint, flagging
+// values that differ from the definition.
+func writeJointParamsReport(w io.Writer, reports []JointParamsReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%s (%s)\n", r.Joint, r.Type)
+		if r.Error != "" {
+			fmt.Fprintf(tw, "  ! %s\n", r.Error)
+			continue
+		}
+		off := make(map[string]ParamMismatch, len(r.Mismatches))
+		for _, m := range r.Mismatches {
+			off[m.Param] = m
+		}
+		names := make([]string, 0, len(r.Params)+len(off))
+		for name := range r.Params {
+			names = append(names, name)
+		}
+		for name, m := range off {
+			if m.Missing {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			m, bad := off[name]
+			switch {
+			case bad && m.Missing:
+				fmt.Fprintf(tw, "  %s\t-\t≠ %g defined\n", name, m.Want)
+			case bad:
+				fmt.Fprintf(tw, "  %s\t%g\t≠ %g defined\n", name, r.Params[name], m.Want)
+			default:
+				fmt.Fprintf(tw, "  %s\t%g\t\n", name, r.Params[name])
+			}
+		}
+	}
+	return tw.Flush()
+}
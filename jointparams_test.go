@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompareJointParams(t *testing.T) {
+	tests := []struct {
+		name string
+		want map[string]float64
+		got  map[string]float64
+		out  []string
+	}{
+		{name: "equal", want: map[string]float64{"bias": 0.3}, got: map[string]float64{"bias": 0.3}},
+		{name: "none wanted", got: map[string]float64{"angle": 1}},
+		// What the server reports beyond the params written is ignored.
+		{name: "extra reported", want: map[string]float64{"bias": 0.3}, got: map[string]float64{"bias": 0.3, "angle": 1.2}},
+		{name: "float32 rounding", want: map[string]float64{"bias": 0.1, "motor_max_impulse": 1e9}, got: map[string]float64{"bias": float64(float32(0.1)), "motor_max_impulse": float64(float32(1e9))}},
+		{name: "relative tolerance", want: map[string]float64{"motor_max_impulse": 10000}, got: map[string]float64{"motor_max_impulse": 10000.5}},
+		{name: "absolute tolerance near zero", want: map[string]float64{"limit_lower": 0}, got: map[string]float64{"limit_lower": 5e-5}},
+		{
+			name: "off",
+			want: map[string]float64{"limit_lower": 0},
+			got:  map[string]float64{"limit_lower": 0.001},
+			out:  []string{"j: limit_lower wrote 0, reads 0.001"},
+		},
+		{
+			name: "sorted, missing and wrong",
+			want: map[string]float64{"softness": 1, "bias": 0.3, "limit_upper": 1},
+			got:  map[string]float64{"limit_upper": -1, "softness": 1},
+			out:  []string{"j: bias = 0.3 was not reported back", "j: limit_upper wrote 1, reads -1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out []string
+			for _, m := range compareJointParams("j", tt.want, tt.got) {
+				out = append(out, m.String())
+			}
+			if strings.Join(out, "\n") != strings.Join(tt.out, "\n") {
+				t.Errorf("mismatches = %q, want %q", out, tt.out)
+			}
+		})
+	}
+}
+
+func TestWriteJointParamsVerify(t *testing.T) {
+	// The server keeps params as 32-bit floats and silently drops bias.
+	var mu sync.Mutex
+	stored := make(map[string]map[string]float64)
+	startFakeServer(t, func(msg Message) Message {
+		mu.Lock()
+		defer mu.Unlock()
+		joint := msg["joint_name"].(string)
+		switch msg["type"] {
+		case "set_joint_params":
+			if joint == "gone" {
+				return Message{"type": "error", "message": "no such joint"}
+			}
+			params := make(map[string]float64)
+			for name, v := range msg["params"].(map[string]any) {
+				if name != "bias" {
+					params[name] = float64(float32(v.(float64)))
+				}
+			}
+			stored[joint] = params
+			return Message{"type": "joint_params_set"}
+		case "get_joint_params":
+			return Message{"type": "joint_params", "params": stored[joint]}
+		}
+		return Message{"type": "error", "message": "unexpected"}
+	})
+
+	s := newSession("pipe", "pw")
+	params := map[string]map[string]float64{
+		"hip":  {"limit_lower": -0.1, "limit_upper": 0.1},
+		"knee": {"limit_upper": 0.7, "bias": 0.3},
+		"gone": {"bias": 0.5},
+	}
+	if err := s.writeJointParams(params); err == nil || strings.Contains(err.Error(), "knee") {
+		t.Errorf("without verify err = %v, want only the refused joint", err)
+	}
+
+	s.VerifyParams = true
+	err := s.writeJointParams(params)
+	if err == nil {
+		t.Fatal("verify accepted a dropped param")
+	}
+	for _, want := range []string{"2 joint params did not take", "gone: server refused: no such joint", "knee: bias = 0.3 was not reported back"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("err = %v, lacks %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "hip") {
+		t.Errorf("err = %v, blames hip for float32 rounding", err)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// defaultManifestDir is where sessions record what they spawned.
+const defaultManifestDir = ".pixel/manifests"
+
+// Manifest is the on-disk record of everything a session has spawned and
+// linked. It is rewritten on every change and removed once the session has
+// cleaned up, so any manifest left behind belongs to a run that crashed.
+type Manifest struct {
+	Addr    string     `json:"addr"`
+	PID     int        `json:"pid"`
+	Started time.Time  `json:"started"`
+	Cubes   []string   `json:"cubes"`
+	Links   []CubeLink `json:"links"`
+}
+
+// enableManifest starts recording the session to a manifest file in dir.
+func (s *Session) enableManifest(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("[Manifest] Failed to create %s: %v", dir, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = time.Now()
+	s.manifestPath = filepath.Join(dir, fmt.Sprintf("session-%d-%d.json", os.Getpid(), s.started.Unix()))
+	return s.saveManifestLocked()
+}
+
+// saveManifestLocked writes the manifest if one is enabled. The caller must
+// hold s.mu.
+func (s *Session) saveManifestLocked() error {
+	if s.manifestPath == "" {
+		return nil
+	}
+	manifest := Manifest{
+		Addr:    s.Addr,
+		PID:     os.Getpid(),
+		Started: s.started,
+		Links:   s.links,
+	}
+	for _, cube := range s.cubes {
+		manifest.Cubes = append(manifest.Cubes, cube.Name)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename so a crash mid-write never leaves a torn manifest.
+	tmp := s.manifestPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("[Manifest] Failed to write %s: %v", tmp, err)
+	}
+	return os.Rename(tmp, s.manifestPath)
+}
+
+// close despawns everything the session spawned and removes its manifest.
+// It is safe to call more than once.
+func (s *Session) close() {
+	s.closeOnce.Do(func() {
+		s.despawnAllCubes()
+
+		// Anything that failed to despawn stays in the manifest for the
+		// recover command.
+		s.mu.Lock()
+		path := s.manifestPath
+		done := len(s.cubes) == 0
+		if done {
+			s.manifestPath = ""
+		}
+		s.mu.Unlock()
+
+		if path != "" && done {
+			os.Remove(path)
+		}
+	})
+}
+
+// cleanupOnExit closes the session when the process receives SIGINT or
+// SIGTERM, then exits.
+func (s *Session) cleanupOnExit() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		fmt.Printf("[Session] Caught %v, despawning everything...\n", sig)
+		s.close()
+		os.Exit(1)
+	}()
+}
+
+// closeOnPanic is meant to be deferred in main. It cleans up the session if
+// main panics and then re-panics. Panics in other goroutines cannot be caught
+// here; their cubes are left for the recover command via the manifest.
+func (s *Session) closeOnPanic() {
+	if r := recover(); r != nil {
+		fmt.Println("[Session] Panic, despawning everything:", r)
+		s.close()
+		panic(r)
+	}
+}
+
+// loadManifests reads every manifest in dir.
+func loadManifests(dir string) (map[string]Manifest, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	manifests := make(map[string]Manifest)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("[Manifest] Failed to read %s: %v", path, err)
+		}
+		var manifest Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("[Manifest] Failed to parse %s: %v", path, err)
+		}
+		manifests[path] = manifest
+	}
+	return manifests, nil
+}
+
+// processAlive reports whether a process with the given pid is still running.
+func processAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return proc.Signal(syscall.Signal(0)) == nil
+}
+
+// recoverOrphans despawns the cubes recorded in manifests left behind by
+// crashed runs. Manifests owned by a process that is still alive are skipped
+// unless force is set.
+func recoverOrphans(dir, password string, force bool) error {
+	manifests, err := loadManifests(dir)
+	if err != nil {
+		return err
+	}
+	if len(manifests) == 0 {
+		fmt.Println("[Recover] No leftover manifests in", dir)
+		return nil
+	}
+
+	for path, manifest := range manifests {
+		if !force && manifest.PID != os.Getpid() && processAlive(manifest.PID) {
+			fmt.Printf("[Recover] Skipping %s: process %d is still running\n", path, manifest.PID)
+			continue
+		}
+
+		fmt.Printf("[Recover] %s: despawning %d cubes on %s (run started %s)\n",
+			path, len(manifest.Cubes), manifest.Addr, manifest.Started.Format(time.RFC3339))
+		orphans := newSession(manifest.Addr, password)
+		cubes := make([]Cube, len(manifest.Cubes))
+		for i, name := range manifest.Cubes {
+			cubes[i] = Cube{Name: name}
+		}
+		orphans.trackCubes(cubes)
+		orphans.despawnAllCubes()
+
+		if left := orphans.CubeNames(); len(left) > 0 {
+			fmt.Printf("[Recover] %d cubes could not be despawned, keeping %s\n", len(left), path)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("[Recover] Failed to remove %s: %v", path, err)
+		}
+	}
+	return nil
+}
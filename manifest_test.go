@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// okReply answers every command with success.
+func okReply(Message) Message { return Message{"type": "ok"} }
+
+func TestManifestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	s := newSession("example:1", "pw")
+	if err := s.enableManifest(dir); err != nil {
+		t.Fatal(err)
+	}
+	s.trackCubes([]Cube{{Name: "a_BASE"}, {Name: "b_BASE"}})
+	s.trackLink(CubeLink{JointName: "ab", CubeA: "a_BASE", CubeB: "b_BASE", Type: JointHinge})
+
+	manifests, err := loadManifests(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 1 {
+		t.Fatalf("%d manifests, want 1", len(manifests))
+	}
+	for path, m := range manifests {
+		if filepath.Dir(path) != dir || m.Addr != "example:1" || m.PID != os.Getpid() || m.Started.IsZero() {
+			t.Errorf("manifest %s = %+v", path, m)
+		}
+		if !slices.Equal(m.Cubes, []string{"a_BASE", "b_BASE"}) {
+			t.Errorf("cubes = %v", m.Cubes)
+		}
+		if len(m.Links) != 1 || m.Links[0] != (CubeLink{JointName: "ab", CubeA: "a_BASE", CubeB: "b_BASE", Type: JointHinge}) {
+			t.Errorf("links = %+v", m.Links)
+		}
+	}
+
+	// Untracking rewrites it.
+	s.untrackCubes([]string{"a_BASE"})
+	manifests, _ = loadManifests(dir)
+	for _, m := range manifests {
+		if !slices.Equal(m.Cubes, []string{"b_BASE"}) || len(m.Links) != 0 {
+			t.Errorf("after untracking a: %+v", m)
+		}
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(tmp) > 0 {
+		t.Errorf("left temporary files %v", tmp)
+	}
+}
+
+func TestLoadManifestsBadFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o644)
+	if _, err := loadManifests(dir); err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Errorf("err = %v, want the broken manifest named", err)
+	}
+}
+
+func TestSessionClose(t *testing.T) {
+	f := startFakeServer(t, okReply)
+	dir := t.TempDir()
+	s := newSession("pipe", "pw")
+	if err := s.enableManifest(dir); err != nil {
+		t.Fatal(err)
+	}
+	s.trackCubes([]Cube{{Name: "a_BASE"}, {Name: "b_BASE"}})
+	s.close()
+	s.close()
+
+	if got, want := f.commands(), []string{"despawn_cube a_BASE", "despawn_cube b_BASE"}; !slices.Equal(got, want) {
+		t.Errorf("server got %q, want %q", got, want)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "*")); len(left) > 0 {
+		t.Errorf("close left %v behind", left)
+	}
+}
+
+func TestRecoverOrphans(t *testing.T) {
+	// crashed leaves a manifest for cubes a and b as a run by pid would.
+	crashed := func(t *testing.T, pid int) string {
+		dir := t.TempDir()
+		data, _ := json.Marshal(Manifest{Addr: "pipe", PID: pid, Started: time.Now(), Cubes: []string{"a_BASE", "b_BASE"}})
+		if err := os.WriteFile(filepath.Join(dir, "session.json"), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+
+	t.Run("owner alive", func(t *testing.T) {
+		f := startFakeServer(t, okReply)
+		dir := crashed(t, os.Getppid())
+		if err := recoverOrphans(dir, "pw", false); err != nil {
+			t.Fatal(err)
+		}
+		if got := f.commands(); len(got) != 0 {
+			t.Errorf("despawned %q from a live run", got)
+		}
+		if left, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(left) != 1 {
+			t.Errorf("manifests = %v, want it kept", left)
+		}
+	})
+
+	t.Run("owner gone", func(t *testing.T) {
+		cmd := exec.Command("true")
+		if err := cmd.Run(); err != nil {
+			t.Skip(err)
+		}
+		f := startFakeServer(t, okReply)
+		dir := crashed(t, cmd.Process.Pid)
+		if err := recoverOrphans(dir, "pw", false); err != nil {
+			t.Fatal(err)
+		}
+		if got := f.commands(); len(got) != 2 {
+			t.Errorf("server got %q, want both cubes despawned", got)
+		}
+		if left, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(left) != 0 {
+			t.Errorf("manifests = %v, want it removed", left)
+		}
+	})
+
+	t.Run("owner alive, forced", func(t *testing.T) {
+		f := startFakeServer(t, okReply)
+		dir := crashed(t, os.Getppid())
+		if err := recoverOrphans(dir, "pw", true); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := f.commands(), []string{"despawn_cube a_BASE", "despawn_cube b_BASE"}; !slices.Equal(got, want) {
+			t.Errorf("server got %q, want %q", got, want)
+		}
+		if left, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(left) != 0 {
+			t.Errorf("manifests = %v, want it removed", left)
+		}
+	})
+
+	t.Run("server down", func(t *testing.T) {
+		dir := crashed(t, os.Getpid())
+		orig := dial
+		dial = func(network, addr string) (net.Conn, error) { return nil, errors.New("refused") }
+		t.Cleanup(func() { dial = orig })
+		if err := recoverOrphans(dir, "pw", true); err != nil {
+			t.Fatal(err)
+		}
+		if left, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(left) != 1 {
+			t.Errorf("manifests = %v, want it kept for another try", left)
+		}
+	})
+}
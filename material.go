@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Palette maps material names to hex colors.
+type Palette map[string]string
+
+// defaultPalette is always available; creature palettes extend or override it.
+var defaultPalette = Palette{
+	"white":  "#FFFFFF",
+	"black":  "#000000",
+	"gray":   "#808080",
+	"red":    "#FF0000",
+	"green":  "#00FF00",
+	"blue":   "#0000FF",
+	"yellow": "#FFFF00",
+	"orange": "#FF8000",
+	"brown":  "#8B5A2B",
+	"pink":   "#FFC0CB",
+}
+
+// GradientDef spreads colors evenly along a chain of cubes. Stops may be hex
+// colors or palette names.
+type GradientDef struct {
+	Cubes []string `json:"cubes"`
+	Stops []string `json:"stops"`
+}
+
+// lookup resolves a palette name or hex color to a normalized "#RRGGBB".
+// Entries in p take precedence over defaultPalette.
+func (p Palette) lookup(color string) (string, error) {
+	if strings.HasPrefix(color, "#") {
+		if _, err := parseHex(color); err != nil {
+			return "", err
+		}
+		return strings.ToUpper(color), nil
+	}
+	if hex, ok := p[color]; ok {
+		return Palette(nil).lookup(hex)
+	}
+	if hex, ok := defaultPalette[color]; ok {
+		return hex, nil
+	}
+	return "", fmt.Errorf("unknown material %q", color)
+}
+
+// parseHex parses "#RRGGBB" into its red, green and blue components.
+func parseHex(hex string) ([3]uint8, error) {
+	var rgb [3]uint8
+	if len(hex) != 7 || hex[0] != '#' {
+		return rgb, fmt.Errorf("invalid hex color %q, want #RRGGBB", hex)
+	}
+	v, err := strconv.ParseUint(hex[1:], 16, 32)
+	if err != nil {
+		return rgb, fmt.Errorf("invalid hex color %q, want #RRGGBB", hex)
+	}
+	return [3]uint8{uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// formatHex renders an RGB triple as "#RRGGBB".
+func formatHex(r, g, b uint8) string {
+	return fmt.Sprintf("#%02X%02X%02X", r, g, b)
+}
+
+// gradient returns n colors spread evenly across the stops, interpolating
+// linearly in RGB.
+func gradient(stops []string, n int) ([]string, error) {
+	if len(stops) == 0 {
+		return nil, fmt.Errorf("gradient needs at least one stop")
+	}
+	rgbs := make([][3]uint8, len(stops))
+	for i, stop := range stops {
+		rgb, err := parseHex(stop)
+		if err != nil {
+			return nil, err
+		}
+		rgbs[i] = rgb
+	}
+
+	colors := make([]string, n)
+	for i := range colors {
+		t := 0.0
+		if n > 1 {
+			t = float64(i) / float64(n-1) * float64(len(rgbs)-1)
+		}
+		lo := int(math.Floor(t))
+		if lo >= len(rgbs)-1 {
+			lo = len(rgbs) - 1
+		}
+		hi := min(lo+1, len(rgbs)-1)
+		frac := t - float64(lo)
+		var mixed [3]uint8
+		for c := range mixed {
+			mixed[c] = uint8(math.Round(float64(rgbs[lo][c])*(1-frac) + float64(rgbs[hi][c])*frac))
+		}
+		colors[i] = formatHex(mixed[0], mixed[1], mixed[2])
+	}
+	return colors, nil
+}
+
+// resolveMaterials fills in each cube's Color from its Material and applies
+// the creature's gradients, using the creature palette on top of the default
+// one. Gradients win over per-cube materials.
+func (c *Creature) resolveMaterials() error {
+	for i := range c.Cubes {
+		cube := &c.Cubes[i]
+		if cube.Material != "" {
+			hex, err := c.Palette.lookup(cube.Material)
+			if err != nil {
+				return fmt.Errorf("cube %q: %v", cube.Name, err)
+			}
+			cube.Color = hex
+		} else if cube.Color != "" {
+			hex, err := c.Palette.lookup(cube.Color)
+			if err != nil {
+				return fmt.Errorf("cube %q: %v", cube.Name, err)
+			}
+			cube.Color = hex
+		}
+	}
+
+	index := make(map[string]int, len(c.Cubes))
+	for i, cube := range c.Cubes {
+		index[cube.Name] = i
+	}
+	for _, g := range c.Gradients {
+		stops := make([]string, len(g.Stops))
+		for i, stop := range g.Stops {
+			hex, err := c.Palette.lookup(stop)
+			if err != nil {
+				return fmt.Errorf("gradient: %v", err)
+			}
+			stops[i] = hex
+		}
+		colors, err := gradient(stops, len(g.Cubes))
+		if err != nil {
+			return err
+		}
+		for i, name := range g.Cubes {
+			idx, ok := index[name]
+			if !ok {
+				return fmt.Errorf("gradient references unknown cube %q", name)
+			}
+			c.Cubes[idx].Color = colors[i]
+		}
+	}
+	return nil
+}
+
+// setColors paints many cubes in one batch. colors maps server cube names to
+// "#RRGGBB".
+func (s *Session) setColors(colors map[string]string) error {
+	names := make([]string, 0, len(colors))
+	for name := range colors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]Message, len(names))
+	for i, name := range names {
+		msgs[i] = Message{
+			"type":      "set_color",
+			"cube_name": name,
+			"hex":       colors[name],
+		}
+	}
+	replies, err := s.requestBatch(msgs)
+	if len(replies) == 0 && err != nil {
+		return fmt.Errorf("[Color] Failed to send %d colors: %v", len(msgs), err)
+	}
+	refused := refusedReplies(replies)
+	var failed []string
+	for i, name := range names {
+		if msg, bad := refused[i]; bad {
+			failed = append(failed, fmt.Sprintf("%s: %s", name, msg))
+			continue
+		}
+		hex := colors[name]
+		s.updateCube(name, func(cube *Cube) { cube.Color = hex })
+	}
+	if err != nil {
+		return fmt.Errorf("[Color] %d of %d colors unconfirmed: %v", len(msgs)-len(replies), len(msgs), err)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("[Color] Server refused %d colors: %s", len(failed), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// paintCubes gives every listed cube the same color or palette material.
+func (s *Session) paintCubes(names []string, color string) error {
+	hex, err := Palette(nil).lookup(color)
+	if err != nil {
+		return fmt.Errorf("[Color] %v", err)
+	}
+	colors := make(map[string]string, len(names))
+	for _, name := range names {
+		colors[name] = hex
+	}
+	return s.setColors(colors)
+}
+
+// colorWhere paints every tracked cube for which match returns true.
+func (s *Session) colorWhere(match func(cube Cube) bool, color string) error {
+	var names []string
+	for _, cube := range s.Cubes() {
+		if match(cube) {
+			names = append(names, cube.Name)
+		}
+	}
+	return s.paintCubes(names, color)
+}
+
+// colorGroup paints every tracked cube in the group.
+func (s *Session) colorGroup(group, color string) error {
+	return s.colorWhere(func(cube Cube) bool { return cube.Group == group }, color)
+}
+
+// colorChain spreads a gradient along a chain of server cube names.
+func (s *Session) colorChain(chain []string, stops ...string) error {
+	hexStops := make([]string, len(stops))
+	for i, stop := range stops {
+		hex, err := Palette(nil).lookup(stop)
+		if err != nil {
+			return fmt.Errorf("[Color] %v", err)
+		}
+		hexStops[i] = hex
+	}
+	colors, err := gradient(hexStops, len(chain))
+	if err != nil {
+		return fmt.Errorf("[Color] %v", err)
+	}
+	byName := make(map[string]string, len(chain))
+	for i, name := range chain {
+		byName[name] = colors[i]
+	}
+	return s.setColors(byName)
+}
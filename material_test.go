@@ -0,0 +1,130 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGradient(t *testing.T) {
+	tests := []struct {
+		name    string
+		stops   []string
+		n       int
+		want    []string
+		wantErr string
+	}{
+		{name: "two stops", stops: []string{"#000000", "#FF0000"}, n: 3, want: []string{"#000000", "#800000", "#FF0000"}},
+		{
+			name:  "three stops",
+			stops: []string{"#FF0000", "#00FF00", "#0000FF"},
+			n:     5,
+			want:  []string{"#FF0000", "#808000", "#00FF00", "#008080", "#0000FF"},
+		},
+		{name: "fewer cubes than stops", stops: []string{"#FF0000", "#00FF00", "#0000FF"}, n: 2, want: []string{"#FF0000", "#0000FF"}},
+		{name: "one cube takes the first stop", stops: []string{"#102030", "#FFFFFF"}, n: 1, want: []string{"#102030"}},
+		{name: "one stop", stops: []string{"#ABCDEF"}, n: 3, want: []string{"#ABCDEF", "#ABCDEF", "#ABCDEF"}},
+		{name: "no cubes", stops: []string{"#000000"}, n: 0, want: []string{}},
+		{name: "no stops", n: 3, wantErr: "at least one stop"},
+		{name: "bad stop", stops: []string{"#000000", "red"}, n: 2, wantErr: `invalid hex color "red"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := gradient(tt.stops, tt.n)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("gradient = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaletteLookup(t *testing.T) {
+	p := Palette{"fur": "#8b5a2b", "alias": "red", "red": "#AA0000", "bad": "#12"}
+	tests := []struct {
+		color   string
+		want    string
+		wantErr string
+	}{
+		{color: "#ff8000", want: "#FF8000"},
+		{color: "yellow", want: "#FFFF00"},
+		{color: "fur", want: "#8B5A2B"},
+		{color: "red", want: "#AA0000"},
+		// An entry naming another material resolves through the defaults
+		// only, so it cannot loop.
+		{color: "alias", want: "#FF0000"},
+		{color: "#12345", wantErr: `invalid hex color "#12345"`},
+		{color: "#12345G", wantErr: "invalid hex color"},
+		{color: "bad", wantErr: `invalid hex color "#12"`},
+		{color: "mauve", wantErr: `unknown material "mauve"`},
+	}
+	for _, tt := range tests {
+		got, err := p.lookup(tt.color)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("lookup(%q) = %q, %v, want %q", tt.color, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("lookup(%q) = %q, %v, want %q", tt.color, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveMaterials(t *testing.T) {
+	c := &Creature{
+		Palette: Palette{"fur": "#8B5A2B"},
+		Cubes: []Cube{
+			{Name: "a", Material: "fur"},
+			{Name: "b", Color: "blue"},
+			{Name: "c", Material: "fur"},
+			{Name: "d"},
+		},
+		Gradients: []GradientDef{{Cubes: []string{"c", "d"}, Stops: []string{"black", "white"}}},
+	}
+	if err := c.resolveMaterials(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, cube := range c.Cubes {
+		got = append(got, cube.Color)
+	}
+	if want := []string{"#8B5A2B", "#0000FF", "#000000", "#FFFFFF"}; !slices.Equal(got, want) {
+		t.Errorf("colors = %v, want %v", got, want)
+	}
+
+	c.Gradients = []GradientDef{{Cubes: []string{"a", "z"}, Stops: []string{"red"}}}
+	if err := c.resolveMaterials(); err == nil || !strings.Contains(err.Error(), `unknown cube "z"`) {
+		t.Errorf("err = %v, want the unknown cube", err)
+	}
+}
+
+func TestSetColors(t *testing.T) {
+	f := startFakeServer(t, func(msg Message) Message {
+		if msg["cube_name"] == "b_BASE" {
+			return Message{"type": "error", "message": "no such cube"}
+		}
+		return Message{"type": "color_set"}
+	})
+	s := newSession("pipe", "pw")
+	s.trackCubes([]Cube{{Name: "a_BASE"}, {Name: "b_BASE"}})
+	err := s.setColors(map[string]string{"a_BASE": "#FF0000", "b_BASE": "#00FF00"})
+	if err == nil || !strings.Contains(err.Error(), "b_BASE: no such cube") {
+		t.Errorf("err = %v, want b refused", err)
+	}
+	if cubes := s.Cubes(); cubes[0].Color != "#FF0000" || cubes[1].Color != "" {
+		t.Errorf("tracked colors %q and %q, want only a's", cubes[0].Color, cubes[1].Color)
+	}
+	if got := f.commands(); !slices.Equal(got, []string{"set_color a_BASE", "set_color b_BASE"}) {
+		t.Errorf("server got %q", got)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mesh is a triangle soup, Y up.
+type Mesh struct {
+	Triangles [][3][3]float64
+}
+
+// loadMesh reads a Wavefront OBJ or an ASCII or binary STL file. zUp converts
+// from Z-up files (common for STL exports from CAD tools) to Y-up.
+func loadMesh(path string, zUp bool) (*Mesh, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[Mesh] %v", err)
+	}
+	var mesh *Mesh
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".obj":
+		mesh, err = parseOBJ(data)
+	case ".stl":
+		mesh, err = parseSTL(data)
+	default:
+		return nil, fmt.Errorf("[Mesh] %s: unsupported format, want .obj or .stl", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[Mesh] %s: %v", path, err)
+	}
+	if len(mesh.Triangles) == 0 {
+		return nil, fmt.Errorf("[Mesh] %s: no triangles", path)
+	}
+	if zUp {
+		for i := range mesh.Triangles {
+			for j, v := range mesh.Triangles[i] {
+				mesh.Triangles[i][j] = [3]float64{v[0], v[2], -v[1]}
+			}
+		}
+	}
+	return mesh, nil
+}
+
+// parseOBJ reads the vertices and faces of an OBJ file. Polygons are split
+// into triangle fans; normals, texture coordinates and materials are ignored.
+func parseOBJ(data []byte) (*Mesh, error) {
+	mesh := &Mesh{}
+	var vertices [][3]float64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "v":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: vertex needs x y z", line)
+			}
+			var v [3]float64
+			for i := range v {
+				f, err := strconv.ParseFloat(fields[i+1], 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+				v[i] = f
+			}
+			vertices = append(vertices, v)
+		case "f":
+			var face [][3]float64
+			for _, ref := range fields[1:] {
+				// "7", "7/1" and "7/1/3" all name vertex 7; negative
+				// indices count back from the latest vertex.
+				idx, err := strconv.Atoi(strings.SplitN(ref, "/", 2)[0])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: bad face vertex %q", line, ref)
+				}
+				if idx < 0 {
+					idx += len(vertices) + 1
+				}
+				if idx < 1 || idx > len(vertices) {
+					return nil, fmt.Errorf("line %d: face vertex %d out of range", line, idx)
+				}
+				face = append(face, vertices[idx-1])
+			}
+			for i := 1; i+1 < len(face); i++ {
+				mesh.Triangles = append(mesh.Triangles, [3][3]float64{face[0], face[i], face[i+1]})
+			}
+		}
+	}
+	return mesh, scanner.Err()
+}
+
+// parseSTL reads a binary STL, or an ASCII one if the size does not match the
+// binary layout.
+func parseSTL(data []byte) (*Mesh, error) {
+	if len(data) >= 84 {
+		n := binary.LittleEndian.Uint32(data[80:84])
+		if uint64(len(data)) == 84+50*uint64(n) {
+			mesh := &Mesh{Triangles: make([][3][3]float64, n)}
+			for i := range mesh.Triangles {
+				// Each record is a normal, three vertices and an
+				// attribute count; only the vertices matter here.
+				rec := data[84+50*i+12:]
+				for v := 0; v < 3; v++ {
+					for c := 0; c < 3; c++ {
+						bits := binary.LittleEndian.Uint32(rec[12*v+4*c:])
+						mesh.Triangles[i][v][c] = float64(math.Float32frombits(bits))
+					}
+				}
+			}
+			return mesh, nil
+		}
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid")) {
+		return nil, fmt.Errorf("neither binary nor ASCII STL")
+	}
+	mesh := &Mesh{}
+	var tri [3][3]float64
+	n := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "vertex" {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: vertex needs x y z", line)
+		}
+		for c := 0; c < 3; c++ {
+			f, err := strconv.ParseFloat(fields[c+1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			tri[n][c] = f
+		}
+		if n++; n == 3 {
+			mesh.Triangles = append(mesh.Triangles, tri)
+			n = 0
+		}
+	}
+	return mesh, scanner.Err()
+}
+
+// bounds returns the mesh's axis-aligned bounding box.
+func (m *Mesh) bounds() (lo, hi [3]float64) {
+	lo = m.Triangles[0][0]
+	hi = lo
+	for _, tri := range m.Triangles {
+		for _, v := range tri {
+			for c := range v {
+				lo[c] = min(lo[c], v[c])
+				hi[c] = max(hi[c], v[c])
+			}
+		}
+	}
+	return lo, hi
+}
+
+// voxelize marks the cells of a grid that the mesh passes through. The grid
+// has resolution cells along the mesh's longest side. Triangles are sampled
+// at under half a cell apart, so thin features still leave a connected shell.
+// With solid set, cells enclosed by the shell are filled too, which needs a
+// mesh that is closed at this resolution; leaks simply leave it hollow.
+func (m *Mesh) voxelize(resolution int, solid bool) map[gridCell]bool {
+	lo, hi := m.bounds()
+	size := max(hi[0]-lo[0], hi[1]-lo[1], hi[2]-lo[2]) / float64(max(resolution, 1))
+	if size == 0 {
+		size = 1
+	}
+	var dims [3]int
+	for c := range dims {
+		dims[c] = max(1, int(math.Ceil((hi[c]-lo[c])/size)))
+	}
+	cellOf := func(p [3]float64) gridCell {
+		var idx [3]int
+		for c := range idx {
+			idx[c] = min(int((p[c]-lo[c])/size), dims[c]-1)
+		}
+		return gridCell{idx[0], idx[1], idx[2]}
+	}
+
+	cells := make(map[gridCell]bool)
+	for _, tri := range m.Triangles {
+		longest := 0.0
+		for i := range tri {
+			a, b := tri[i], tri[(i+1)%3]
+			longest = max(longest, math.Hypot(math.Hypot(a[0]-b[0], a[1]-b[1]), a[2]-b[2]))
+		}
+		steps := max(1, int(math.Ceil(longest/(size/2))))
+		for i := 0; i <= steps; i++ {
+			for j := 0; i+j <= steps; j++ {
+				u, v := float64(i)/float64(steps), float64(j)/float64(steps)
+				var p [3]float64
+				for c := range p {
+					p[c] = tri[0][c] + u*(tri[1][c]-tri[0][c]) + v*(tri[2][c]-tri[0][c])
+				}
+				cells[cellOf(p)] = true
+			}
+		}
+	}
+	if !solid {
+		return cells
+	}
+
+	// Flood the empty space from a one-cell border around the grid; whatever
+	// the flood cannot reach is inside.
+	outside := make(map[gridCell]bool)
+	queue := []gridCell{{-1, -1, -1}}
+	outside[queue[0]] = true
+	neighbors := []gridCell{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}}
+	for len(queue) > 0 {
+		at := queue[0]
+		queue = queue[1:]
+		for _, d := range neighbors {
+			next := gridCell{at.x + d.x, at.y + d.y, at.z + d.z}
+			if next.x < -1 || next.y < -1 || next.z < -1 ||
+				next.x > dims[0] || next.y > dims[1] || next.z > dims[2] ||
+				outside[next] || cells[next] {
+				continue
+			}
+			outside[next] = true
+			queue = append(queue, next)
+		}
+	}
+	for x := 0; x < dims[0]; x++ {
+		for y := 0; y < dims[1]; y++ {
+			for z := 0; z < dims[2]; z++ {
+				if at := (gridCell{x, y, z}); !outside[at] {
+					cells[at] = true
+				}
+			}
+		}
+	}
+	return cells
+}
+
+// MeshOptions controls how a mesh is voxelized into a creature.
+type MeshOptions struct {
+	VoxelOptions
+	Resolution int    // cells along the longest side, default 16
+	Solid      bool   // fill the inside instead of only the surface
+	Color      string // palette name or hex color for every cube, default gray
+}
+
+// meshCreature voxelizes a mesh into a creature of equally colored cubes.
+// Setting JointType to "fixed" makes the result one rigid body.
+func meshCreature(mesh *Mesh, opts MeshOptions) *Creature {
+	if opts.Resolution <= 0 {
+		opts.Resolution = 16
+	}
+	if opts.Color == "" {
+		opts.Color = "gray"
+	}
+	cells := make(map[gridCell]string)
+	for at := range mesh.voxelize(opts.Resolution, opts.Solid) {
+		cells[at] = "mesh"
+	}
+	return voxelCreature(cells, Palette{"mesh": opts.Color}, opts.VoxelOptions)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseOBJ(t *testing.T) {
+	square := "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\n"
+	tests := []struct {
+		name    string
+		data    string
+		want    [][3][3]float64
+		wantErr string
+	}{
+		{
+			name: "triangle",
+			data: "# a comment\nv 0 0 0\nv 1 0 0\nv 0 1 0\nvn 0 0 1\nf 1 2 3\n",
+			want: [][3][3]float64{{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}},
+		},
+		{
+			name: "quad as a fan",
+			data: square + "f 1 2 3 4\n",
+			want: [][3][3]float64{{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}}, {{0, 0, 0}, {1, 1, 0}, {0, 1, 0}}},
+		},
+		{
+			name: "texture and normal refs",
+			data: square + "vt 0 0\nf 1/1 2/1/1 3//1\n",
+			want: [][3][3]float64{{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}}},
+		},
+		{
+			name: "negative refs",
+			data: square + "f -4 -3 -2\n",
+			want: [][3][3]float64{{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}}},
+		},
+		{name: "no faces", data: square},
+		{name: "short vertex", data: "v 1 2\n", wantErr: "line 1: vertex needs x y z"},
+		{name: "bad number", data: "v 1 2 x\n", wantErr: "line 1:"},
+		{name: "bad ref", data: square + "f 1 two 3\n", wantErr: `line 5: bad face vertex "two"`},
+		{name: "ref out of range", data: square + "f 1 2 5\n", wantErr: "line 5: face vertex 5 out of range"},
+		{name: "zero ref", data: square + "f 0 1 2\n", wantErr: "face vertex 0 out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mesh, err := parseOBJ([]byte(tt.data))
+			checkMesh(t, mesh, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+// binarySTL encodes triangles as a binary STL.
+func binarySTL(tris [][3][3]float32) []byte {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 80))
+	binary.Write(&buf, binary.LittleEndian, uint32(len(tris)))
+	for _, tri := range tris {
+		binary.Write(&buf, binary.LittleEndian, [3]float32{0, 0, 1})
+		binary.Write(&buf, binary.LittleEndian, tri)
+		binary.Write(&buf, binary.LittleEndian, uint16(0))
+	}
+	return buf.Bytes()
+}
+
+func TestParseSTL(t *testing.T) {
+	ascii := `solid cube
+  facet normal 0 0 1
+    outer loop
+      vertex 0 0 0
+      vertex 1 0 0
+      vertex 0 1 0.5
+    endloop
+  endfacet
+endsolid cube
+`
+	tri := [3][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0.5}}
+	tests := []struct {
+		name    string
+		data    []byte
+		want    [][3][3]float64
+		wantErr string
+	}{
+		{name: "ascii", data: []byte(ascii), want: [][3][3]float64{{{0, 0, 0}, {1, 0, 0}, {0, 1, 0.5}}}},
+		{name: "ascii with leading space", data: []byte("\n  " + ascii), want: [][3][3]float64{{{0, 0, 0}, {1, 0, 0}, {0, 1, 0.5}}}},
+		{name: "binary", data: binarySTL([][3][3]float32{tri, tri}), want: [][3][3]float64{{{0, 0, 0}, {1, 0, 0}, {0, 1, 0.5}}, {{0, 0, 0}, {1, 0, 0}, {0, 1, 0.5}}}},
+		{name: "binary with no triangles", data: binarySTL(nil)},
+		// A header that happens to start with "solid" is still binary when
+		// the size fits.
+		{name: "binary named solid", data: append([]byte("solid"), binarySTL([][3][3]float32{tri})[5:]...), want: [][3][3]float64{{{0, 0, 0}, {1, 0, 0}, {0, 1, 0.5}}}},
+		{name: "binary cut short", data: binarySTL([][3][3]float32{tri})[:100], wantErr: "neither binary nor ASCII STL"},
+		{name: "ascii short vertex", data: []byte("solid x\nvertex 1 2\n"), wantErr: "line 2: vertex needs x y z"},
+		{name: "ascii bad number", data: []byte("solid x\nvertex 1 2 z\n"), wantErr: "line 2:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mesh, err := parseSTL(tt.data)
+			checkMesh(t, mesh, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func checkMesh(t *testing.T, mesh *Mesh, err error, want [][3][3]float64, wantErr string) {
+	t.Helper()
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("err = %v, want %q", err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("err = %v", err)
+	}
+	if len(mesh.Triangles) != len(want) {
+		t.Fatalf("%d triangles, want %d", len(mesh.Triangles), len(want))
+	}
+	for i, tri := range mesh.Triangles {
+		for v := range tri {
+			for c := range tri[v] {
+				if math.Abs(tri[v][c]-want[i][v][c]) > 1e-6 {
+					t.Errorf("triangle %d = %v, want %v", i, tri, want[i])
+				}
+			}
+		}
+	}
+}
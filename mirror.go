@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// MirrorDef generates the mirror image of a cube group across an
+// axis-aligned plane. The mirrored side is never written down: it is rebuilt
+// from the source group every time the creature is loaded, so editing the
+// source side edits both.
+type MirrorDef struct {
+	Group string  `json:"group"`
+	Axis  string  `json:"axis"` // "x", "y" or "z": the axis the plane cuts
+	At    float64 `json:"at"`   // where the plane cuts it
+	// Rename lists name substitutions that are applied both ways, so
+	// {"left": "right"} also turns "right" into "left". Defaults to
+	// left↔right and Left↔Right.
+	Rename map[string]string `json:"rename,omitempty"`
+}
+
+// replacer returns the two-way name substitution for the mirror.
+func (m MirrorDef) replacer() *strings.Replacer {
+	rename := m.Rename
+	if len(rename) == 0 {
+		rename = map[string]string{"left": "right", "Left": "Right"}
+	}
+	keys := make([]string, 0, len(rename))
+	for from := range rename {
+		keys = append(keys, from)
+	}
+	slices.Sort(keys)
+	var pairs []string
+	for _, from := range keys {
+		pairs = append(pairs, from, rename[from], rename[from], from)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// axisIndex maps the mirror axis to a coordinate index.
+func (m MirrorDef) axisIndex() (int, error) {
+	switch m.Axis {
+	case "x":
+		return 0, nil
+	case "y":
+		return 1, nil
+	case "z":
+		return 2, nil
+	}
+	return 0, fmt.Errorf("mirror of group %q: axis must be x, y or z, got %q", m.Group, m.Axis)
+}
+
+// reflect mirrors a position across the plane.
+func (m MirrorDef) reflect(p []float64, axis int) []float64 {
+	out := slices.Clone(p)
+	out[axis] = 2*m.At - p[axis]
+	return out
+}
+
+// reflectRotation mirrors an X-then-Y-then-Z rotation in degrees: the angle
+// about the mirror axis is kept and the other two change sign.
+func reflectRotation(rot []float64, axis int) []float64 {
+	if len(rot) != 3 {
+		return rot
+	}
+	out := make([]float64, 3)
+	for i := range out {
+		out[i] = -rot[i]
+	}
+	out[axis] = rot[axis]
+	return out
+}
+
+// expandMirrors adds the cubes, joints and gradients generated by the
+// creature's mirrors. A joint that leaves the source group attaches its
+// mirror to the cube found at the reflected position, if there is one, and
+// otherwise to the same cube; that is how a left leg's hip joint on one side
+// of the body becomes the right leg's hip joint on the other.
+func (c *Creature) expandMirrors() error {
+	for _, m := range c.Mirrors {
+		axis, err := m.axisIndex()
+		if err != nil {
+			return err
+		}
+		r := m.replacer()
+
+		names := make(map[string]string) // source cube -> mirrored cube
+		for _, cube := range c.Cubes {
+			if cube.Group == m.Group {
+				names[cube.Name] = r.Replace(cube.Name)
+			}
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("mirror of group %q: group has no cubes", m.Group)
+		}
+
+		var cubes []Cube
+		for _, cube := range c.Cubes {
+			if cube.Group != m.Group {
+				continue
+			}
+			mirrored := cube
+			mirrored.Name = names[cube.Name]
+			if mirrored.Name == cube.Name {
+				return fmt.Errorf("mirror of group %q: cube %q keeps its name; add a rename rule", m.Group, cube.Name)
+			}
+			if _, exists := c.cube(mirrored.Name); exists {
+				return fmt.Errorf("mirror of group %q generates cube %q, remove it from the definition", m.Group, mirrored.Name)
+			}
+			mirrored.Group = r.Replace(cube.Group)
+			mirrored.Position = m.reflect(cube.Position, axis)
+			mirrored.Rotation = reflectRotation(cube.Rotation, axis)
+			mirrored.Tags = slices.Clone(cube.Tags)
+			cubes = append(cubes, mirrored)
+		}
+
+		// partner finds what a cube outside the group maps to.
+		partner := func(name string) string {
+			cube, _ := c.cube(name)
+			want := m.reflect(cube.Position, axis)
+			for _, other := range c.Cubes {
+				if other.Group != m.Group && sameVec(other.Position, want) {
+					return other.Name
+				}
+			}
+			return name
+		}
+		var joints []JointDef
+		for _, joint := range c.Joints {
+			a, aIn := names[joint.CubeA]
+			b, bIn := names[joint.CubeB]
+			if !aIn && !bIn {
+				continue
+			}
+			if !aIn {
+				a = partner(joint.CubeA)
+			}
+			if !bIn {
+				b = partner(joint.CubeB)
+			}
+			mirrored := joint
+			mirrored.CubeA, mirrored.CubeB = a, b
+			frame := joint.JointFrame
+			if frame.Local && a == joint.CubeA {
+				// Cube A stays put, so its local frame has no mirror image;
+				// reflect the frame in world coordinates instead.
+				cube, _ := c.cube(joint.CubeA)
+				frame = frame.world(cube)
+			}
+			mirrored.JointFrame = frame.mirror(m, axis, joint.Type)
+			// Keep chainJoints-style names describing their cubes.
+			if joint.Name == fmt.Sprintf("joint_%s_%s", joint.CubeA, joint.CubeB) {
+				mirrored.Name = fmt.Sprintf("joint_%s_%s", a, b)
+			} else {
+				mirrored.Name = r.Replace(joint.Name)
+			}
+			if _, exists := c.joint(mirrored.Name); exists {
+				return fmt.Errorf("mirror of group %q generates joint %q, remove it from the definition", m.Group, mirrored.Name)
+			}
+			joints = append(joints, mirrored)
+		}
+
+		var gradients []GradientDef
+		for _, g := range c.Gradients {
+			mirrored := GradientDef{Stops: g.Stops}
+			for _, name := range g.Cubes {
+				if to, ok := names[name]; ok {
+					mirrored.Cubes = append(mirrored.Cubes, to)
+				}
+			}
+			if len(mirrored.Cubes) == len(g.Cubes) {
+				gradients = append(gradients, mirrored)
+			}
+		}
+
+		c.Cubes = append(c.Cubes, cubes...)
+		c.Joints = append(c.Joints, joints...)
+		c.Gradients = append(c.Gradients, gradients...)
+	}
+	return nil
+}
+
+// sameVec compares positions, ignoring floating-point noise from reflecting.
+func sameVec(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-6 {
+			return false
+		}
+	}
+	return true
+}
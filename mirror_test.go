@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// mirroredLeg is a body with a left leg that is mirrored across x = 0.
+func mirroredLeg(edit func(c *Creature)) *Creature {
+	c := &Creature{
+		Cubes: []Cube{
+			{Name: "body", Position: []float64{0, 0, 0}},
+			{Name: "lefthip", Position: []float64{-2, 0, 0}},
+			{Name: "righthip", Position: []float64{2, 0, 0}},
+			{Name: "leftthigh", Position: []float64{-2, -1, 0}, Rotation: []float64{10, 20, 30}, Group: "leftleg", Tags: []string{"leg"}},
+			{Name: "leftshin", Position: []float64{-2, -2, 1}, Group: "leftleg"},
+		},
+		Joints: []JointDef{
+			{
+				Name: "leftknee", CubeA: "leftthigh", CubeB: "leftshin", Type: JointHinge,
+				JointFrame: JointFrame{Anchor: []float64{-2, -1.5, 0.5}, Axis: []float64{0, 1, 0}},
+			},
+			{Name: "joint_lefthip_leftthigh", CubeA: "lefthip", CubeB: "leftthigh", Type: JointFixed},
+			{Name: "lefttether", CubeA: "body", CubeB: "leftshin", Type: JointSlider, JointFrame: JointFrame{Axis: []float64{1, 0, 0}}},
+		},
+		Gradients: []GradientDef{{Cubes: []string{"leftthigh", "leftshin"}, Stops: []string{"red", "blue"}}},
+		Mirrors:   []MirrorDef{{Group: "leftleg", Axis: "x"}},
+	}
+	if edit != nil {
+		edit(c)
+	}
+	return c
+}
+
+func TestExpandMirrors(t *testing.T) {
+	c := mirroredLeg(nil)
+	if err := c.expandMirrors(); err != nil {
+		t.Fatal(err)
+	}
+
+	var cubes []string
+	for _, cube := range c.Cubes[5:] {
+		cubes = append(cubes, fmt.Sprintf("%s %s %v %v %v", cube.Name, cube.Group, cube.Position, cube.Rotation, cube.Tags))
+	}
+	wantCubes := []string{
+		"rightthigh rightleg [2 -1 0] [10 -20 -30] [leg]",
+		"rightshin rightleg [2 -2 1] [] []",
+	}
+	if !slices.Equal(cubes, wantCubes) {
+		t.Errorf("mirrored cubes:\n  %s\nwant:\n  %s", strings.Join(cubes, "\n  "), strings.Join(wantCubes, "\n  "))
+	}
+
+	var joints []string
+	for _, joint := range c.Joints[3:] {
+		joints = append(joints, fmt.Sprintf("%s %s-%s %v %v", joint.Name, joint.CubeA, joint.CubeB, joint.Anchor, joint.Axis))
+	}
+	wantJoints := []string{
+		// A hinge axis is a rotation, so it flips the other way.
+		"rightknee rightthigh-rightshin [2 -1.5 0.5] [0 -1 0]",
+		// Joints leaving the group attach to the cube at the reflected
+		// position, or to the same cube when there is none.
+		"joint_righthip_rightthigh righthip-rightthigh [] []",
+		"righttether body-rightshin [] [-1 0 0]",
+	}
+	if !slices.Equal(joints, wantJoints) {
+		t.Errorf("mirrored joints:\n  %s\nwant:\n  %s", strings.Join(joints, "\n  "), strings.Join(wantJoints, "\n  "))
+	}
+
+	if len(c.Gradients) != 2 || !slices.Equal(c.Gradients[1].Cubes, []string{"rightthigh", "rightshin"}) {
+		t.Errorf("gradients = %+v", c.Gradients)
+	}
+}
+
+func TestExpandMirrorsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(c *Creature)
+		wantErr string
+	}{
+		{"bad axis", func(c *Creature) { c.Mirrors[0].Axis = "w" }, `axis must be x, y or z, got "w"`},
+		{"empty group", func(c *Creature) { c.Mirrors[0].Group = "arm" }, `mirror of group "arm": group has no cubes`},
+		{
+			"name kept",
+			func(c *Creature) { c.Mirrors[0].Rename = map[string]string{"thigh": "femur"}; c.Cubes[4].Name = "shin" },
+			`cube "shin" keeps its name`,
+		},
+		{
+			"cube written down",
+			func(c *Creature) { c.Cubes = append(c.Cubes, Cube{Name: "rightshin"}) },
+			`generates cube "rightshin", remove it`,
+		},
+		{
+			"joint written down",
+			func(c *Creature) {
+				c.Joints = append(c.Joints, JointDef{Name: "rightknee", CubeA: "body", CubeB: "lefthip"})
+			},
+			`generates joint "rightknee", remove it`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mirroredLeg(tt.edit).expandMirrors()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMirrorRename(t *testing.T) {
+	tests := []struct {
+		rename map[string]string
+		in     string
+		want   string
+	}{
+		{nil, "leftEar", "rightEar"},
+		{nil, "rightleftfoot", "leftrightfoot"},
+		{nil, "Left", "Right"},
+		{map[string]string{"port": "starboard"}, "starboard_fin", "port_fin"},
+		{map[string]string{"port": "starboard"}, "leftfin", "leftfin"},
+	}
+	for _, tt := range tests {
+		if got := (MirrorDef{Rename: tt.rename}).replacer().Replace(tt.in); got != tt.want {
+			t.Errorf("rename %v of %q = %q, want %q", tt.rename, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReflectRotation(t *testing.T) {
+	rot := []float64{10, 20, 30}
+	for axis, want := range [][]float64{{10, -20, -30}, {-10, 20, -30}, {-10, -20, 30}} {
+		if got := reflectRotation(rot, axis); !slices.Equal(got, want) {
+			t.Errorf("reflectRotation(%v, %d) = %v, want %v", rot, axis, got, want)
+		}
+	}
+	if got := reflectRotation(nil, 0); got != nil {
+		t.Errorf("reflectRotation(nil) = %v", got)
+	}
+}
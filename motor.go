@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"time"
+)
+
+// motorConn is one connection kept open for driving joint motors: every
+// tick it reads joint angles and sends velocities, each as one pipelined
+// round trip rather than a connection per command.
+type motorConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (s *Session) openMotorConn() (*motorConn, error) {
+	conn, err := s.connect()
+	if err != nil {
+		return nil, fmt.Errorf("[Motor] %v", err)
+	}
+	return &motorConn{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func (m *motorConn) Close() error {
+	return m.conn.Close()
+}
+
+// roundTrip sends msgs in one write and reads one reply per message.
+func (m *motorConn) roundTrip(msgs []Message) ([]string, error) {
+	data, err := encodeBatch(msgs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.conn.Write(data); err != nil {
+		return nil, fmt.Errorf("[Motor] %v", err)
+	}
+	replies := make([]string, len(msgs))
+	for i := range msgs {
+		m.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		if replies[i], err = readReply(m.reader); err != nil {
+			return nil, fmt.Errorf("[Motor] No reply after %d of %d commands: %v", i, len(msgs), err)
+		}
+	}
+	return replies, nil
+}
+
+// angles reads the current angle of each joint, in radians.
+func (m *motorConn) angles(joints []string) (map[string]float64, error) {
+	msgs := make([]Message, len(joints))
+	for i, joint := range joints {
+		msgs[i] = Message{"type": "get_joint_params", "joint_name": joint}
+	}
+	replies, err := m.roundTrip(msgs)
+	if err != nil {
+		return nil, err
+	}
+	angles := make(map[string]float64, len(joints))
+	for i, resp := range replies {
+		var reply struct {
+			Type    string             `json:"type"`
+			Message string             `json:"message"`
+			Params  map[string]float64 `json:"params"`
+		}
+		if err := json.Unmarshal([]byte(resp), &reply); err != nil {
+			return nil, fmt.Errorf("[Motor] Unreadable reply for %s: %q", joints[i], resp)
+		}
+		angle, ok := reply.Params["angle"]
+		if reply.Type == "error" || !ok {
+			return nil, fmt.Errorf("[Motor] No angle for %s: %s", joints[i], reply.Message)
+		}
+		angles[joints[i]] = angle
+	}
+	return angles, nil
+}
+
+// setParams sends each joint its params and checks every reply.
+func (m *motorConn) setParams(params map[string]map[string]float64) error {
+	joints := make([]string, 0, len(params))
+	for joint := range params {
+		joints = append(joints, joint)
+	}
+	sort.Strings(joints)
+	msgs := make([]Message, len(joints))
+	for i, joint := range joints {
+		msgs[i] = Message{"type": "set_joint_params", "joint_name": joint, "params": params[joint]}
+	}
+	replies, err := m.roundTrip(msgs)
+	if err != nil {
+		return err
+	}
+	for i, resp := range replies {
+		var reply struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal([]byte(resp), &reply) == nil && reply.Type == "error" {
+			return fmt.Errorf("[Motor] %s: %s", joints[i], reply.Message)
+		}
+	}
+	return nil
+}
+
+// velocityToward is the motor velocity that turns a joint from angle to want
+// in step, capped at maxVelocity either way.
+func velocityToward(angle, want float64, step time.Duration, maxVelocity float64) float64 {
+	v := (want - angle) / step.Seconds()
+	return math.Max(-maxVelocity, math.Min(maxVelocity, v))
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+	"time"
+)
+
+// PIDGains weigh a PID controller's terms: Kp turns angle error (rad) into
+// velocity (rad/s), Ki the error's integral, Kd its rate of change.
+type PIDGains struct {
+	Kp float64 `json:"kp"`
+	Ki float64 `json:"ki"`
+	Kd float64 `json:"kd"`
+}
+
+func (g PIDGains) String() string {
+	return fmt.Sprintf("kp %g ki %g kd %g", g.Kp, g.Ki, g.Kd)
+}
+
+// PID holds one joint at a target angle. The server's motors only take a
+// velocity, so each tick it reads the joint's angle and commands the
+// velocity its gains make of the error. Run it on a ControlLoop.
+//
+// The output is capped at MaxVelocity, and while it is capped the integral
+// only accumulates error that would bring it back: a joint held against a
+// limit or a load does not wind up a burst to release later. IntegralLimit
+// further caps the integral term alone.
+type PID struct {
+	Joint  string  // server name
+	Target float64 // rad
+	PIDGains
+	MaxVelocity   float64 // rad/s; default 6
+	IntegralLimit float64 // rad/s; zero means MaxVelocity
+	MaxImpulse    float64 // set on the motor when positive
+	// Once the joint has stayed within Tolerance (rad) of the target for
+	// Settle the controller is done and stops the motor. A zero Settle
+	// holds the target until the loop stops.
+	Tolerance float64
+	Settle    time.Duration
+
+	started   bool
+	integral  float64
+	lastAngle float64
+	settled   time.Duration
+}
+
+func newPID(joint string, target float64, gains PIDGains) *PID {
+	return &PID{Joint: joint, Target: target, PIDGains: gains, MaxVelocity: 6, Tolerance: 0.01}
+}
+
+// SetTarget moves the target. The integral is kept, so a joint under a
+// steady load keeps the velocity that was balancing it.
+func (c *PID) SetTarget(angle float64) {
+	c.Target = angle
+	c.settled = 0
+}
+
+func (c *PID) Joints() []string { return []string{c.Joint} }
+
+func (c *PID) Update(t Tick, cmds JointCommands) bool {
+	angle := t.Angles[c.Joint]
+	dt := t.Dt.Seconds()
+	if !c.started {
+		c.started, c.lastAngle = true, angle
+		cmds.set(c.Joint, "motor_enable", 1)
+		if c.MaxImpulse > 0 {
+			cmds.set(c.Joint, "motor_max_impulse", c.MaxImpulse)
+		}
+	}
+
+	e := c.Target - angle
+	if math.Abs(e) <= c.Tolerance {
+		c.settled += t.Dt
+	} else {
+		c.settled = 0
+	}
+	if c.Settle > 0 && c.settled >= c.Settle {
+		cmds.set(c.Joint, "motor_target_velocity", 0)
+		return true
+	}
+
+	// The derivative is taken on the angle rather than the error, so
+	// moving the target does not kick the motor.
+	rate := (angle - c.lastAngle) / dt
+	c.lastAngle = angle
+
+	maxV := c.MaxVelocity
+	if maxV <= 0 {
+		maxV = 6
+	}
+	limit := c.IntegralLimit
+	if limit <= 0 {
+		limit = maxV
+	}
+	integral := c.integral + e*dt
+	if c.Ki != 0 {
+		integral = math.Max(-limit/math.Abs(c.Ki), math.Min(limit/math.Abs(c.Ki), integral))
+	}
+	out := c.Kp*e + c.Ki*integral - c.Kd*rate
+	v := math.Max(-maxV, math.Min(maxV, out))
+	if v == out || math.Signbit(e) != math.Signbit(out) {
+		c.integral = integral
+	}
+	cmds.set(c.Joint, "motor_target_velocity", v)
+	return false
+}
+
+// StepResponse describes how a joint followed a step in its target, from
+// the samples taken on each tick.
+type StepResponse struct {
+	Gains     PIDGains
+	Rise      time.Duration // to first get 90% of the way
+	Overshoot float64       // rad past the target, at worst
+	Settled   time.Duration // from when it stayed within tolerance; -1 if it never did
+	Error     float64       // rad from the target at the end
+	Samples   []AngleSample
+}
+
+// AngleSample is a joint's angle at some time into a test.
+type AngleSample struct {
+	At    time.Duration
+	Angle float64
+}
+
+// measureStep works out a step response from start to target.
+func measureStep(samples []AngleSample, start, target, tolerance float64) StepResponse {
+	r := StepResponse{Rise: -1, Settled: -1, Samples: samples}
+	if len(samples) == 0 {
+		return r
+	}
+	span := target - start
+	for _, s := range samples {
+		moved := s.Angle - start
+		if r.Rise < 0 && span != 0 && moved/span >= 0.9 {
+			r.Rise = s.At
+		}
+		if span != 0 && (moved-span)/span > 0 {
+			r.Overshoot = math.Max(r.Overshoot, math.Abs(moved-span))
+		}
+		if math.Abs(s.Angle-target) > tolerance {
+			r.Settled = -1
+		} else if r.Settled < 0 {
+			r.Settled = s.At
+		}
+	}
+	r.Error = samples[len(samples)-1].Angle - target
+	return r
+}
+
+// stepTest runs a PID for a fixed time, sampling the joint's angle each
+// tick.
+type stepTest struct {
+	pid      *PID
+	duration time.Duration
+	start    float64
+	begin    time.Duration
+	samples  []AngleSample
+}
+
+func (st *stepTest) Joints() []string { return st.pid.Joints() }
+
+func (st *stepTest) Update(t Tick, cmds JointCommands) bool {
+	if st.samples == nil {
+		st.start, st.begin = t.Angles[st.pid.Joint], t.Elapsed
+		st.samples = []AngleSample{}
+	}
+	at := t.Elapsed - st.begin
+	st.samples = append(st.samples, AngleSample{At: at, Angle: t.Angles[st.pid.Joint]})
+	if at >= st.duration {
+		cmds.set(st.pid.Joint, "motor_target_velocity", 0)
+		return true
+	}
+	return st.pid.Update(t, cmds)
+}
+
+// tunePID steps a joint to target once per set of gains, resetting it to
+// where it started between trials, and returns each trial's response. run
+// runs controllers on a control loop: the server's or a simulated one.
+func tunePID(run func(...Controller) error, joint string, target float64, candidates []PIDGains, duration time.Duration, tolerance float64) ([]StepResponse, error) {
+	var responses []StepResponse
+	var home *float64
+	for _, gains := range candidates {
+		if home != nil {
+			back := newPID(joint, *home, PIDGains{Kp: 4})
+			back.Tolerance, back.Settle = tolerance, 200*time.Millisecond
+			if err := run(&stepTest{pid: back, duration: 3 * time.Second}); err != nil {
+				return responses, err
+			}
+		}
+		pid := newPID(joint, target, gains)
+		pid.Tolerance = tolerance
+		test := &stepTest{pid: pid, duration: duration}
+		if err := run(test); err != nil {
+			return responses, err
+		}
+		if home == nil {
+			home = &test.start
+		}
+		r := measureStep(test.samples, test.start, target, tolerance)
+		r.Gains = gains
+		responses = append(responses, r)
+	}
+	return responses, nil
+}
+
+// bestStep picks the response that settled soonest, preferring ones that
+// overshot by no more than the tolerance; nil if none settled.
+func bestStep(responses []StepResponse, tolerance float64) *StepResponse {
+	var best *StepResponse
+	for i := range responses {
+		r := &responses[i]
+		if r.Settled < 0 {
+			continue
+		}
+		calm := r.Overshoot <= tolerance
+		switch {
+		case best == nil:
+			best = r
+		case calm != (best.Overshoot <= tolerance):
+			if calm {
+				best = r
+			}
+		case r.Settled < best.Settled:
+			best = r
+		}
+	}
+	return best
+}
+
+// writeStepResponses prints one line per trial.
+func writeStepResponses(w io.Writer, responses []StepResponse) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "gains\trise\tovershoot\tsettled\tfinal error")
+	for _, r := range responses {
+		rise, settled := "-", "never"
+		if r.Rise >= 0 {
+			rise = r.Rise.Round(time.Millisecond).String()
+		}
+		if r.Settled >= 0 {
+			settled = r.Settled.Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.3f rad\t%s\t%+.4f rad\n", r.Gains, rise, r.Overshoot, settled, r.Error)
+	}
+	return tw.Flush()
+}
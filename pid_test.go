@@ -0,0 +1,171 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// stoppedJoints is laggyJoints with a hard stop at ±max rad, such as a
+// joint limit or an obstacle.
+type stoppedJoints struct {
+	*laggyJoints
+	max float64
+}
+
+func (sj *stoppedJoints) clamp() {
+	for joint, angle := range sj.angle {
+		sj.angle[joint] = math.Max(-sj.max, math.Min(sj.max, angle))
+	}
+}
+
+func (sj *stoppedJoints) angles(joints []string) (map[string]float64, error) {
+	sj.advance()
+	sj.clamp()
+	return sj.laggyJoints.angles(joints)
+}
+
+func (sj *stoppedJoints) setParams(params map[string]map[string]float64) error {
+	sj.advance()
+	sj.clamp()
+	return sj.laggyJoints.setParams(params)
+}
+
+func TestPID(t *testing.T) {
+	tests := []struct {
+		name          string
+		target        float64
+		gains         PIDGains
+		integralLimit float64
+		stop          float64 // hard stop at ±stop rad; zero for none
+		settle        time.Duration
+		limit         time.Duration
+		wantAngle     float64
+		wantMaxITerm  float64 // bound on |Ki·integral| at the end
+		wantDone      bool
+	}{
+		{
+			name: "settles", target: 1, gains: PIDGains{Kp: 4}, settle: 200 * time.Millisecond, limit: 10 * time.Second,
+			wantAngle: 1, wantDone: true,
+		},
+		{
+			name: "settles backward", target: -0.5, gains: PIDGains{Kp: 4, Ki: 0.5}, settle: 200 * time.Millisecond, limit: 10 * time.Second,
+			wantAngle: -0.5, wantMaxITerm: 6, wantDone: true,
+		},
+		// Held at 0.5 rad, Kp·e is 1 rad/s, so the integral stops growing
+		// once it brings the output to MaxVelocity; unchecked it would climb
+		// to the 6 rad/s cap IntegralLimit defaults to.
+		{
+			name: "no windup against a stop", target: 1, gains: PIDGains{Kp: 2, Ki: 5}, stop: 0.5, limit: 3 * time.Second,
+			wantAngle: 0.5, wantMaxITerm: 5,
+		},
+		{
+			name: "no windup against a stop backward", target: -1, gains: PIDGains{Kp: 2, Ki: 5}, stop: 0.5, limit: 3 * time.Second,
+			wantAngle: -0.5, wantMaxITerm: 5,
+		},
+		{
+			name: "integral limit", target: 1, gains: PIDGains{Kp: 2, Ki: 5}, integralLimit: 1, stop: 0.5, limit: 3 * time.Second,
+			wantAngle: 0.5, wantMaxITerm: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newSimClock()
+			var io jointIO
+			lj := newLaggyJoints(clock, 0)
+			io = lj
+			if tt.stop > 0 {
+				io = &stoppedJoints{laggyJoints: lj, max: tt.stop}
+			}
+			pid := newPID("j", tt.target, tt.gains)
+			pid.IntegralLimit, pid.Settle = tt.integralLimit, tt.settle
+			loop := newControlLoop(io, 50*time.Millisecond)
+			loop.Clock, loop.Limit = clock, tt.limit
+			loop.Register(pid)
+			if err := loop.Run(nil); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			if got := lj.angle["j"]; math.Abs(got-tt.wantAngle) > pid.Tolerance {
+				t.Errorf("angle %g, want %g", got, tt.wantAngle)
+			}
+			if term := math.Abs(pid.Ki * pid.integral); term > tt.wantMaxITerm+1e-9 {
+				t.Errorf("integral term %g rad/s, want at most %g", term, tt.wantMaxITerm)
+			}
+			if done := loop.Stats.Ticks < int(tt.limit/loop.Period); done != tt.wantDone {
+				t.Errorf("finished after %d ticks, want done %v", loop.Stats.Ticks, tt.wantDone)
+			}
+			for _, batch := range lj.sent {
+				if v := batch["j"]["motor_target_velocity"]; math.Abs(v) > pid.MaxVelocity {
+					t.Fatalf("commanded %g rad/s, above MaxVelocity %g", v, pid.MaxVelocity)
+				}
+			}
+		})
+	}
+}
+
+func TestMeasureStep(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name    string
+		target  float64
+		samples []AngleSample
+		want    StepResponse
+	}{
+		{
+			name:    "no samples",
+			target:  1,
+			samples: nil,
+			want:    StepResponse{Rise: -1, Settled: -1},
+		},
+		{
+			name:    "clean rise",
+			target:  1,
+			samples: []AngleSample{{0, 0}, {50 * ms, 0.5}, {100 * ms, 0.95}, {150 * ms, 1}},
+			want:    StepResponse{Rise: 100 * ms, Settled: 150 * ms},
+		},
+		{
+			name:    "overshoot and settle",
+			target:  1,
+			samples: []AngleSample{{0, 0}, {50 * ms, 1.2}, {100 * ms, 0.9}, {150 * ms, 1.005}, {200 * ms, 1}},
+			want:    StepResponse{Rise: 50 * ms, Overshoot: 0.2, Settled: 150 * ms},
+		},
+		{
+			name:    "downward",
+			target:  -1,
+			samples: []AngleSample{{0, 0}, {50 * ms, -0.95}, {100 * ms, -1.1}, {150 * ms, -1}},
+			want:    StepResponse{Rise: 50 * ms, Overshoot: 0.1, Settled: 150 * ms},
+		},
+		{
+			name:    "never settles",
+			target:  1,
+			samples: []AngleSample{{0, 0}, {50 * ms, 0.5}, {100 * ms, 0.7}},
+			want:    StepResponse{Rise: -1, Settled: -1, Error: -0.3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := measureStep(tt.samples, 0, tt.target, 0.01)
+			if got.Rise != tt.want.Rise || got.Settled != tt.want.Settled ||
+				math.Abs(got.Overshoot-tt.want.Overshoot) > 1e-9 || math.Abs(got.Error-tt.want.Error) > 1e-9 {
+				t.Errorf("measureStep = rise %v overshoot %g settled %v error %g, want rise %v overshoot %g settled %v error %g",
+					got.Rise, got.Overshoot, got.Settled, got.Error, tt.want.Rise, tt.want.Overshoot, tt.want.Settled, tt.want.Error)
+			}
+		})
+	}
+}
+
+func TestBestStep(t *testing.T) {
+	responses := []StepResponse{
+		{Gains: PIDGains{Kp: 1}, Settled: -1},
+		{Gains: PIDGains{Kp: 2}, Settled: 300 * time.Millisecond},
+		{Gains: PIDGains{Kp: 8}, Settled: 100 * time.Millisecond, Overshoot: 0.3},
+		{Gains: PIDGains{Kp: 4}, Settled: 200 * time.Millisecond, Overshoot: 0.005},
+	}
+	if best := bestStep(responses, 0.01); best == nil || best.Gains.Kp != 4 {
+		t.Errorf("bestStep = %+v, want the calm Kp 4", best)
+	}
+	if best := bestStep(responses[:1], 0.01); best != nil {
+		t.Errorf("bestStep of unsettled responses = %+v, want nil", best)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Pose is a target angle, in radians, for each joint it names. Joints a pose
+// leaves out keep whatever angle they have, so "tail_up" can list only the
+// tail.
+type Pose map[string]float64
+
+// PoseLibrary is a creature's named poses, read from a JSON file such as
+//
+//	{"poses": {"sit": {"joint_hip_l": -0.9, "joint_hip_r": -0.9}}}
+//
+// Joint names are the creature's logical ones.
+type PoseLibrary struct {
+	Poses map[string]Pose `json:"poses"`
+}
+
+// loadPoseLibrary reads a pose library from a JSON file.
+func loadPoseLibrary(path string) (*PoseLibrary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[Pose] Failed to read %s: %v", path, err)
+	}
+	var lib PoseLibrary
+	if err := json.Unmarshal(data, &lib); err != nil {
+		return nil, fmt.Errorf("[Pose] Failed to parse %s: %v", path, err)
+	}
+	if len(lib.Poses) == 0 {
+		return nil, fmt.Errorf("[Pose] %s defines no poses", path)
+	}
+	return &lib, nil
+}
+
+// names returns the library's pose names, sorted.
+func (lib *PoseLibrary) names() []string {
+	names := make([]string, 0, len(lib.Poses))
+	for name := range lib.Poses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolve returns the named pose for a spawned creature: joints get their
+// server names and angles are clamped into each joint's limits, with a
+// warning per clamp. Only hinges report an angle, so a pose naming any
+// other kind of joint is an error.
+func (lib *PoseLibrary) resolve(name string, c *Creature) (Pose, []string, error) {
+	pose, ok := lib.Poses[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("[Pose] No pose %q; the library has %s", name, strings.Join(lib.names(), ", "))
+	}
+	inst := c.instance()
+	resolved := make(Pose, len(pose))
+	var warnings []string
+	for _, jointName := range sortedPoseJoints(pose) {
+		angle := pose[jointName]
+		joint, ok := c.joint(jointName)
+		if !ok {
+			return nil, nil, fmt.Errorf("[Pose] %s: %s has no joint %q", name, c.Name, jointName)
+		}
+		if joint.Type != "" && joint.Type != JointHinge {
+			return nil, nil, fmt.Errorf("[Pose] %s: joint %q is a %s; poses can only drive hinges", name, jointName, joint.Type)
+		}
+		lower, hasLower := joint.Params["limit_lower"]
+		upper, hasUpper := joint.Params["limit_upper"]
+		// A lower limit above the upper one leaves the hinge free.
+		if hasLower && hasUpper && lower <= upper && (angle < lower || angle > upper) {
+			clamped := math.Min(math.Max(angle, lower), upper)
+			warnings = append(warnings, fmt.Sprintf("%s: %s wants %.3f rad, limited to [%.3f, %.3f]; using %.3f", name, jointName, angle, lower, upper, clamped))
+			angle = clamped
+		}
+		resolved[inst.Name(jointName)] = angle
+	}
+	return resolved, warnings, nil
+}
+
+func sortedPoseJoints(pose Pose) []string {
+	joints := make([]string, 0, len(pose))
+	for joint := range pose {
+		joints = append(joints, joint)
+	}
+	sort.Strings(joints)
+	return joints
+}
+
+// Easing maps the fraction of a transition's time that has passed to the
+// fraction of the way the joints should have moved. Both run from 0 to 1.
+type Easing func(t float64) float64
+
+var easings = map[string]Easing{
+	"linear": func(t float64) float64 { return t },
+	"in":     func(t float64) float64 { return t * t },
+	"out":    func(t float64) float64 { return t * (2 - t) },
+	"in-out": func(t float64) float64 { return t * t * (3 - 2*t) },
+}
+
+// easingByName looks up one of the easings above.
+func easingByName(name string) (Easing, error) {
+	ease, ok := easings[name]
+	if !ok {
+		names := make([]string, 0, len(easings))
+		for n := range easings {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("[Pose] Unknown easing %q; use one of %s", name, strings.Join(names, ", "))
+	}
+	return ease, nil
+}
+
+// PoseController moves joints to a pose with their motors. Each tick it
+// reads the joints' angles and commands the velocity that takes each one to
+// where the eased path from the starting angles says it should be by the
+// next tick, so the motion follows the curve however hard the joint is
+// loaded, and ends holding the pose with the motors still.
+type PoseController struct {
+	Tick        time.Duration // control loop period; default 50ms
+	MaxVelocity float64       // rad/s a motor may be asked for; default 6
+	MaxImpulse  float64       // set on the motors when positive
+	// After the transition's duration the controller keeps correcting for
+	// up to Settle until every joint is within Tolerance (rad) of its
+	// target. Defaults are 500ms and 0.02.
+	Settle    time.Duration
+	Tolerance float64
+	Stats     LoopStats // of the last Transition
+
+	session *Session
+}
+
+func newPoseController(s *Session) *PoseController {
+	return &PoseController{
+		Tick:        50 * time.Millisecond,
+		MaxVelocity: 6,
+		Settle:      500 * time.Millisecond,
+		Tolerance:   0.02,
+		session:     s,
+	}
+}
+
+// Transition drives the pose's joints (server names) from their current
+// angles to the pose over duration. It fails if a joint cannot be read or
+// has not reached its target once the settle time is up.
+func (pc *PoseController) Transition(target Pose, duration time.Duration, ease Easing) error {
+	move := pc.move(target, duration, ease)
+	stats, err := pc.session.runControllers(pc.Tick, nil, move)
+	pc.Stats = stats
+	if err != nil {
+		return err
+	}
+	return move.err()
+}
+
+// move returns a transition as a controller, to run on a control loop
+// alongside others.
+func (pc *PoseController) move(target Pose, duration time.Duration, ease Easing) *poseMove {
+	if ease == nil {
+		ease = easings["linear"]
+	}
+	return &poseMove{pc: pc, target: target, joints: sortedPoseJoints(target), duration: duration, ease: ease}
+}
+
+// poseMove is one transition in progress. Its clock starts at the first
+// tick it sees, whenever it was registered.
+type poseMove struct {
+	pc       *PoseController
+	target   Pose
+	joints   []string
+	duration time.Duration
+	ease     Easing
+
+	start map[string]float64
+	begin time.Duration
+	off   []string
+}
+
+func (mv *poseMove) Joints() []string { return mv.joints }
+
+func (mv *poseMove) Update(t Tick, cmds JointCommands) bool {
+	if mv.start == nil {
+		mv.start, mv.begin = t.Angles, t.Elapsed
+		for _, joint := range mv.joints {
+			cmds.set(joint, "motor_enable", 1)
+			if mv.pc.MaxImpulse > 0 {
+				cmds.set(joint, "motor_max_impulse", mv.pc.MaxImpulse)
+			}
+		}
+	}
+	elapsed := t.Elapsed - mv.begin
+	mv.off = mv.pc.offTarget(mv.target, t.Angles)
+	if elapsed >= mv.duration && (len(mv.off) == 0 || elapsed >= mv.duration+mv.pc.Settle) {
+		// Hold the pose.
+		for _, joint := range mv.joints {
+			cmds.set(joint, "motor_target_velocity", 0)
+		}
+		return true
+	}
+
+	next := 1.0
+	if mv.duration > 0 {
+		next = math.Min(1, float64(elapsed+t.Dt)/float64(mv.duration))
+	}
+	for _, joint := range mv.joints {
+		want := mv.start[joint] + (mv.target[joint]-mv.start[joint])*mv.ease(next)
+		cmds.set(joint, "motor_target_velocity", velocityToward(t.Angles[joint], want, t.Dt, mv.pc.MaxVelocity))
+	}
+	return false
+}
+
+// err reports the joints a finished transition left short of the pose.
+func (mv *poseMove) err() error {
+	if len(mv.off) > 0 {
+		return fmt.Errorf("[Pose] Not reached after %v: %s", mv.duration+mv.pc.Settle, strings.Join(mv.off, "; "))
+	}
+	return nil
+}
+
+// offTarget describes each joint further than Tolerance from its target.
+func (pc *PoseController) offTarget(target, current map[string]float64) []string {
+	var off []string
+	for _, joint := range sortedPoseJoints(target) {
+		if d := current[joint] - target[joint]; math.Abs(d) > pc.Tolerance {
+			off = append(off, fmt.Sprintf("%s at %.3f rad, target %.3f", joint, current[joint], target[joint]))
+		}
+	}
+	return off
+}
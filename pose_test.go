@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPoseMove(t *testing.T) {
+	tests := []struct {
+		name        string
+		start       float64
+		target      float64
+		duration    time.Duration
+		ease        string
+		maxVelocity float64
+		limit       time.Duration
+		want        float64 // angle at the end
+		wantTicks   int
+		wantErr     string
+	}{
+		{name: "linear", target: 1, duration: 500 * time.Millisecond, ease: "linear", want: 1, wantTicks: 11},
+		{name: "from a start angle", start: 0.5, target: -0.5, duration: 500 * time.Millisecond, ease: "linear", want: -0.5, wantTicks: 11},
+		{name: "in-out", target: 1, duration: 500 * time.Millisecond, ease: "in-out", want: 1, wantTicks: 11},
+		{name: "zero duration", target: 0.2, want: 0.2, wantTicks: 2},
+		// Stopped at 200ms, the joint is where the path put it at 200ms, and
+		// short of the pose.
+		{name: "linear midway", target: 1, duration: 500 * time.Millisecond, ease: "linear", limit: 250 * time.Millisecond, want: 0.4, wantTicks: 5, wantErr: "Not reached"},
+		{name: "in midway", target: 1, duration: 500 * time.Millisecond, ease: "in", limit: 250 * time.Millisecond, want: 0.16, wantTicks: 5, wantErr: "Not reached"},
+		{name: "out midway", target: 1, duration: 500 * time.Millisecond, ease: "out", limit: 250 * time.Millisecond, want: 0.64, wantTicks: 5, wantErr: "Not reached"},
+		{name: "in-out midway", target: 1, duration: 500 * time.Millisecond, ease: "in-out", limit: 250 * time.Millisecond, want: 0.352, wantTicks: 5, wantErr: "Not reached"},
+		{
+			name: "velocity capped", target: 10, duration: 100 * time.Millisecond, ease: "linear", maxVelocity: 6,
+			want: 3.6, wantTicks: 13, wantErr: "Not reached after 600ms: j at 3.600 rad, target 10.000",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := newPoseController(nil)
+			if tt.maxVelocity > 0 {
+				pc.MaxVelocity = tt.maxVelocity
+			}
+			var ease Easing
+			if tt.ease != "" {
+				var err error
+				if ease, err = easingByName(tt.ease); err != nil {
+					t.Fatal(err)
+				}
+			}
+			move := pc.move(Pose{"j": tt.target}, tt.duration, ease)
+			io, stats := runSim(t, tt.limit, map[string]float64{"j": tt.start}, move)
+
+			if got := io.angle["j"]; math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("angle %g, want %g", got, tt.want)
+			}
+			if stats.Ticks != tt.wantTicks {
+				t.Errorf("%d ticks, want %d", stats.Ticks, tt.wantTicks)
+			}
+			err := move.err()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("err = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPoseMoveEnablesMotors(t *testing.T) {
+	pc := newPoseController(nil)
+	pc.MaxImpulse = 300
+	io, _ := runSim(t, 0, nil, pc.move(Pose{"a": 0.1, "b": -0.1}, 100*time.Millisecond, nil))
+	first := io.sent[0]
+	for _, joint := range []string{"a", "b"} {
+		if first[joint]["motor_enable"] != 1 || first[joint]["motor_max_impulse"] != 300 {
+			t.Errorf("first command for %s is %v", joint, first[joint])
+		}
+	}
+	last := io.sent[len(io.sent)-1]
+	for _, joint := range []string{"a", "b"} {
+		if v, ok := last[joint]["motor_target_velocity"]; !ok || v != 0 {
+			t.Errorf("last command for %s is %v, want the motor stopped", joint, last[joint])
+		}
+	}
+}
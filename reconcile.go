@@ -0,0 +1,499 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// defaultAppliedDir holds the last definition applied for each creature file,
+// which is how the reconciler knows about colors and joint params the server
+// cannot report.
+const defaultAppliedDir = ".pixel/applied"
+
+// ActionKind is one step of a reconciliation plan.
+type ActionKind string
+
+const (
+	ActionSpawn          ActionKind = "spawn"
+	ActionDespawn        ActionKind = "despawn"
+	ActionSetColor       ActionKind = "set_color"
+	ActionCreateJoint    ActionKind = "create_joint"
+	ActionRemoveJoint    ActionKind = "remove_joint"
+	ActionSetJointParams ActionKind = "set_joint_params"
+)
+
+// Action is a single server command the plan wants to run. Cube and Joint use
+// server names.
+type Action struct {
+	Kind   ActionKind
+	Cube   Cube
+	Joint  JointDef
+	Reason string
+}
+
+// Plan is the ordered list of commands that turns the server's current state
+// into the desired one.
+type Plan struct {
+	Actions  []Action
+	Warnings []string
+}
+
+// Empty reports whether the server already matches the definition.
+func (p *Plan) Empty() bool {
+	return len(p.Actions) == 0
+}
+
+// String renders the plan for review before it is applied.
+func (p *Plan) String() string {
+	var b strings.Builder
+	if p.Empty() {
+		b.WriteString("No changes. The server matches the definition.\n")
+	}
+	counts := make(map[ActionKind]int)
+	for _, a := range p.Actions {
+		counts[a.Kind]++
+		switch a.Kind {
+		case ActionSpawn:
+			fmt.Fprintf(&b, "  + spawn            %s at %v", a.Cube.Name, a.Cube.Position)
+		case ActionDespawn:
+			fmt.Fprintf(&b, "  - despawn          %s", a.Cube.Name)
+		case ActionSetColor:
+			fmt.Fprintf(&b, "  ~ set_color        %s %s", a.Cube.Name, a.Cube.Color)
+		case ActionCreateJoint:
+			fmt.Fprintf(&b, "  + create_joint     %s (%s <-> %s, %s)", a.Joint.Name, a.Joint.CubeA, a.Joint.CubeB, a.Joint.Type)
+			if len(a.Joint.Anchor) == 3 {
+				fmt.Fprintf(&b, " at %v", a.Joint.Anchor)
+			}
+			if len(a.Joint.Axis) == 3 {
+				fmt.Fprintf(&b, " axis %v", a.Joint.Axis)
+			}
+		case ActionRemoveJoint:
+			fmt.Fprintf(&b, "  - remove_joint     %s", a.Joint.Name)
+		case ActionSetJointParams:
+			fmt.Fprintf(&b, "  ~ set_joint_params %s %v", a.Joint.Name, a.Joint.Params)
+		}
+		if a.Reason != "" {
+			fmt.Fprintf(&b, "  # %s", a.Reason)
+		}
+		b.WriteString("\n")
+	}
+	for _, w := range p.Warnings {
+		fmt.Fprintf(&b, "  ! %s\n", w)
+	}
+	if !p.Empty() {
+		fmt.Fprintf(&b, "Plan: %d to spawn, %d to despawn, %d joints to create, %d joints to remove, %d joints to retune, %d to recolor.\n",
+			counts[ActionSpawn], counts[ActionDespawn], counts[ActionCreateJoint], counts[ActionRemoveJoint],
+			counts[ActionSetJointParams], counts[ActionSetColor])
+	}
+	return b.String()
+}
+
+// ServerState is what the server reports about a creature's cubes and joints.
+type ServerState struct {
+	Cubes  map[string]bool     // server cube names
+	Joints map[string][]string // server joint name -> cubes reporting it
+}
+
+// jointNames maps each placed joint's requested name to the name of the
+// joint on the server, for the joints found there. The server may name a
+// joint it creates differently, so a joint missing under its own name
+// matches a joint between the same two cubes that nothing else claims.
+func (st *ServerState) jointNames(joints []JointDef) map[string]string {
+	names := make(map[string]string)
+	claimed := make(map[string]bool)
+	for _, joint := range joints {
+		if _, ok := st.Joints[joint.Name]; ok {
+			names[joint.Name] = joint.Name
+			claimed[joint.Name] = true
+		}
+	}
+	var servers []string
+	for server := range st.Joints {
+		servers = append(servers, server)
+	}
+	slices.Sort(servers)
+	for _, joint := range joints {
+		if _, ok := names[joint.Name]; ok {
+			continue
+		}
+		for _, server := range servers {
+			if !claimed[server] && joinsCubes(st.Joints[server], joint.CubeA, joint.CubeB) {
+				names[joint.Name] = server
+				claimed[server] = true
+				break
+			}
+		}
+	}
+	return names
+}
+
+// joinsCubes reports whether a joint reported by cubes joins a and b.
+func joinsCubes(cubes []string, a, b string) bool {
+	return len(cubes) == 2 && (cubes[0] == a && cubes[1] == b || cubes[0] == b && cubes[1] == a)
+}
+
+// observe gathers the server state relevant to a creature: every cube in the
+// world and the joints attached to cubes the creature owns. prev is the
+// previously applied definition, if any.
+func (s *Session) observe(c, prev *Creature) (*ServerState, error) {
+	names, err := s.listCubes()
+	if err != nil {
+		return nil, err
+	}
+	state := &ServerState{Cubes: make(map[string]bool)}
+	for _, name := range names {
+		state.Cubes[name] = true
+	}
+
+	var owned []string
+	for name := range ownedCubes(c, prev) {
+		if state.Cubes[name] {
+			owned = append(owned, name)
+		}
+	}
+	slices.Sort(owned)
+
+	// A partial picture would plan recreating the joints that went
+	// unanswered.
+	joints, err := s.jointsForCubes(owned)
+	if err != nil {
+		return nil, err
+	}
+	state.Joints = joints
+	return state, nil
+}
+
+// ownedCubes returns the server names of the cubes a creature owns: the ones
+// it defines and the ones prev, its last applied definition, defined.
+// Ownership is by exact name, so creature "dog" never claims the cubes of
+// "dog_big" although they share its prefix.
+func ownedCubes(c, prev *Creature) map[string]bool {
+	owned := make(map[string]bool)
+	inst := c.instance()
+	for _, cube := range c.Cubes {
+		owned[inst.Resolve(cube.Name)] = true
+	}
+	if prev != nil {
+		prevInst := prev.instance()
+		for _, cube := range prev.Cubes {
+			owned[prevInst.Resolve(cube.Name)] = true
+		}
+	}
+	return owned
+}
+
+// planCreature computes the commands needed to move the server from state to
+// the desired creature. prev is the definition applied last time, or nil; it
+// supplies what the server cannot report (positions, colors, joint params).
+// Cubes the creature owns but no longer defines are despawned, and joints it
+// no longer defines are removed. Joints whose cubes, type, frame or break
+// thresholds changed are removed and created again. A creature owns only the
+// cubes listed in desired or prev; see ownedCubes.
+func planCreature(desired, prev *Creature, state *ServerState) *Plan {
+	plan := &Plan{}
+	inst := desired.instance()
+	var prevInst *Instance
+	if prev != nil {
+		prevInst = prev.instance()
+	}
+
+	respawned := make(map[string]bool)
+	wanted := make(map[string]bool)
+	for _, cube := range desired.Cubes {
+		server := inst.Resolve(cube.Name)
+		wanted[server] = true
+		placed := inst.Cubes([]Cube{cube})[0]
+		placed.Name = server
+
+		old, hadOld := Cube{}, false
+		if prev != nil {
+			if oc, ok := prev.cube(cube.Name); ok {
+				old, hadOld = prevInst.Cubes([]Cube{oc})[0], true
+			}
+		}
+
+		switch {
+		case !state.Cubes[server]:
+			plan.Actions = append(plan.Actions, Action{Kind: ActionSpawn, Cube: placed, Reason: "missing on server"})
+			respawned[server] = true
+		case hadOld && (!slices.Equal(old.Position, placed.Position) || !slices.Equal(old.Rotation, placed.Rotation)):
+			plan.Actions = append(plan.Actions,
+				Action{Kind: ActionDespawn, Cube: placed, Reason: "moved"},
+				Action{Kind: ActionSpawn, Cube: placed, Reason: "moved"})
+			respawned[server] = true
+		case hadOld && (!slices.Equal(old.Size, placed.Size) || old.Mass != placed.Mass):
+			plan.Actions = append(plan.Actions,
+				Action{Kind: ActionDespawn, Cube: placed, Reason: "resized"},
+				Action{Kind: ActionSpawn, Cube: placed, Reason: "resized"})
+			respawned[server] = true
+		}
+
+		if placed.Color == "" {
+			continue
+		}
+		if respawned[server] || !hadOld || !strings.EqualFold(old.Color, placed.Color) {
+			plan.Actions = append(plan.Actions, Action{Kind: ActionSetColor, Cube: placed})
+		}
+	}
+
+	// Despawn cubes the creature owns but no longer wants.
+	var stale []string
+	owned := ownedCubes(desired, prev)
+	for server := range state.Cubes {
+		if owned[server] && !wanted[server] {
+			stale = append(stale, server)
+		}
+	}
+	slices.Sort(stale)
+	for _, server := range stale {
+		plan.Actions = append(plan.Actions, Action{Kind: ActionDespawn, Cube: Cube{Name: server}, Reason: "no longer defined"})
+		respawned[server] = true
+	}
+
+	// Joints disappear with either of their cubes, so anything touching a
+	// respawned cube is recreated.
+	placedJoints := make([]JointDef, len(desired.Joints))
+	for i, joint := range desired.Joints {
+		placedJoints[i] = desired.placedJoint(inst, joint)
+	}
+	serverJoints := state.jointNames(placedJoints)
+	wantedJoints := make(map[string]bool)
+	for i, joint := range desired.Joints {
+		placed := placedJoints[i]
+		server, onServer := serverJoints[placed.Name]
+		if !onServer {
+			server = placed.Name
+		}
+		wantedJoints[server] = true
+		// Commands for the live joint go to the name the server gave it.
+		live := placed
+		live.Name = server
+
+		var old JointDef
+		hadOld := false
+		if prev != nil {
+			old, hadOld = prev.joint(joint.Name)
+		}
+
+		switch {
+		case !onServer || respawned[placed.CubeA] || respawned[placed.CubeB]:
+			plan.Actions = append(plan.Actions, Action{Kind: ActionCreateJoint, Joint: placed})
+			if len(placed.Params) > 0 {
+				plan.Actions = append(plan.Actions, Action{Kind: ActionSetJointParams, Joint: placed})
+			}
+		case hadOld && !sameJointShape(old, joint):
+			// Only params can change on a live joint; anything else means
+			// building it again.
+			plan.Actions = append(plan.Actions,
+				Action{Kind: ActionRemoveJoint, Joint: live, Reason: "changed"},
+				Action{Kind: ActionCreateJoint, Joint: placed, Reason: "changed"})
+			if len(placed.Params) > 0 {
+				plan.Actions = append(plan.Actions, Action{Kind: ActionSetJointParams, Joint: placed})
+			}
+		case len(placed.Params) > 0 && (!hadOld || !maps.Equal(old.Params, joint.Params)):
+			plan.Actions = append(plan.Actions, Action{Kind: ActionSetJointParams, Joint: live})
+		}
+	}
+
+	// Joints the previous definition had are ours to remove; others are
+	// only reported.
+	prevJoints := make(map[string]bool)
+	if prev != nil {
+		placed := make([]JointDef, len(prev.Joints))
+		for i, joint := range prev.Joints {
+			placed[i] = prev.placedJoint(prevInst, joint)
+		}
+		for _, server := range state.jointNames(placed) {
+			prevJoints[server] = true
+		}
+	}
+	var removed, unmanaged []string
+	for joint, cubes := range state.Joints {
+		if wantedJoints[joint] {
+			continue
+		}
+		gone := false
+		for _, cube := range cubes {
+			gone = gone || respawned[cube]
+		}
+		if gone {
+			continue
+		}
+		if prevJoints[joint] {
+			removed = append(removed, joint)
+		} else {
+			unmanaged = append(unmanaged, joint)
+		}
+	}
+	slices.Sort(removed)
+	for _, joint := range removed {
+		plan.Actions = append(plan.Actions, Action{Kind: ActionRemoveJoint, Joint: JointDef{Name: joint}, Reason: "no longer defined"})
+	}
+	slices.Sort(unmanaged)
+	for _, joint := range unmanaged {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("joint %s exists on the server but is not defined", joint))
+	}
+
+	return plan
+}
+
+// sameJointShape reports whether two definitions of a joint can share one
+// live joint: everything fixed at creation matches.
+func sameJointShape(a, b JointDef) bool {
+	return a.Type == b.Type && a.CubeA == b.CubeA && a.CubeB == b.CubeB &&
+		a.JointFrame.equal(b.JointFrame) && a.BreakForce == b.BreakForce && a.BreakTorque == b.BreakTorque
+}
+
+// applyPlan runs the plan's actions in order. Consecutive spawns, colors and
+// joints go out as one batch each; everything else is sequential so joints
+// are only created once both cubes exist.
+func (s *Session) applyPlan(plan *Plan) error {
+	actions := plan.Actions
+	for len(actions) > 0 {
+		kind := actions[0].Kind
+		n := 1
+		for n < len(actions) && actions[n].Kind == kind {
+			n++
+		}
+		batch := actions[:n]
+		actions = actions[n:]
+
+		switch kind {
+		case ActionSpawn:
+			cubes := make([]Cube, len(batch))
+			for i, a := range batch {
+				cubes[i] = a.Cube
+				cubes[i].Name = strings.TrimSuffix(a.Cube.Name, baseSuffix)
+			}
+			if err := s.spawnCubes(cubes); err != nil {
+				return err
+			}
+		case ActionDespawn:
+			// A moved or resized cube is spawned again under the same
+			// name next, so the despawn must be answered first.
+			names := make([]string, len(batch))
+			for i, a := range batch {
+				names[i] = a.Cube.Name
+			}
+			if err := s.despawnCubes(names); err != nil {
+				return err
+			}
+		case ActionSetColor:
+			colors := make(map[string]string, len(batch))
+			for _, a := range batch {
+				colors[a.Cube.Name] = a.Cube.Color
+			}
+			if err := s.setColors(colors); err != nil {
+				return err
+			}
+		case ActionCreateJoint:
+			joints := make([]JointDef, len(batch))
+			for i, a := range batch {
+				joints[i] = a.Joint
+			}
+			if err := s.createJoints(joints); err != nil {
+				return err
+			}
+		case ActionRemoveJoint:
+			for _, a := range batch {
+				if err := s.removeJoint(a.Joint.Name); err != nil {
+					return err
+				}
+			}
+		case ActionSetJointParams:
+			params := make(map[string]map[string]float64, len(batch))
+			for _, a := range batch {
+				params[s.trackedJointName(a.Joint)] = a.Joint.Params
+			}
+			if err := s.writeJointParams(params); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// appliedPath returns where the last applied copy of a definition is kept.
+func appliedPath(defPath string) string {
+	abs, err := filepath.Abs(defPath)
+	if err != nil {
+		abs = defPath
+	}
+	name := strings.NewReplacer(string(filepath.Separator), "_", ":", "_").Replace(strings.TrimPrefix(abs, string(filepath.Separator)))
+	return filepath.Join(defaultAppliedDir, name)
+}
+
+// loadApplied returns the definition last applied from defPath, or nil if it
+// has never been applied.
+func loadApplied(defPath string) *Creature {
+	data, err := os.ReadFile(appliedPath(defPath))
+	if err != nil {
+		return nil
+	}
+	var c Creature
+	if err := json.Unmarshal(data, &c); err != nil {
+		fmt.Println("[Reconcile] Ignoring unreadable applied state:", err)
+		return nil
+	}
+	return &c
+}
+
+// saveApplied records a definition as applied.
+func saveApplied(defPath string, c *Creature) error {
+	if err := os.MkdirAll(defaultAppliedDir, 0o755); err != nil {
+		return err
+	}
+	return saveCreature(appliedPath(defPath), c)
+}
+
+// reconcileFile plans the changes needed for the creature in path and, if
+// apply is set, runs them.
+func (s *Session) reconcileFile(path string, apply bool) (*Plan, error) {
+	plan, desired, err := s.planFile(path)
+	if err != nil || !apply {
+		return plan, err
+	}
+	return plan, s.applyFile(path, plan, desired)
+}
+
+// planFile loads the creature in path and plans the changes it needs,
+// returning the plan together with the definition it was made from.
+func (s *Session) planFile(path string) (*Plan, *Creature, error) {
+	desired, err := loadCreature(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	prev := loadApplied(path)
+	state, err := s.observe(desired, prev)
+	if err != nil {
+		return nil, nil, err
+	}
+	return planCreature(desired, prev, state), desired, nil
+}
+
+// applyFile runs a plan made by planFile and records desired as applied.
+func (s *Session) applyFile(path string, plan *Plan, desired *Creature) error {
+	if err := s.applyPlan(plan); err != nil {
+		return err
+	}
+	return saveApplied(path, desired)
+}
+
+// spawnCreature spawns a creature that was built in memory rather than loaded
+// from a file, skipping whatever already matches the server.
+func (s *Session) spawnCreature(c *Creature) (*Plan, error) {
+	if err := c.prepare(); err != nil {
+		return nil, fmt.Errorf("[Creature] %v", err)
+	}
+	state, err := s.observe(c, nil)
+	if err != nil {
+		return nil, err
+	}
+	plan := planCreature(c, nil, state)
+	return plan, s.applyPlan(plan)
+}
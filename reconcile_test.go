@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testDog is a two-cube creature with one hinge; edit changes it before it
+// is returned.
+func testDog(edit func(c *Creature)) *Creature {
+	c := &Creature{
+		Name: "dog",
+		Cubes: []Cube{
+			{Name: "a", Position: []float64{0, 0, 0}, Color: "#FF0000"},
+			{Name: "b", Position: []float64{1, 0, 0}},
+		},
+		Joints: []JointDef{
+			{Name: "j", CubeA: "a", CubeB: "b", Type: JointHinge, Params: map[string]float64{"limit_lower": -1, "limit_upper": 1}},
+		},
+	}
+	if edit != nil {
+		edit(c)
+	}
+	return c
+}
+
+// serverState builds a ServerState from cube names and joint:cubeA,cubeB
+// entries.
+func serverState(cubes []string, joints ...string) *ServerState {
+	state := &ServerState{Cubes: make(map[string]bool), Joints: make(map[string][]string)}
+	for _, cube := range cubes {
+		state.Cubes[cube] = true
+	}
+	for _, joint := range joints {
+		name, ends, _ := strings.Cut(joint, ":")
+		state.Joints[name] = strings.Split(ends, ",")
+	}
+	return state
+}
+
+func describePlan(plan *Plan) []string {
+	var steps []string
+	for _, a := range plan.Actions {
+		name := a.Cube.Name
+		if name == "" {
+			name = a.Joint.Name
+		}
+		steps = append(steps, fmt.Sprintf("%s %s", a.Kind, name))
+	}
+	for _, w := range plan.Warnings {
+		steps = append(steps, "! "+w)
+	}
+	return steps
+}
+
+func TestPlanCreature(t *testing.T) {
+	both := []string{"dog_a_BASE", "dog_b_BASE"}
+	jointed := serverState(both, "dog_j:dog_a_BASE,dog_b_BASE")
+	tests := []struct {
+		name    string
+		desired *Creature
+		prev    *Creature
+		state   *ServerState
+		want    []string
+	}{
+		{
+			name:    "fresh",
+			desired: testDog(nil),
+			state:   serverState(nil),
+			want: []string{
+				"spawn dog_a_BASE", "set_color dog_a_BASE", "spawn dog_b_BASE",
+				"create_joint dog_j", "set_joint_params dog_j",
+			},
+		},
+		{
+			name:    "in sync",
+			desired: testDog(nil),
+			prev:    testDog(nil),
+			state:   jointed,
+		},
+		{
+			// Without a previous apply the colors and params the server
+			// cannot report are sent again.
+			name:    "in sync without a record",
+			desired: testDog(nil),
+			state:   jointed,
+			want:    []string{"set_color dog_a_BASE", "set_joint_params dog_j"},
+		},
+		{
+			name:    "cube missing",
+			desired: testDog(nil),
+			prev:    testDog(nil),
+			state:   serverState([]string{"dog_a_BASE"}),
+			want:    []string{"spawn dog_b_BASE", "create_joint dog_j", "set_joint_params dog_j"},
+		},
+		{
+			name:    "moved",
+			desired: testDog(func(c *Creature) { c.Cubes[0].Position = []float64{0, 1, 0} }),
+			prev:    testDog(nil),
+			state:   jointed,
+			want: []string{
+				"despawn dog_a_BASE", "spawn dog_a_BASE", "set_color dog_a_BASE",
+				"create_joint dog_j", "set_joint_params dog_j",
+			},
+		},
+		{
+			name:    "offset moves every cube",
+			desired: testDog(func(c *Creature) { c.Offset = []float64{0, 0, 5} }),
+			prev:    testDog(nil),
+			state:   jointed,
+			want: []string{
+				"despawn dog_a_BASE", "spawn dog_a_BASE", "set_color dog_a_BASE",
+				"despawn dog_b_BASE", "spawn dog_b_BASE",
+				"create_joint dog_j", "set_joint_params dog_j",
+			},
+		},
+		{
+			name:    "resized",
+			desired: testDog(func(c *Creature) { c.Cubes[1].Size = []float64{1, 2, 1} }),
+			prev:    testDog(nil),
+			state:   jointed,
+			want:    []string{"despawn dog_b_BASE", "spawn dog_b_BASE", "create_joint dog_j", "set_joint_params dog_j"},
+		},
+		{
+			name:    "recolored",
+			desired: testDog(func(c *Creature) { c.Cubes[0].Color = "#00FF00" }),
+			prev:    testDog(nil),
+			state:   jointed,
+			want:    []string{"set_color dog_a_BASE"},
+		},
+		{
+			name:    "color case ignored",
+			desired: testDog(func(c *Creature) { c.Cubes[0].Color = "#ff0000" }),
+			prev:    testDog(nil),
+			state:   jointed,
+		},
+		{
+			name:    "retuned",
+			desired: testDog(func(c *Creature) { c.Joints[0].Params["limit_upper"] = 0.5 }),
+			prev:    testDog(nil),
+			state:   jointed,
+			want:    []string{"set_joint_params dog_j"},
+		},
+		{
+			name: "retyped",
+			desired: testDog(func(c *Creature) {
+				c.Joints[0].Type, c.Joints[0].Params = JointFixed, nil
+			}),
+			prev:  testDog(nil),
+			state: jointed,
+			want:  []string{"remove_joint dog_j", "create_joint dog_j"},
+		},
+		{
+			name:    "break threshold changed",
+			desired: testDog(func(c *Creature) { c.Joints[0].BreakForce = 100 }),
+			prev:    testDog(nil),
+			state:   jointed,
+			want:    []string{"remove_joint dog_j", "create_joint dog_j", "set_joint_params dog_j"},
+		},
+		{
+			name:    "joint no longer defined",
+			desired: testDog(func(c *Creature) { c.Joints = nil }),
+			prev:    testDog(nil),
+			state:   jointed,
+			want:    []string{"remove_joint dog_j"},
+		},
+		{
+			// The joint goes with the despawned cube.
+			name:    "cube no longer defined",
+			desired: testDog(func(c *Creature) { c.Cubes, c.Joints = c.Cubes[:1], nil }),
+			prev:    testDog(nil),
+			state:   jointed,
+			want:    []string{"despawn dog_b_BASE"},
+		},
+		{
+			name:    "unmanaged joint",
+			desired: testDog(nil),
+			prev:    testDog(nil),
+			state:   serverState(both, "dog_j:dog_a_BASE,dog_b_BASE", "dog_extra:dog_a_BASE,dog_b_BASE"),
+			want:    []string{"! joint dog_extra exists on the server but is not defined"},
+		},
+		{
+			// The server named the joint itself; it is still the dog's.
+			name:    "joint renamed by the server",
+			desired: testDog(func(c *Creature) { c.Joints[0].Params["limit_upper"] = 0.5 }),
+			prev:    testDog(nil),
+			state:   serverState(both, "joint_0:dog_b_BASE,dog_a_BASE"),
+			want:    []string{"set_joint_params joint_0"},
+		},
+		{
+			name:    "renamed joint no longer defined",
+			desired: testDog(func(c *Creature) { c.Joints = nil }),
+			prev:    testDog(nil),
+			state:   serverState(both, "joint_0:dog_a_BASE,dog_b_BASE"),
+			want:    []string{"remove_joint joint_0"},
+		},
+		{
+			// "dog_big" shares the prefix but its cubes are not the dog's.
+			name:    "shared prefix",
+			desired: testDog(nil),
+			prev:    testDog(nil),
+			state:   serverState(append(both, "dog_big_a_BASE", "dog_big_b_BASE"), "dog_j:dog_a_BASE,dog_b_BASE"),
+		},
+		{
+			// A renamed cube's old server cube is still owned.
+			name:    "cube renamed",
+			desired: testDog(func(c *Creature) { c.Cubes[1].Name, c.Joints = "c", nil }),
+			prev:    testDog(func(c *Creature) { c.Joints = nil }),
+			state:   serverState(both),
+			want:    []string{"spawn dog_c_BASE", "despawn dog_b_BASE"},
+		},
+		{
+			// Without a prefix only cubes from the previous apply are
+			// owned; anything else on the server is left alone.
+			name:    "unnamed",
+			desired: testDog(func(c *Creature) { c.Name, c.Cubes, c.Joints = "", c.Cubes[:1], nil }),
+			prev:    testDog(func(c *Creature) { c.Name, c.Joints = "", nil }),
+			state:   serverState([]string{"a_BASE", "b_BASE", "other_BASE"}),
+			want:    []string{"despawn b_BASE"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := describePlan(planCreature(tt.desired, tt.prev, tt.state))
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("plan:\n  %s\nwant:\n  %s", strings.Join(got, "\n  "), strings.Join(tt.want, "\n  "))
+			}
+		})
+	}
+}
+
+func TestPlanString(t *testing.T) {
+	if got := (&Plan{}).String(); got != "No changes. The server matches the definition.\n" {
+		t.Errorf("empty plan renders as %q", got)
+	}
+	plan := planCreature(testDog(nil), nil, serverState(nil))
+	out := plan.String()
+	for _, want := range []string{
+		"+ spawn            dog_a_BASE at [0 0 0]  # missing on server",
+		"+ create_joint     dog_j (dog_a_BASE <-> dog_b_BASE, hinge)",
+		"Plan: 2 to spawn, 0 to despawn, 1 joints to create, 0 joints to remove, 1 joints to retune, 1 to recolor.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("plan output lacks %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Selectors pick cubes and joints out of what a session tracks. A selector is
+// a comma-separated union of terms; a term prefixed with "!" is subtracted
+// instead. Names are matched without the "_BASE" suffix and, when resolved
+// against an instance, without the instance prefix.
+//
+//	tail3                exact name
+//	body*, head?         glob
+//	body[1-12]           numeric range, combinable with globs
+//	prefix:body          name prefix
+//	tag:mouth            cubes carrying the tag
+//	group:head           cubes in the group
+//	box(x1,y1,z1,x2,y2,z2)  cubes whose spawn position lies in the box
+//	neighbors(tail3)     cubes sharing a joint with the inner selection
+//	joints-of(tail*)     joints touching the inner selection
+//	joint:tail_*         joints by name
+//
+// For example "body[1-12], !body5" or "joints-of(leftbackleg1, leftbackknee1)".
+
+// Selection is the result of resolving a selector. Names are server names.
+type Selection struct {
+	Cubes  []string
+	Joints []string
+}
+
+type termKind int
+
+const (
+	termName termKind = iota
+	termPrefix
+	termTag
+	termGroup
+	termBox
+	termNeighbors
+	termJointsOf
+	termJoint
+)
+
+type selectorTerm struct {
+	kind    termKind
+	negate  bool
+	value   string
+	pattern *namePattern
+	box     [6]float64
+	inner   []selectorTerm
+}
+
+// namePattern matches names against a glob with optional numeric ranges.
+type namePattern struct {
+	re     *regexp.Regexp
+	ranges [][2]int // one per capture group
+}
+
+var rangeRe = regexp.MustCompile(`\[(\d+)-(\d+)\]`)
+
+func compileNamePattern(pattern string) (*namePattern, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	var ranges [][2]int
+	rest := pattern
+	for rest != "" {
+		loc := rangeRe.FindStringSubmatchIndex(rest)
+		literal := rest
+		if loc != nil {
+			literal = rest[:loc[0]]
+		}
+		for _, r := range literal {
+			switch r {
+			case '*':
+				expr.WriteString(".*")
+			case '?':
+				expr.WriteString(".")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		if loc == nil {
+			break
+		}
+		lo, _ := strconv.Atoi(rest[loc[2]:loc[3]])
+		hi, _ := strconv.Atoi(rest[loc[4]:loc[5]])
+		if lo > hi {
+			return nil, fmt.Errorf("empty range in %q", pattern)
+		}
+		ranges = append(ranges, [2]int{lo, hi})
+		expr.WriteString(`(\d+)`)
+		rest = rest[loc[1]:]
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	return &namePattern{re: re, ranges: ranges}, nil
+}
+
+func (p *namePattern) match(name string) bool {
+	m := p.re.FindStringSubmatch(name)
+	if m == nil {
+		return false
+	}
+	for i, r := range p.ranges {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil || n < r[0] || n > r[1] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitTopLevel splits on commas that are not inside parentheses.
+func splitTopLevel(expr string) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range expr {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced ')' in %q", expr)
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced '(' in %q", expr)
+	}
+	return append(parts, expr[start:]), nil
+}
+
+// parseSelector compiles a selector expression.
+func parseSelector(expr string) ([]selectorTerm, error) {
+	parts, err := splitTopLevel(expr)
+	if err != nil {
+		return nil, err
+	}
+	var terms []selectorTerm
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		term, err := parseTerm(part)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+	return terms, nil
+}
+
+func parseTerm(text string) (selectorTerm, error) {
+	var term selectorTerm
+	if rest, ok := strings.CutPrefix(text, "!"); ok {
+		term.negate = true
+		text = strings.TrimSpace(rest)
+	}
+
+	if open := strings.Index(text, "("); open > 0 && strings.HasSuffix(text, ")") {
+		fn, args := text[:open], text[open+1:len(text)-1]
+		switch fn {
+		case "box":
+			fields := strings.Split(args, ",")
+			if len(fields) != 6 {
+				return term, fmt.Errorf("box needs 6 coordinates, got %q", args)
+			}
+			for i, f := range fields {
+				v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+				if err != nil {
+					return term, fmt.Errorf("invalid box coordinate %q", f)
+				}
+				term.box[i] = v
+			}
+			for i := 0; i < 3; i++ {
+				if term.box[i] > term.box[i+3] {
+					term.box[i], term.box[i+3] = term.box[i+3], term.box[i]
+				}
+			}
+			term.kind = termBox
+			return term, nil
+		case "neighbors", "joints-of":
+			inner, err := parseSelector(args)
+			if err != nil {
+				return term, err
+			}
+			term.kind, term.inner = termNeighbors, inner
+			if fn == "joints-of" {
+				term.kind = termJointsOf
+			}
+			return term, nil
+		default:
+			return term, fmt.Errorf("unknown selector function %q", fn)
+		}
+	}
+
+	kind, value := termName, text
+	if key, rest, ok := strings.Cut(text, ":"); ok {
+		switch key {
+		case "prefix":
+			kind = termPrefix
+		case "tag":
+			kind = termTag
+		case "group":
+			kind = termGroup
+		case "joint":
+			kind = termJoint
+		default:
+			return term, fmt.Errorf("unknown selector key %q", key)
+		}
+		value = rest
+	}
+	term.kind, term.value = kind, value
+	if kind == termName || kind == termJoint {
+		pattern, err := compileNamePattern(value)
+		if err != nil {
+			return term, err
+		}
+		term.pattern = pattern
+	}
+	return term, nil
+}
+
+// selectContext is the tracked state a selector is resolved against.
+type selectContext struct {
+	inst    *Instance
+	cubes   []Cube
+	links   []CubeLink
+	logical map[string]string // server cube name -> name relative to inst
+}
+
+// jointName returns a joint's name relative to the instance, reporting false
+// for joints outside it.
+func (ctx *selectContext) jointName(server string) (string, bool) {
+	if ctx.inst == nil || ctx.inst.Prefix == "" {
+		return server, true
+	}
+	return strings.CutPrefix(server, ctx.inst.Prefix+"_")
+}
+
+// eval resolves terms into sets of server cube and joint names.
+func (ctx *selectContext) eval(terms []selectorTerm) (cubes, joints map[string]bool) {
+	cubes, joints = make(map[string]bool), make(map[string]bool)
+	onlyNegative := true
+	for _, term := range terms {
+		onlyNegative = onlyNegative && term.negate
+	}
+	if onlyNegative {
+		for name := range ctx.logical {
+			cubes[name] = true
+		}
+		for _, link := range ctx.links {
+			_, a := ctx.logical[link.CubeA]
+			_, b := ctx.logical[link.CubeB]
+			if a || b {
+				joints[link.JointName] = true
+			}
+		}
+	}
+
+	// Union every positive term first so subtraction does not depend on the
+	// order terms were written in.
+	for _, negate := range []bool{false, true} {
+		for _, term := range terms {
+			if term.negate != negate {
+				continue
+			}
+			tc, tj := ctx.evalTerm(term)
+			for name := range tc {
+				if negate {
+					delete(cubes, name)
+				} else {
+					cubes[name] = true
+				}
+			}
+			for name := range tj {
+				if negate {
+					delete(joints, name)
+				} else {
+					joints[name] = true
+				}
+			}
+		}
+	}
+	return cubes, joints
+}
+
+func (ctx *selectContext) evalTerm(term selectorTerm) (cubes, joints map[string]bool) {
+	cubes, joints = make(map[string]bool), make(map[string]bool)
+	switch term.kind {
+	case termNeighbors, termJointsOf:
+		inner, _ := ctx.eval(term.inner)
+		for _, link := range ctx.links {
+			a, b := inner[link.CubeA], inner[link.CubeB]
+			if !a && !b {
+				continue
+			}
+			if term.kind == termJointsOf {
+				joints[link.JointName] = true
+				continue
+			}
+			if a && !inner[link.CubeB] {
+				cubes[link.CubeB] = true
+			}
+			if b && !inner[link.CubeA] {
+				cubes[link.CubeA] = true
+			}
+		}
+		return cubes, joints
+	case termJoint:
+		for _, link := range ctx.links {
+			if name, ok := ctx.jointName(link.JointName); ok && term.pattern.match(name) {
+				joints[link.JointName] = true
+			}
+		}
+		return cubes, joints
+	}
+
+	for _, cube := range ctx.cubes {
+		name, ok := ctx.logical[cube.Name]
+		if !ok {
+			continue
+		}
+		var hit bool
+		switch term.kind {
+		case termName:
+			hit = term.pattern.match(name)
+		case termPrefix:
+			hit = strings.HasPrefix(name, term.value)
+		case termTag:
+			hit = slices.Contains(cube.Tags, term.value)
+		case termGroup:
+			hit = cube.Group == term.value
+		case termBox:
+			hit = len(cube.Position) == 3 &&
+				cube.Position[0] >= term.box[0] && cube.Position[0] <= term.box[3] &&
+				cube.Position[1] >= term.box[1] && cube.Position[1] <= term.box[4] &&
+				cube.Position[2] >= term.box[2] && cube.Position[2] <= term.box[5]
+		}
+		if hit {
+			cubes[cube.Name] = true
+		}
+	}
+	return cubes, joints
+}
+
+// Select resolves a selector against the session's tracked cubes and joints.
+// With a non-nil instance, only that instance's cubes are considered and
+// names are matched relative to its prefix.
+func (s *Session) Select(inst *Instance, expr string) (*Selection, error) {
+	terms, err := parseSelector(expr)
+	if err != nil {
+		return nil, fmt.Errorf("[Select] %v", err)
+	}
+	ctx := &selectContext{
+		inst:    inst,
+		cubes:   s.Cubes(),
+		links:   s.Links(),
+		logical: make(map[string]string),
+	}
+	for _, cube := range ctx.cubes {
+		if name, ok := inst.Logical(cube.Name); ok {
+			ctx.logical[cube.Name] = name
+		}
+	}
+
+	cubes, joints := ctx.eval(terms)
+	sel := &Selection{}
+	for name := range cubes {
+		sel.Cubes = append(sel.Cubes, name)
+	}
+	for name := range joints {
+		sel.Joints = append(sel.Joints, name)
+	}
+	sort.Strings(sel.Cubes)
+	sort.Strings(sel.Joints)
+	return sel, nil
+}
+
+// selectJoints resolves a selector to joints. Cubes matched by the selector
+// contribute every joint touching them, so "tail*" selects the tail joints.
+func (s *Session) selectJoints(inst *Instance, expr string) ([]string, error) {
+	sel, err := s.Select(inst, expr)
+	if err != nil {
+		return nil, err
+	}
+	joints := make(map[string]bool)
+	for _, name := range sel.Joints {
+		joints[name] = true
+	}
+	picked := make(map[string]bool)
+	for _, name := range sel.Cubes {
+		picked[name] = true
+	}
+	for _, link := range s.Links() {
+		if picked[link.CubeA] || picked[link.CubeB] {
+			joints[link.JointName] = true
+		}
+	}
+	names := make([]string, 0, len(joints))
+	for name := range joints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// colorSelection paints the selected cubes.
+func (s *Session) colorSelection(inst *Instance, expr, color string) error {
+	sel, err := s.Select(inst, expr)
+	if err != nil {
+		return err
+	}
+	return s.paintCubes(sel.Cubes, color)
+}
+
+// freezeSelection freezes or unfreezes the selected cubes in one batch.
+func (s *Session) freezeSelection(inst *Instance, expr string, freeze bool) error {
+	sel, err := s.Select(inst, expr)
+	if err != nil {
+		return err
+	}
+	return s.freezeCubes(sel.Cubes, freeze)
+}
+
+// despawnSelection despawns the selected cubes.
+func (s *Session) despawnSelection(inst *Instance, expr string) error {
+	sel, err := s.Select(inst, expr)
+	if err != nil {
+		return err
+	}
+	if len(sel.Cubes) == 0 {
+		return nil
+	}
+	return s.despawnCubes(sel.Cubes)
+}
+
+// setJointParamsSelection applies the same parameters to every selected
+// joint over one connection, verifying them if the session does.
+func (s *Session) setJointParamsSelection(inst *Instance, expr string, params map[string]float64) error {
+	joints, err := s.selectJoints(inst, expr)
+	if err != nil {
+		return err
+	}
+	for _, joint := range joints {
+		if err := validateJointParams(s.jointKind(joint), params); err != nil {
+			return fmt.Errorf("[setJointParams] Joint %s: %v", joint, err)
+		}
+	}
+	all := make(map[string]map[string]float64, len(joints))
+	for _, joint := range joints {
+		all[joint] = params
+	}
+	return s.writeJointParams(all)
+}
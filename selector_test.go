@@ -0,0 +1,145 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSelectorErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"", "empty selector"},
+		{" , ", "empty selector"},
+		{"neighbors(body", "unbalanced '('"},
+		{"body)", "unbalanced ')'"},
+		{"box(1,2,3)", "box needs 6 coordinates"},
+		{"box(1,2,3,4,5,x)", `invalid box coordinate "x"`},
+		{"color:red", `unknown selector key "color"`},
+		{"body[5-1]", `empty range in "body[5-1]"`},
+		{"spin(body)", `unknown selector function "spin"`},
+		{"neighbors()", "empty selector"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseSelector(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseSelector(%q) = %v, want %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNamePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"tail3", "tail3", true},
+		{"tail3", "tail30", false},
+		{"tail?", "tail3", true},
+		{"tail?", "tail", false},
+		{"body*", "body", true},
+		{"body*", "bodyguard", true},
+		{"b.dy", "body", false},
+		{"body[1-12]", "body7", true},
+		{"body[1-12]", "body12", true},
+		{"body[1-12]", "body13", false},
+		{"body[1-12]", "body", false},
+		{"leg[1-2]_knee[3-4]", "leg2_knee3", true},
+		{"leg[1-2]_knee[3-4]", "leg2_knee5", false},
+		{"*[1-2]", "leg2", true},
+	}
+	for _, tt := range tests {
+		p, err := compileNamePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("compileNamePattern(%q): %v", tt.pattern, err)
+		}
+		if got := p.match(tt.name); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	s := &Session{
+		cubes: []Cube{
+			{Name: "dog_body1_BASE", Position: []float64{0, 0, 0}, Group: "body", Tags: []string{"trunk"}},
+			{Name: "dog_body2_BASE", Position: []float64{1, 0, 0}, Group: "body"},
+			{Name: "dog_body12_BASE", Position: []float64{2, 0, 0}},
+			{Name: "dog_tail3_BASE", Position: []float64{3, 0, 0}, Tags: []string{"tail"}},
+			{Name: "dog_head_BASE", Position: []float64{0, 2, 0}, Group: "head", Tags: []string{"mouth"}},
+			{Name: "cat_body1_BASE", Position: []float64{10, 0, 0}},
+			{Name: "cat_tail_BASE", Position: []float64{11, 0, 0}},
+		},
+		links: []CubeLink{
+			{JointName: "dog_joint_body1_body2", CubeA: "dog_body1_BASE", CubeB: "dog_body2_BASE"},
+			{JointName: "dog_joint_body2_tail3", CubeA: "dog_body2_BASE", CubeB: "dog_tail3_BASE"},
+			{JointName: "dog_joint_body1_head", CubeA: "dog_body1_BASE", CubeB: "dog_head_BASE"},
+			{JointName: "cat_joint_body1_tail", CubeA: "cat_body1_BASE", CubeB: "cat_tail_BASE"},
+		},
+	}
+	dog := newInstance("dog", nil)
+	tests := []struct {
+		expr       string
+		inst       *Instance
+		wantCubes  string
+		wantJoints string
+	}{
+		{expr: "body1", inst: dog, wantCubes: "dog_body1_BASE"},
+		{expr: "body*", inst: dog, wantCubes: "dog_body12_BASE dog_body1_BASE dog_body2_BASE"},
+		{expr: "body[1-2]", inst: dog, wantCubes: "dog_body1_BASE dog_body2_BASE"},
+		{expr: "body[1-12], !body2", inst: dog, wantCubes: "dog_body12_BASE dog_body1_BASE"},
+		{expr: "!body2, body[1-12]", inst: dog, wantCubes: "dog_body12_BASE dog_body1_BASE"},
+		{expr: "prefix:bo", inst: dog, wantCubes: "dog_body12_BASE dog_body1_BASE dog_body2_BASE"},
+		{expr: "tag:mouth, tag:tail", inst: dog, wantCubes: "dog_head_BASE dog_tail3_BASE"},
+		{expr: "group:body", inst: dog, wantCubes: "dog_body1_BASE dog_body2_BASE"},
+		{expr: "box(0,0,0, 1.5,0,0)", inst: dog, wantCubes: "dog_body1_BASE dog_body2_BASE"},
+		{expr: "box(1.5,0,0, 0,0,0)", inst: dog, wantCubes: "dog_body1_BASE dog_body2_BASE"},
+		{expr: "neighbors(body2)", inst: dog, wantCubes: "dog_body1_BASE dog_tail3_BASE"},
+		{expr: "neighbors(body1, body2)", inst: dog, wantCubes: "dog_head_BASE dog_tail3_BASE"},
+		{expr: "joints-of(tail3)", inst: dog, wantJoints: "dog_joint_body2_tail3"},
+		{expr: "joint:joint_body1_*", inst: dog, wantJoints: "dog_joint_body1_body2 dog_joint_body1_head"},
+		{
+			expr: "!body*", inst: dog, wantCubes: "dog_head_BASE dog_tail3_BASE",
+			wantJoints: "dog_joint_body1_body2 dog_joint_body1_head dog_joint_body2_tail3",
+		},
+		{expr: "missing", inst: dog},
+		{expr: "cat_*", wantCubes: "cat_body1_BASE cat_tail_BASE"},
+		{expr: "body1", inst: newInstance("cat", nil), wantCubes: "cat_body1_BASE"},
+		{expr: "joint:cat_*", wantJoints: "cat_joint_body1_tail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			sel, err := s.Select(tt.inst, tt.expr)
+			if err != nil {
+				t.Fatalf("Select: %v", err)
+			}
+			if got := strings.Join(sel.Cubes, " "); got != tt.wantCubes {
+				t.Errorf("cubes = %q, want %q", got, tt.wantCubes)
+			}
+			if got := strings.Join(sel.Joints, " "); got != tt.wantJoints {
+				t.Errorf("joints = %q, want %q", got, tt.wantJoints)
+			}
+		})
+	}
+}
+
+func TestSelectJoints(t *testing.T) {
+	s := &Session{
+		cubes: []Cube{{Name: "a_BASE"}, {Name: "b_BASE"}, {Name: "c_BASE"}},
+		links: []CubeLink{
+			{JointName: "joint_a_b", CubeA: "a_BASE", CubeB: "b_BASE"},
+			{JointName: "joint_b_c", CubeA: "b_BASE", CubeB: "c_BASE"},
+		},
+	}
+	joints, err := s.selectJoints(nil, "a, joint:joint_b_c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(joints, " "), "joint_a_b joint_b_c"; got != want {
+		t.Errorf("selectJoints = %q, want %q", got, want)
+	}
+}
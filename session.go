@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Session owns every cube and joint spawned during one run against one
+// server. All methods are safe for concurrent use, and a single process can
+// drive several independent worlds by creating one Session per server.
+type Session struct {
+	Addr     string
+	Password string
+	// VerifyParams makes joint param writes read the params back and fail
+	// on values the server did not take.
+	VerifyParams bool
+
+	mu    sync.Mutex
+	cubes []Cube // tracked by server name
+	links []CubeLink
+
+	manifestPath string // empty unless enableManifest was called
+	started      time.Time
+	closeOnce    sync.Once
+}
+
+// newSession creates an empty session for the server at addr.
+func newSession(addr, password string) *Session {
+	return &Session{Addr: addr, Password: password}
+}
+
+// dial opens connections to servers; tests replace it with in-memory pipes.
+var dial = net.Dial
+
+// connect opens a TCP connection to the session's server and authenticates.
+func (s *Session) connect() (net.Conn, error) {
+	conn, err := dial("tcp", s.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %v", err)
+	}
+	if _, err := conn.Write([]byte(s.Password + delimiter)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("auth write error: %v", err)
+	}
+	// Servers that do not acknowledge the password are let through, as
+	// they always have been; one that hangs up has refused it.
+	if _, err := readResponse(conn); err != nil && !isTimeout(err) {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read auth response: %v", err)
+	}
+	return conn, nil
+}
+
+// isTimeout reports whether err is a read or write deadline passing.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// send opens a connection, sends one message and closes it without waiting
+// for a reply.
+func (s *Session) send(msg Message) error {
+	conn, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return sendJSONMessage(conn, msg)
+}
+
+// request sends one message and returns the server's reply.
+func (s *Session) request(msg Message) (string, error) {
+	conn, err := s.connect()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if err := sendJSONMessage(conn, msg); err != nil {
+		return "", err
+	}
+	return readResponse(conn)
+}
+
+// batchConn is a connection used for fire-and-forget commands. Replies are
+// drained and discarded so a server that answers every command never stalls
+// on a full socket.
+type batchConn struct {
+	net.Conn
+	drained chan struct{}
+}
+
+// batchLinger is how long a finished batch connection stays open in the
+// background for the server to work through what was sent.
+const batchLinger = 3 * time.Second
+
+// openBatch opens an authenticated connection for batched commands.
+func (s *Session) openBatch() (*batchConn, error) {
+	conn, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	// connect leaves the auth reply's deadline set; the drainer must keep
+	// reading for as long as the batch is in use.
+	conn.SetReadDeadline(time.Time{})
+	b := &batchConn{Conn: conn, drained: make(chan struct{})}
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(b.drained)
+	}()
+	return b, nil
+}
+
+// send writes several messages in a single write.
+func (b *batchConn) send(msgs []Message) error {
+	data, err := encodeBatch(msgs)
+	if err != nil {
+		return err
+	}
+	_, err = b.Write(data)
+	return err
+}
+
+// finish half-closes the connection and returns. The connection is torn
+// down in the background once the server has closed its side or
+// batchLinger has passed, so the caller never waits on a server that keeps
+// connections open.
+func (b *batchConn) finish() {
+	if tcp, ok := b.Conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+	go func() {
+		select {
+		case <-b.drained:
+		case <-time.After(batchLinger):
+		}
+		b.Close()
+	}()
+}
+
+// sendBatch sends several messages over one connection in a single write.
+func (s *Session) sendBatch(msgs []Message) error {
+	b, err := s.openBatch()
+	if err != nil {
+		return err
+	}
+	defer b.finish()
+	return b.send(msgs)
+}
+
+// requestBatch sends several messages in a single write and returns the
+// replies in order. If the server stops answering, the replies read so far
+// are returned with the error.
+func (s *Session) requestBatch(msgs []Message) ([]string, error) {
+	conn, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	data, err := encodeBatch(msgs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(data); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	replies := make([]string, 0, len(msgs))
+	for range msgs {
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		reply, err := readReply(reader)
+		if err != nil {
+			return replies, fmt.Errorf("no reply after %d of %d commands: %v", len(replies), len(msgs), err)
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
+
+// encodeBatch frames several messages back to back, ready for one write.
+func encodeBatch(msgs []Message) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		buf.WriteString(delimiter)
+	}
+	return buf.Bytes(), nil
+}
+
+// refusedReplies returns, by index, the message of every error reply.
+func refusedReplies(replies []string) map[int]string {
+	refused := make(map[int]string)
+	for i, resp := range replies {
+		var reply struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal([]byte(resp), &reply) == nil && reply.Type == "error" {
+			refused[i] = reply.Message
+		}
+	}
+	return refused
+}
+
+// trackCube records a spawned cube under its server name.
+func (s *Session) trackCube(cube Cube) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.cubes {
+		if s.cubes[i].Name == cube.Name {
+			s.cubes[i] = cube
+			s.saveManifest()
+			return
+		}
+	}
+	s.cubes = append(s.cubes, cube)
+	s.saveManifest()
+}
+
+// trackCubes records many spawned cubes at once.
+func (s *Session) trackCubes(cubes []Cube) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := make(map[string]int, len(s.cubes))
+	for i, cube := range s.cubes {
+		index[cube.Name] = i
+	}
+	for _, cube := range cubes {
+		if i, ok := index[cube.Name]; ok {
+			s.cubes[i] = cube
+			continue
+		}
+		index[cube.Name] = len(s.cubes)
+		s.cubes = append(s.cubes, cube)
+	}
+	s.saveManifest()
+}
+
+// updateCube applies fn to a tracked cube, if the session knows it.
+func (s *Session) updateCube(name string, fn func(cube *Cube)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.cubes {
+		if s.cubes[i].Name == name {
+			fn(&s.cubes[i])
+			return
+		}
+	}
+}
+
+// untrackCube forgets a cube and every joint attached to it.
+func (s *Session) untrackCube(name string) {
+	s.untrackCubes([]string{name})
+}
+
+// untrackCubes forgets many cubes and their joints, saving the manifest once.
+func (s *Session) untrackCubes(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	gone := make(map[string]bool, len(names))
+	for _, name := range names {
+		gone[name] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cubes := s.cubes[:0]
+	for _, cube := range s.cubes {
+		if !gone[cube.Name] {
+			cubes = append(cubes, cube)
+		}
+	}
+	s.cubes = cubes
+	links := s.links[:0]
+	for _, link := range s.links {
+		if !gone[link.CubeA] && !gone[link.CubeB] {
+			links = append(links, link)
+		}
+	}
+	s.links = links
+	s.saveManifest()
+}
+
+// trackLink records a joint between two cubes.
+func (s *Session) trackLink(link CubeLink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links = append(s.links, link)
+	s.saveManifest()
+}
+
+// untrackLink forgets a joint that was removed or broke.
+func (s *Session) untrackLink(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	links := s.links[:0]
+	for _, link := range s.links {
+		if link.JointName != name {
+			links = append(links, link)
+		}
+	}
+	s.links = links
+	s.saveManifest()
+}
+
+// replaceLinks swaps the whole joint table, as refreshJoints rebuilds it.
+func (s *Session) replaceLinks(links []CubeLink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links = links
+	s.saveManifest()
+}
+
+// trackLinks records many joints at once.
+func (s *Session) trackLinks(links []CubeLink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links = append(s.links, links...)
+	s.saveManifest()
+}
+
+// saveManifest persists the tracked state, reporting rather than returning
+// errors so tracking never fails. The caller must hold s.mu.
+func (s *Session) saveManifest() {
+	if err := s.saveManifestLocked(); err != nil {
+		fmt.Println("[Session]", err)
+	}
+}
+
+// Cubes returns a snapshot of the tracked cubes.
+func (s *Session) Cubes() []Cube {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Cube(nil), s.cubes...)
+}
+
+// CubeNames returns the server names of the tracked cubes.
+func (s *Session) CubeNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, len(s.cubes))
+	for i, cube := range s.cubes {
+		names[i] = cube.Name
+	}
+	return names
+}
+
+// jointKind returns the kind a tracked joint was created with, or "" if the
+// joint is not tracked or predates kinds being recorded.
+func (s *Session) jointKind(name string) JointKind {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, link := range s.links {
+		if link.JointName == name {
+			return link.Type
+		}
+	}
+	return ""
+}
+
+// trackedJointName returns the name the server confirmed for a joint: its own
+// name if tracked, otherwise that of the tracked joint between the same
+// cubes, which the server renamed on creation.
+func (s *Session) trackedJointName(joint JointDef) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, link := range s.links {
+		if link.JointName == joint.Name {
+			return joint.Name
+		}
+	}
+	for _, link := range s.links {
+		if joinsCubes([]string{link.CubeA, link.CubeB}, joint.CubeA, joint.CubeB) {
+			return link.JointName
+		}
+	}
+	return joint.Name
+}
+
+// Links returns a snapshot of the tracked joints.
+func (s *Session) Links() []CubeLink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CubeLink(nil), s.links...)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer stands in for the game server over in-memory pipes. Every
+// command is recorded and answered with whatever reply returns; a nil reply
+// hangs up instead.
+type fakeServer struct {
+	reply func(msg Message) Message
+
+	mu       sync.Mutex
+	received []Message
+	conns    sync.WaitGroup
+}
+
+// startFakeServer routes the session's connections to a fake server for the
+// rest of the test.
+func startFakeServer(t *testing.T, reply func(msg Message) Message) *fakeServer {
+	f := &fakeServer{reply: reply}
+	orig := dial
+	dial = func(network, addr string) (net.Conn, error) {
+		client, server := net.Pipe()
+		f.conns.Add(1)
+		go f.serve(server)
+		return client, nil
+	}
+	t.Cleanup(func() { dial = orig })
+	return f
+}
+
+func (f *fakeServer) serve(conn net.Conn) {
+	// Replies are written in the background: pipes are unbuffered, and
+	// the client only reads once its whole batch is written. The writer
+	// hangs up once every reply is out.
+	replies := make(chan []byte, 1024)
+	go func() {
+		defer f.conns.Done()
+		for data := range replies {
+			conn.Write(data)
+		}
+		conn.Close()
+	}()
+	defer close(replies)
+
+	reader := bufio.NewReader(conn)
+	if _, err := readReply(reader); err != nil {
+		return
+	}
+	replies <- []byte("AUTH_OK" + delimiter)
+	for {
+		raw, err := readReply(reader)
+		if err != nil {
+			return
+		}
+		var msg Message
+		json.Unmarshal([]byte(raw), &msg)
+		f.mu.Lock()
+		f.received = append(f.received, msg)
+		f.mu.Unlock()
+		reply := f.reply(msg)
+		if reply == nil {
+			return
+		}
+		data, _ := json.Marshal(reply)
+		replies <- append(data, delimiter...)
+	}
+}
+
+// commands waits for every connection to close and returns each command's
+// type and cube or joint name, sorted.
+func (f *fakeServer) commands() []string {
+	f.conns.Wait()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for _, msg := range f.received {
+		name, _ := msg["cube_name"].(string)
+		if joint, ok := msg["joint_name"].(string); ok {
+			name = joint
+		}
+		out = append(out, msg["type"].(string)+" "+name)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestEncodeBatch(t *testing.T) {
+	data, err := encodeBatch([]Message{{"type": "a", "n": 1}, {"type": "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"n":1,"type":"a"}` + delimiter + `{"type":"b"}` + delimiter
+	if string(data) != want {
+		t.Errorf("encodeBatch = %s, want %s", data, want)
+	}
+	if _, err := encodeBatch([]Message{{"bad": func() {}}}); err == nil {
+		t.Error("encodeBatch accepted a message that cannot be marshalled")
+	}
+}
+
+func TestRefusedReplies(t *testing.T) {
+	refused := refusedReplies([]string{
+		`{"type":"spawned"}`,
+		`{"type":"error","message":"name taken"}`,
+		`not json`,
+		`{"type":"error"}`,
+	})
+	if len(refused) != 2 || refused[1] != "name taken" || refused[3] != "" {
+		t.Errorf("refusedReplies = %q", refused)
+	}
+}
+
+func TestRequestBatch(t *testing.T) {
+	msgs := []Message{{"type": "ping", "cube_name": "a"}, {"type": "ping", "cube_name": "b"}}
+
+	startFakeServer(t, func(msg Message) Message {
+		return Message{"type": "pong", "cube_name": msg["cube_name"]}
+	})
+	s := newSession("pipe", "pw")
+	replies, err := s.requestBatch(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 2 || !strings.Contains(replies[1], `"cube_name":"b"`) {
+		t.Errorf("replies = %q", replies)
+	}
+
+	// A server that hangs up after the first reply leaves one unanswered.
+	startFakeServer(t, func(msg Message) Message {
+		if msg["cube_name"] == "b" {
+			return nil
+		}
+		return Message{"type": "pong"}
+	})
+	replies, err = s.requestBatch(msgs)
+	if err == nil || !strings.Contains(err.Error(), "no reply after 1 of 2 commands") {
+		t.Errorf("err = %v, want a missing reply", err)
+	}
+	if len(replies) != 1 {
+		t.Errorf("replies = %q, want the first", replies)
+	}
+}
+
+func TestSpawnCubesTracksConfirmed(t *testing.T) {
+	f := startFakeServer(t, func(msg Message) Message {
+		if msg["cube_name"] == "b" {
+			return Message{"type": "error", "message": "no room"}
+		}
+		return Message{"type": "spawned"}
+	})
+	s := newSession("pipe", "pw")
+	err := s.spawnCubes([]Cube{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+	if err == nil || !strings.Contains(err.Error(), "b_BASE: no room") {
+		t.Errorf("err = %v, want b refused", err)
+	}
+	if got := strings.Join(s.CubeNames(), " "); got != "a_BASE c_BASE" {
+		t.Errorf("tracked %q, want the confirmed cubes", got)
+	}
+	if got := len(f.commands()); got != 3 {
+		t.Errorf("server got %d commands, want 3", got)
+	}
+}
+
+func TestTrackCubes(t *testing.T) {
+	s := newSession("pipe", "pw")
+	s.trackCubes([]Cube{{Name: "a_BASE"}, {Name: "b_BASE"}, {Name: "c_BASE"}})
+	s.trackCubes([]Cube{{Name: "b_BASE", Color: "#FF0000"}})
+	s.trackLinks([]CubeLink{
+		{JointName: "ab", CubeA: "a_BASE", CubeB: "b_BASE"},
+		{JointName: "bc", CubeA: "b_BASE", CubeB: "c_BASE"},
+		{JointName: "ca", CubeA: "c_BASE", CubeB: "a_BASE"},
+	})
+	cubes := s.Cubes()
+	if len(cubes) != 3 || cubes[1].Color != "#FF0000" {
+		t.Errorf("retracking a cube should replace it in place: %+v", cubes)
+	}
+
+	s.untrackCubes([]string{"b_BASE"})
+	if got := strings.Join(s.CubeNames(), " "); got != "a_BASE c_BASE" {
+		t.Errorf("cubes = %q", got)
+	}
+	links := s.Links()
+	if len(links) != 1 || links[0].JointName != "ca" {
+		t.Errorf("links = %+v, want only the joint not touching b", links)
+	}
+}
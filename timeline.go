@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// Keyframe is one point of a timeline track: T seconds in, the joint should
+// be at Angle (rad) or turning at Velocity (rad/s). Interp is how the track
+// gets there from the previous keyframe: "linear" (the default), "step",
+// which holds the previous value and jumps at T, or one of the pose easings
+// "in", "out" and "in-out".
+type Keyframe struct {
+	T        float64  `json:"t"`
+	Angle    *float64 `json:"angle,omitempty"`
+	Velocity *float64 `json:"velocity,omitempty"`
+	Interp   string   `json:"interp,omitempty"`
+}
+
+func (k Keyframe) value() float64 {
+	if k.Angle != nil {
+		return *k.Angle
+	}
+	return *k.Velocity
+}
+
+// Timeline is joint motion written as keyframes, one track per joint, e.g.
+//
+//	{"loop": true, "tracks": {"joint_tail2_tail3": [
+//	  {"t": 0, "angle": -0.6}, {"t": 0.4, "angle": 0.6, "interp": "in-out"},
+//	  {"t": 0.8, "angle": -0.6, "interp": "in-out"}]}}
+//
+// Track names are the creature's logical joint names. A track is all angle
+// keyframes or all velocity keyframes; before its first keyframe and after
+// its last it holds that keyframe's value. The timeline lasts until its
+// latest keyframe, when every joint it drives stops, and Speed (default 1)
+// plays it faster or slower. A looping timeline goes straight from its end
+// back to its start, so each angle track must end at the angle it starts
+// from.
+type Timeline struct {
+	Loop   bool                  `json:"loop,omitempty"`
+	Speed  float64               `json:"speed,omitempty"`
+	Tracks map[string][]Keyframe `json:"tracks"`
+}
+
+// loadTimeline reads a timeline from a JSON file.
+func loadTimeline(path string) (*Timeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[Timeline] Failed to read %s: %v", path, err)
+	}
+	var tl Timeline
+	if err := json.Unmarshal(data, &tl); err != nil {
+		return nil, fmt.Errorf("[Timeline] Failed to parse %s: %v", path, err)
+	}
+	if err := tl.validate(); err != nil {
+		return nil, fmt.Errorf("[Timeline] %s: %v", path, err)
+	}
+	return &tl, nil
+}
+
+// validate checks that every track is non-empty, in time order and of one
+// kind, with known interpolations, and that a looping timeline's angle
+// tracks close.
+func (tl *Timeline) validate() error {
+	if len(tl.Tracks) == 0 {
+		return fmt.Errorf("no tracks")
+	}
+	if tl.Speed < 0 {
+		return fmt.Errorf("speed cannot be negative")
+	}
+	for _, joint := range tl.joints() {
+		track := tl.Tracks[joint]
+		if len(track) == 0 {
+			return fmt.Errorf("track %q has no keyframes", joint)
+		}
+		angles := track[0].Angle != nil
+		for i, k := range track {
+			if (k.Angle == nil) == (k.Velocity == nil) {
+				return fmt.Errorf("track %q keyframe %d needs an angle or a velocity", joint, i)
+			}
+			if (k.Angle != nil) != angles {
+				return fmt.Errorf("track %q mixes angle and velocity keyframes", joint)
+			}
+			if k.T < 0 || (i > 0 && k.T <= track[i-1].T) {
+				return fmt.Errorf("track %q keyframe %d at %gs is out of order", joint, i, k.T)
+			}
+			if _, ok := easings[k.Interp]; !ok && k.Interp != "" && k.Interp != "step" {
+				return fmt.Errorf("track %q keyframe %d: unknown interp %q", joint, i, k.Interp)
+			}
+		}
+		// Across the wrap the player would aim straight from the last
+		// angle at the first, at whatever velocity that takes.
+		first, last := track[0].value(), track[len(track)-1].value()
+		if tl.Loop && angles && math.Abs(last-first) > 1e-9 {
+			return fmt.Errorf("track %q loops from %g rad back to %g rad; a looping angle track must end where it starts", joint, last, first)
+		}
+	}
+	return nil
+}
+
+// joints returns the timeline's track names, sorted.
+func (tl *Timeline) joints() []string {
+	joints := make([]string, 0, len(tl.Tracks))
+	for joint := range tl.Tracks {
+		joints = append(joints, joint)
+	}
+	sort.Strings(joints)
+	return joints
+}
+
+// length is the time of the latest keyframe, in seconds of timeline time.
+func (tl *Timeline) length() float64 {
+	var length float64
+	for _, track := range tl.Tracks {
+		length = math.Max(length, track[len(track)-1].T)
+	}
+	return length
+}
+
+// wrap maps timeline time onto the timeline, looping if it loops.
+func (tl *Timeline) wrap(t float64) float64 {
+	if tl.Loop && tl.length() > 0 {
+		return math.Mod(t, tl.length())
+	}
+	return t
+}
+
+// sampleTrack returns a track's value at time t.
+func sampleTrack(track []Keyframe, t float64) float64 {
+	if t <= track[0].T {
+		return track[0].value()
+	}
+	for i := 1; i < len(track); i++ {
+		next := track[i]
+		if t >= next.T {
+			continue
+		}
+		prev := track[i-1]
+		f := (t - prev.T) / (next.T - prev.T)
+		switch next.Interp {
+		case "", "linear":
+		case "step":
+			f = 0
+		default:
+			f = easings[next.Interp](f)
+		}
+		return prev.value() + (next.value()-prev.value())*f
+	}
+	return track[len(track)-1].value()
+}
+
+// TimelinePlayer plays timelines on joints as one controller of a control
+// loop: each tick it reads the angles the angle tracks need, and the loop
+// sends every joint its motor velocity in one batch. Angle tracks are
+// followed the way the pose controller follows its path; velocity tracks
+// are sent as they are, scaled by the playback speed so the motion keeps
+// its shape.
+type TimelinePlayer struct {
+	Tick        time.Duration // control loop period; default 50ms
+	MaxVelocity float64       // rad/s an angle track may ask for; default 6
+	MaxImpulse  float64       // set on the motors when positive
+	Speed       float64       // multiplies each timeline's own speed; default 1
+	Stats       LoopStats     // of the last Play
+
+	session *Session
+	voices  []*timelineVoice
+	started bool
+	begin   time.Duration
+}
+
+// timelineVoice is one timeline being played, with its tracks bound to
+// server joint names.
+type timelineVoice struct {
+	timeline *Timeline
+	joints   map[string]string
+	done     bool
+}
+
+func newTimelinePlayer(s *Session) *TimelinePlayer {
+	return &TimelinePlayer{
+		Tick:        50 * time.Millisecond,
+		MaxVelocity: 6,
+		Speed:       1,
+		session:     s,
+	}
+}
+
+// Add schedules a timeline on an instance's joints; a nil instance takes
+// track names as server joint names. Two timelines cannot drive one joint.
+func (p *TimelinePlayer) Add(tl *Timeline, inst *Instance) error {
+	if inst == nil {
+		inst = newInstance("", nil)
+	}
+	voice := &timelineVoice{timeline: tl, joints: make(map[string]string, len(tl.Tracks))}
+	for _, track := range tl.joints() {
+		joint := inst.Name(track)
+		for _, other := range p.voices {
+			for _, taken := range other.joints {
+				if taken == joint {
+					return fmt.Errorf("[Timeline] %s is already driven by another timeline", joint)
+				}
+			}
+		}
+		voice.joints[track] = joint
+	}
+	p.voices = append(p.voices, voice)
+	return nil
+}
+
+// speed is how many seconds of a voice's timeline pass per real second.
+func (p *TimelinePlayer) speed(v *timelineVoice) float64 {
+	speed := p.Speed
+	if v.timeline.Speed > 0 {
+		speed *= v.timeline.Speed
+	}
+	return speed
+}
+
+// Play runs the scheduled timelines from their start until every one that
+// does not loop has finished or stop is closed, then leaves all their joints
+// holding still.
+func (p *TimelinePlayer) Play(stop <-chan struct{}) error {
+	p.rewind()
+	stats, err := p.session.runControllers(p.Tick, stop, p)
+	p.Stats = stats
+	return err
+}
+
+// rewind sets every timeline back to its start, for the next tick the
+// player sees.
+func (p *TimelinePlayer) rewind() {
+	p.started = false
+	for _, v := range p.voices {
+		v.done = false
+	}
+}
+
+// Joints lists the joints of unfinished angle tracks, whose angles the
+// player follows.
+func (p *TimelinePlayer) Joints() []string {
+	var joints []string
+	for _, v := range p.voices {
+		if v.done {
+			continue
+		}
+		for track, joint := range v.joints {
+			if v.timeline.Tracks[track][0].Angle != nil {
+				joints = append(joints, joint)
+			}
+		}
+	}
+	sort.Strings(joints)
+	return joints
+}
+
+func (p *TimelinePlayer) Update(t Tick, cmds JointCommands) bool {
+	if !p.started {
+		p.started, p.begin = true, t.Elapsed
+		for _, v := range p.voices {
+			for _, joint := range v.joints {
+				cmds.set(joint, "motor_enable", 1)
+				if p.MaxImpulse > 0 {
+					cmds.set(joint, "motor_max_impulse", p.MaxImpulse)
+				}
+			}
+		}
+	}
+	elapsed := (t.Elapsed - p.begin).Seconds()
+	playing := false
+	for _, v := range p.voices {
+		if v.done {
+			continue
+		}
+		tl := v.timeline
+		speed := p.speed(v)
+		at := elapsed * speed
+		finished := !tl.Loop && at > tl.length()
+		for track, joint := range v.joints {
+			keys := tl.Tracks[track]
+			switch {
+			case finished:
+				cmds.set(joint, "motor_target_velocity", 0)
+			case keys[0].Angle != nil:
+				want := sampleTrack(keys, tl.wrap(at+t.Dt.Seconds()*speed))
+				cmds.set(joint, "motor_target_velocity", velocityToward(t.Angles[joint], want, t.Dt, p.MaxVelocity))
+			default:
+				cmds.set(joint, "motor_target_velocity", sampleTrack(keys, tl.wrap(at))*speed)
+			}
+		}
+		v.done = finished
+		playing = playing || !finished
+	}
+	return !playing
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func angleKey(t, angle float64, interp string) Keyframe {
+	return Keyframe{T: t, Angle: &angle, Interp: interp}
+}
+
+func velocityKey(t, velocity float64, interp string) Keyframe {
+	return Keyframe{T: t, Velocity: &velocity, Interp: interp}
+}
+
+func TestSampleTrack(t *testing.T) {
+	tests := []struct {
+		name  string
+		track []Keyframe
+		at    float64
+		want  float64
+	}{
+		{"before the first keyframe", []Keyframe{angleKey(0.5, 1, ""), angleKey(1, 2, "")}, 0, 1},
+		{"linear", []Keyframe{angleKey(0, 0, ""), angleKey(1, 2, "")}, 0.25, 0.5},
+		{"linear by name", []Keyframe{angleKey(0, 0, ""), angleKey(1, 2, "linear")}, 0.25, 0.5},
+		{"step holds", []Keyframe{angleKey(0, 0, ""), angleKey(1, 2, "step")}, 0.99, 0},
+		{"step lands", []Keyframe{angleKey(0, 0, ""), angleKey(1, 2, "step")}, 1, 2},
+		{"in", []Keyframe{angleKey(0, 0, ""), angleKey(1, 1, "in")}, 0.5, 0.25},
+		{"in-out", []Keyframe{angleKey(0, 0, ""), angleKey(1, 1, "in-out")}, 0.25, 0.15625},
+		{"second segment", []Keyframe{angleKey(0, 0, ""), angleKey(1, 1, ""), angleKey(2, -1, "")}, 1.5, 0},
+		{"after the last keyframe", []Keyframe{angleKey(0, 0, ""), angleKey(1, 2, "")}, 5, 2},
+		{"velocity", []Keyframe{velocityKey(0, 2, ""), velocityKey(1, 4, "")}, 0.5, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sampleTrack(tt.track, tt.at); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("sampleTrack at %g = %g, want %g", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimelineValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tl      Timeline
+		wantErr string
+	}{
+		{"no tracks", Timeline{}, "no tracks"},
+		{"negative speed", Timeline{Speed: -1, Tracks: map[string][]Keyframe{"j": {angleKey(0, 0, "")}}}, "speed cannot be negative"},
+		{"empty track", Timeline{Tracks: map[string][]Keyframe{"j": {}}}, `track "j" has no keyframes`},
+		{"no value", Timeline{Tracks: map[string][]Keyframe{"j": {{T: 0}}}}, "needs an angle or a velocity"},
+		{"both values", Timeline{Tracks: map[string][]Keyframe{"j": {{T: 0, Angle: new(float64), Velocity: new(float64)}}}}, "needs an angle or a velocity"},
+		{"mixed", Timeline{Tracks: map[string][]Keyframe{"j": {angleKey(0, 0, ""), velocityKey(1, 0, "")}}}, "mixes angle and velocity"},
+		{"out of order", Timeline{Tracks: map[string][]Keyframe{"j": {angleKey(1, 0, ""), angleKey(0.5, 0, "")}}}, "out of order"},
+		{"same time", Timeline{Tracks: map[string][]Keyframe{"j": {angleKey(1, 0, ""), angleKey(1, 0, "")}}}, "out of order"},
+		{"negative time", Timeline{Tracks: map[string][]Keyframe{"j": {angleKey(-1, 0, "")}}}, "out of order"},
+		{"unknown interp", Timeline{Tracks: map[string][]Keyframe{"j": {angleKey(0, 0, ""), angleKey(1, 0, "bounce")}}}, `unknown interp "bounce"`},
+		{"open loop", Timeline{Loop: true, Tracks: map[string][]Keyframe{"j": {angleKey(0, 0, ""), angleKey(1, 1, "")}}}, "must end where it starts"},
+		{"closed loop", Timeline{Loop: true, Tracks: map[string][]Keyframe{"j": {angleKey(0, 0, ""), angleKey(0.5, 1, ""), angleKey(1, 0, "")}}}, ""},
+		{"open velocity loop", Timeline{Loop: true, Tracks: map[string][]Keyframe{"j": {velocityKey(0, 1, ""), velocityKey(1, -1, "")}}}, ""},
+		{"open without loop", Timeline{Tracks: map[string][]Keyframe{"j": {angleKey(0, 0, ""), angleKey(1, 1, "in-out")}}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tl.validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("validate: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTimelinePlayer(t *testing.T) {
+	ramp := map[string][]Keyframe{"j": {angleKey(0, 0, ""), angleKey(1, 1, "")}}
+	burst := map[string][]Keyframe{"j": {velocityKey(0, 2, ""), velocityKey(0.5, 0, "step")}}
+	tests := []struct {
+		name      string
+		tl        Timeline
+		speed     float64 // the player's; 0 leaves the default
+		limit     time.Duration
+		want      map[string]float64
+		wantTicks int
+	}{
+		{name: "angle track", tl: Timeline{Tracks: ramp}, want: map[string]float64{"j": 1}, wantTicks: 22},
+		{name: "velocity track", tl: Timeline{Tracks: burst}, want: map[string]float64{"j": 1}, wantTicks: 12},
+		{name: "player speed", tl: Timeline{Tracks: ramp}, speed: 2, want: map[string]float64{"j": 1}, wantTicks: 12},
+		// Velocities scale with the speed, so the motion keeps its shape.
+		{name: "velocity track at speed", tl: Timeline{Tracks: burst}, speed: 2, want: map[string]float64{"j": 1}, wantTicks: 7},
+		{name: "timeline speed", tl: Timeline{Speed: 0.5, Tracks: ramp}, want: map[string]float64{"j": 1}, wantTicks: 42},
+		{
+			name: "short track holds its last angle",
+			tl: Timeline{Tracks: map[string][]Keyframe{
+				"a": {angleKey(0, 0, ""), angleKey(0.5, -1, "")},
+				"b": {angleKey(0, 0, ""), angleKey(1, 1, "")},
+			}},
+			want:      map[string]float64{"a": -1, "b": 1},
+			wantTicks: 22,
+		},
+		// A jump is followed as fast as MaxVelocity allows: 0.3 rad a tick.
+		{
+			name:      "step capped by max velocity",
+			tl:        Timeline{Tracks: map[string][]Keyframe{"j": {angleKey(0, 0, ""), angleKey(0.5, 1, "step")}}},
+			want:      map[string]float64{"j": 0.6},
+			wantTicks: 12,
+		},
+		// Stopped at 1.45s, the looped ramp is where it was at 0.45s.
+		{
+			name:      "loop",
+			tl:        Timeline{Loop: true, Tracks: map[string][]Keyframe{"j": {angleKey(0, 0, ""), angleKey(0.5, 1, ""), angleKey(1, 0, "")}}},
+			limit:     1500 * time.Millisecond,
+			want:      map[string]float64{"j": 0.9},
+			wantTicks: 30,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.tl.validate(); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			p := newTimelinePlayer(nil)
+			if tt.speed > 0 {
+				p.Speed = tt.speed
+			}
+			if err := p.Add(&tt.tl, nil); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			p.rewind()
+			io, stats := runSim(t, tt.limit, nil, p)
+
+			for joint, want := range tt.want {
+				if got := io.angle[joint]; math.Abs(got-want) > 1e-9 {
+					t.Errorf("%s at %g, want %g", joint, got, want)
+				}
+			}
+			if stats.Ticks != tt.wantTicks {
+				t.Errorf("%d ticks, want %d", stats.Ticks, tt.wantTicks)
+			}
+			last := io.sent[len(io.sent)-1]
+			for joint := range tt.want {
+				if v, ok := last[joint]["motor_target_velocity"]; !ok || v != 0 {
+					t.Errorf("last command for %s is %v, want the motor stopped", joint, last[joint])
+				}
+			}
+		})
+	}
+}
+
+func TestTimelinePlayerAdd(t *testing.T) {
+	tl := &Timeline{Tracks: map[string][]Keyframe{"tail": {angleKey(0, 0, "")}}}
+	p := newTimelinePlayer(nil)
+	if err := p.Add(tl, newInstance("dog1", nil)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := p.Add(tl, newInstance("dog2", nil)); err != nil {
+		t.Errorf("Add on another instance: %v", err)
+	}
+	if err := p.Add(tl, newInstance("dog1", nil)); err == nil {
+		t.Errorf("Add on a driven joint succeeded")
+	}
+	if got, want := strings.Join(p.Joints(), ","), "dog1_tail,dog2_tail"; got != want {
+		t.Errorf("Joints = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// urdfRobot is the subset of a URDF document the importer understands.
+type urdfRobot struct {
+	Name      string         `xml:"name,attr"`
+	Materials []urdfMaterial `xml:"material"`
+	Links     []urdfLink     `xml:"link"`
+	Joints    []urdfJoint    `xml:"joint"`
+}
+
+type urdfOrigin struct {
+	XYZ string `xml:"xyz,attr"`
+	RPY string `xml:"rpy,attr"`
+}
+
+type urdfMaterial struct {
+	Name  string `xml:"name,attr"`
+	Color *struct {
+		RGBA string `xml:"rgba,attr"`
+	} `xml:"color"`
+}
+
+type urdfGeometry struct {
+	Box *struct {
+		Size string `xml:"size,attr"`
+	} `xml:"box"`
+	Cylinder *struct {
+		Radius float64 `xml:"radius,attr"`
+		Length float64 `xml:"length,attr"`
+	} `xml:"cylinder"`
+	Sphere *struct {
+		Radius float64 `xml:"radius,attr"`
+	} `xml:"sphere"`
+	Mesh *struct {
+		Filename string `xml:"filename,attr"`
+	} `xml:"mesh"`
+}
+
+type urdfShape struct {
+	Origin   *urdfOrigin   `xml:"origin"`
+	Geometry urdfGeometry  `xml:"geometry"`
+	Material *urdfMaterial `xml:"material"`
+}
+
+type urdfLink struct {
+	Name     string `xml:"name,attr"`
+	Inertial *struct {
+		Mass struct {
+			Value float64 `xml:"value,attr"`
+		} `xml:"mass"`
+	} `xml:"inertial"`
+	Visuals    []urdfShape `xml:"visual"`
+	Collisions []urdfShape `xml:"collision"`
+}
+
+type urdfJoint struct {
+	Name   string      `xml:"name,attr"`
+	Type   string      `xml:"type,attr"`
+	Origin *urdfOrigin `xml:"origin"`
+	Parent struct {
+		Link string `xml:"link,attr"`
+	} `xml:"parent"`
+	Child struct {
+		Link string `xml:"link,attr"`
+	} `xml:"child"`
+	Axis *struct {
+		XYZ string `xml:"xyz,attr"`
+	} `xml:"axis"`
+	Limit *struct {
+		Lower    float64 `xml:"lower,attr"`
+		Upper    float64 `xml:"upper,attr"`
+		Effort   float64 `xml:"effort,attr"`
+		Velocity float64 `xml:"velocity,attr"`
+	} `xml:"limit"`
+}
+
+// urdfJointTypes maps URDF joint types to server joint types. Floating and
+// planar joints have no server counterpart.
+var urdfJointTypes = map[string]JointKind{
+	"revolute":   JointHinge,
+	"continuous": JointHinge,
+	"prismatic":  JointSlider,
+	"fixed":      JointFixed,
+}
+
+// URDFOptions controls how a robot description becomes a creature.
+type URDFOptions struct {
+	Name   string    // creature name; defaults to the robot's name
+	Offset []float64 // world position of the root link
+	Scale  float64   // world units per meter, default 1
+}
+
+// loadURDF reads a URDF file and converts it to a creature. Warnings list the
+// parts of the robot that could not be represented.
+func loadURDF(path string, opts URDFOptions) (*Creature, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[URDF] %v", err)
+	}
+	var robot urdfRobot
+	if err := xml.Unmarshal(data, &robot); err != nil {
+		return nil, nil, fmt.Errorf("[URDF] Failed to parse %s: %v", path, err)
+	}
+	c, warnings, err := urdfCreature(&robot, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[URDF] %s: %v", path, err)
+	}
+	return c, warnings, nil
+}
+
+// urdfCreature turns each link with geometry into one cube and each joint
+// between two such links into a joint. A link's box is the bounding box of
+// its first collision shape, or of its first visual if it has no collision;
+// cylinders and spheres are boxed, meshes cannot be measured and get a
+// default cube. Links are placed by walking the joint tree at zero joint positions.
+// Joints are anchored at their origin and keep their axis.
+//
+// URDF is Z-up and in meters, so positions and rotations are converted to
+// the world's Y-up frame and multiplied by Scale. Joint limits map to
+// limit_lower/limit_upper (radians for hinges, scaled lengths for sliders).
+// effort/velocity becomes motor_max_impulse: torque over speed has the units
+// of an angular impulse, and caps how hard the motor can drive the joint.
+func urdfCreature(robot *urdfRobot, opts URDFOptions) (*Creature, []string, error) {
+	if opts.Scale <= 0 {
+		opts.Scale = 1
+	}
+	c := &Creature{Name: opts.Name, Offset: opts.Offset}
+	if c.Name == "" {
+		c.Name = robot.Name
+	}
+	var warnings []string
+
+	colors := make(map[string]string)
+	for _, m := range robot.Materials {
+		if hex, ok := m.hex(); ok {
+			colors[m.Name] = hex
+		}
+	}
+
+	links := make(map[string]*urdfLink, len(robot.Links))
+	for i := range robot.Links {
+		links[robot.Links[i].Name] = &robot.Links[i]
+	}
+	children := make(map[string][]*urdfJoint)
+	isChild := make(map[string]bool)
+	for i := range robot.Joints {
+		j := &robot.Joints[i]
+		if links[j.Parent.Link] == nil || links[j.Child.Link] == nil {
+			return nil, nil, fmt.Errorf("joint %q links unknown links %q and %q", j.Name, j.Parent.Link, j.Child.Link)
+		}
+		children[j.Parent.Link] = append(children[j.Parent.Link], j)
+		isChild[j.Child.Link] = true
+	}
+
+	// Place every link by walking down from the roots.
+	frames := make(map[string]pose, len(links))
+	var place func(name string, at pose)
+	place = func(name string, at pose) {
+		if _, seen := frames[name]; seen {
+			return
+		}
+		frames[name] = at
+		for _, j := range children[name] {
+			place(j.Child.Link, at.compose(j.Origin.pose()))
+		}
+	}
+	for _, link := range robot.Links {
+		if !isChild[link.Name] {
+			place(link.Name, identityPose())
+		}
+	}
+
+	cubes := make(map[string]bool)
+	for _, link := range robot.Links {
+		shape := link.shape()
+		if shape == nil {
+			continue
+		}
+		size, ok := shape.Geometry.size()
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("link %s: mesh geometry replaced by a default cube", link.Name))
+		}
+		at := frames[link.Name].compose(shape.Origin.pose())
+		cube := Cube{
+			Name:     link.Name,
+			Position: scaleVec(urdfToWorld.apply(at.p), opts.Scale),
+			Rotation: urdfToWorld.conjugate(at.r).eulerDegrees(),
+		}
+		if ok {
+			// The axis swap that turns Z-up into Y-up also swaps the
+			// box's local Y and Z edges.
+			cube.Size = scaleVec([]float64{size[0], size[2], size[1]}, opts.Scale)
+		}
+		if link.Inertial != nil {
+			cube.Mass = link.Inertial.Mass.Value
+		}
+		if m := link.material(); m != nil {
+			if hex, ok := m.hex(); ok {
+				cube.Color = hex
+			} else if hex, ok := colors[m.Name]; ok {
+				cube.Color = hex
+			}
+		}
+		c.Cubes = append(c.Cubes, cube)
+		cubes[link.Name] = true
+	}
+
+	for _, j := range robot.Joints {
+		jointType, ok := urdfJointTypes[j.Type]
+		switch {
+		case !ok:
+			warnings = append(warnings, fmt.Sprintf("joint %s: %s joints are not supported", j.Name, j.Type))
+			continue
+		case !cubes[j.Parent.Link] || !cubes[j.Child.Link]:
+			warnings = append(warnings, fmt.Sprintf("joint %s: %s or %s has no geometry", j.Name, j.Parent.Link, j.Child.Link))
+			continue
+		}
+		def := JointDef{Name: j.Name, CubeA: j.Parent.Link, CubeB: j.Child.Link, Type: jointType}
+		// The joint sits at the child link's origin, not on the face the
+		// boxes happen to share.
+		frame := frames[j.Child.Link]
+		def.Anchor = scaleVec(urdfToWorld.apply(frame.p), opts.Scale)
+		if jointType != JointFixed {
+			def.Axis = j.axis(frame)
+		}
+		if j.Limit != nil {
+			def.Params = make(map[string]float64)
+			switch j.Type {
+			case "revolute":
+				lower, upper := max(j.Limit.Lower, -math.Pi), min(j.Limit.Upper, math.Pi)
+				if lower != j.Limit.Lower || upper != j.Limit.Upper {
+					warnings = append(warnings, fmt.Sprintf("joint %s: limits clamped to ±π", j.Name))
+				}
+				def.Params["limit_lower"] = lower
+				def.Params["limit_upper"] = upper
+			case "prismatic":
+				def.Params["linear_limit_lower"] = j.Limit.Lower * opts.Scale
+				def.Params["linear_limit_upper"] = j.Limit.Upper * opts.Scale
+			}
+			// Only hinges have a motor to carry the effort limit.
+			if j.Limit.Effort > 0 && def.Type == JointHinge {
+				impulse := j.Limit.Effort
+				if j.Limit.Velocity > 0 {
+					impulse /= j.Limit.Velocity
+				}
+				def.Params["motor_max_impulse"] = impulse
+			}
+			if len(def.Params) == 0 {
+				def.Params = nil
+			}
+		}
+		c.Joints = append(c.Joints, def)
+	}
+	return c, warnings, nil
+}
+
+// shape returns the shape that stands for the link: its first collision, or
+// its first visual. Links without either, like "world", get no cube.
+func (l *urdfLink) shape() *urdfShape {
+	if len(l.Collisions) > 0 {
+		return &l.Collisions[0]
+	}
+	if len(l.Visuals) > 0 {
+		return &l.Visuals[0]
+	}
+	return nil
+}
+
+// material returns the first visual's material, if any.
+func (l *urdfLink) material() *urdfMaterial {
+	if len(l.Visuals) > 0 {
+		return l.Visuals[0].Material
+	}
+	return nil
+}
+
+// hex converts an inline "r g b a" color in 0-1 to "#RRGGBB".
+func (m *urdfMaterial) hex() (string, bool) {
+	if m.Color == nil {
+		return "", false
+	}
+	rgb := parseFloats(m.Color.RGBA, 4)
+	channel := func(v float64) uint8 { return uint8(math.Round(min(max(v, 0), 1) * 255)) }
+	return formatHex(channel(rgb[0]), channel(rgb[1]), channel(rgb[2])), true
+}
+
+// size returns the edge lengths of the geometry's bounding box in its own
+// frame. It reports false for meshes, which cannot be measured.
+func (g urdfGeometry) size() ([3]float64, bool) {
+	switch {
+	case g.Box != nil:
+		s := parseFloats(g.Box.Size, 3)
+		return [3]float64{s[0], s[1], s[2]}, true
+	case g.Cylinder != nil:
+		d := 2 * g.Cylinder.Radius
+		return [3]float64{d, d, g.Cylinder.Length}, true
+	case g.Sphere != nil:
+		d := 2 * g.Sphere.Radius
+		return [3]float64{d, d, d}, true
+	}
+	return [3]float64{}, false
+}
+
+// axis returns the joint's axis in the world frame. URDF gives it in the
+// joint's frame, which is the child link's, defaulting to X.
+func (j *urdfJoint) axis(frame pose) []float64 {
+	a := [3]float64{1, 0, 0}
+	if j.Axis != nil {
+		xyz := parseFloats(j.Axis.XYZ, 3)
+		if xyz[0] != 0 || xyz[1] != 0 || xyz[2] != 0 {
+			a = [3]float64{xyz[0], xyz[1], xyz[2]}
+		}
+	}
+	return scaleVec(urdfToWorld.apply(frame.r.applyArray(a)), 1)
+}
+
+// pose returns the transform an origin element describes; a missing origin
+// is the identity.
+func (o *urdfOrigin) pose() pose {
+	if o == nil {
+		return identityPose()
+	}
+	xyz := parseFloats(o.XYZ, 3)
+	rpy := parseFloats(o.RPY, 3)
+	return pose{p: [3]float64{xyz[0], xyz[1], xyz[2]}, r: rpyMatrix(rpy[0], rpy[1], rpy[2])}
+}
+
+// parseFloats parses up to n space-separated numbers, leaving missing or
+// malformed ones at zero.
+func parseFloats(text string, n int) []float64 {
+	out := make([]float64, n)
+	for i, field := range strings.Fields(text) {
+		if i < n {
+			out[i], _ = strconv.ParseFloat(field, 64)
+		}
+	}
+	return out
+}
+
+// scaleVec multiplies v by k, rounding away floating-point noise so
+// generated creature files stay readable.
+func scaleVec(v []float64, k float64) []float64 {
+	out := make([]float64, len(v))
+	for i := range v {
+		out[i] = math.Round(v[i]*k*1e6)/1e6 + 0 // + 0 turns -0 into 0
+	}
+	return out
+}
+
+// mat3 is a 3×3 rotation matrix.
+type mat3 [3][3]float64
+
+// pose is a rigid transform: rotate by r, then translate by p.
+type pose struct {
+	p [3]float64
+	r mat3
+}
+
+func identityPose() pose {
+	return pose{r: mat3{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}}
+}
+
+// compose returns the transform that applies b in a's frame.
+func (a pose) compose(b pose) pose {
+	p := a.r.applyArray(b.p)
+	for i := range p {
+		p[i] += a.p[i]
+	}
+	return pose{p: p, r: a.r.mul(b.r)}
+}
+
+// urdfToWorld maps URDF's Z-up axes onto the world's Y-up ones:
+// (x, y, z) becomes (x, z, -y).
+var urdfToWorld = mat3{{1, 0, 0}, {0, 0, 1}, {0, -1, 0}}
+
+func (m mat3) mul(n mat3) mat3 {
+	var out mat3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				out[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+	return out
+}
+
+func (m mat3) transpose() mat3 {
+	var out mat3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			out[i][j] = m[j][i]
+		}
+	}
+	return out
+}
+
+func (m mat3) applyArray(v [3]float64) [3]float64 {
+	var out [3]float64
+	for i := 0; i < 3; i++ {
+		out[i] = m[i][0]*v[0] + m[i][1]*v[1] + m[i][2]*v[2]
+	}
+	return out
+}
+
+func (m mat3) apply(v [3]float64) []float64 {
+	out := m.applyArray(v)
+	return out[:]
+}
+
+// conjugate expresses rotation r, given in the frame m maps from, in the
+// frame m maps to.
+func (m mat3) conjugate(r mat3) mat3 {
+	return m.mul(r).mul(m.transpose())
+}
+
+// rpyMatrix builds the rotation for fixed-axis roll, pitch and yaw in
+// radians: about X, then Y, then Z.
+func rpyMatrix(roll, pitch, yaw float64) mat3 {
+	sr, cr := math.Sincos(roll)
+	sp, cp := math.Sincos(pitch)
+	sy, cy := math.Sincos(yaw)
+	return mat3{
+		{cy * cp, cy*sp*sr - sy*cr, cy*sp*cr + sy*sr},
+		{sy * cp, sy*sp*sr + cy*cr, sy*sp*cr - cy*sr},
+		{-sp, cp * sr, cp * cr},
+	}
+}
+
+// eulerDegrees is the inverse of rpyMatrix, in degrees, as spawn_cube takes
+// rotations.
+func (m mat3) eulerDegrees() []float64 {
+	pitch := math.Asin(min(max(-m[2][0], -1), 1))
+	roll := math.Atan2(m[2][1], m[2][2])
+	yaw := math.Atan2(m[1][0], m[0][0])
+	deg := func(rad float64) float64 {
+		return math.Round(rad*180/math.Pi*1e6)/1e6 + 0
+	}
+	return []float64{deg(roll), deg(pitch), deg(yaw)}
+}
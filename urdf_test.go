@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/xml"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestURDFJointAxis(t *testing.T) {
+	quarter := pose{r: rpyMatrix(0, 0, math.Pi/2)}
+	tests := []struct {
+		name  string
+		xml   string
+		frame pose
+		want  []float64
+	}{
+		{name: "default", xml: `<joint/>`, frame: identityPose(), want: []float64{1, 0, 0}},
+		{name: "all zero", xml: `<joint><axis xyz="0 0 0"/></joint>`, frame: identityPose(), want: []float64{1, 0, 0}},
+		{name: "z up", xml: `<joint><axis xyz="0 0 1"/></joint>`, frame: identityPose(), want: []float64{0, 1, 0}},
+		{name: "y", xml: `<joint><axis xyz="0 1 0"/></joint>`, frame: identityPose(), want: []float64{0, 0, -1}},
+		{name: "turned frame", xml: `<joint><axis xyz="1 0 0"/></joint>`, frame: quarter, want: []float64{0, 0, -1}},
+		{name: "z survives a yaw", xml: `<joint><axis xyz="0 0 1"/></joint>`, frame: quarter, want: []float64{0, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var j urdfJoint
+			if err := xml.Unmarshal([]byte(tt.xml), &j); err != nil {
+				t.Fatal(err)
+			}
+			if got := j.axis(tt.frame); !slices.Equal(got, tt.want) {
+				t.Errorf("axis = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURDFJointFrame(t *testing.T) {
+	robot := urdfRobot{}
+	err := xml.Unmarshal([]byte(`<robot name="arm">
+  <link name="base"><collision><geometry><box size="1 1 1"/></geometry></collision></link>
+  <link name="upper"><collision><geometry><box size="1 1 2"/></geometry></collision></link>
+  <link name="lower"><collision><geometry><box size="1 1 2"/></geometry></collision></link>
+  <joint name="shoulder" type="revolute">
+    <parent link="base"/><child link="upper"/>
+    <origin xyz="0 0 0.5" rpy="0 0 1.5707963267948966"/>
+    <axis xyz="0 1 0"/>
+  </joint>
+  <joint name="weld" type="fixed">
+    <parent link="upper"/><child link="lower"/>
+    <origin xyz="1 0 2"/>
+  </joint>
+</robot>`), &robot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := urdfCreature(&robot, URDFOptions{Scale: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		joint  JointDef
+		anchor []float64
+		axis   []float64
+	}{
+		// The yaw turns the joint's Y onto URDF's -X.
+		{c.Joints[0], []float64{0, 1, 0}, []float64{-1, 0, 0}},
+		// (1, 0, 2) in the yawed frame is (0, 1, 2.5) in URDF's.
+		{c.Joints[1], []float64{0, 5, -2}, nil},
+	}
+	for _, tt := range tests {
+		if !slices.Equal(tt.joint.Anchor, tt.anchor) || !slices.Equal(tt.joint.Axis, tt.axis) {
+			t.Errorf("joint %s at %v axis %v, want at %v axis %v", tt.joint.Name, tt.joint.Anchor, tt.joint.Axis, tt.anchor, tt.axis)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// VoxFile is the content of a MagicaVoxel .vox file that matters for cubes:
+// the models, where the scene places them, and the palette.
+type VoxFile struct {
+	Models  []VoxModel
+	Palette [256]string // "#RRGGBB" by color index; index 0 is empty space
+	// Placements lists every model instance in the scene graph. Files
+	// without a scene graph get one placement per model at the origin.
+	Placements []VoxPlacement
+}
+
+// VoxModel is one model: its bounding size and its voxels in model space.
+type VoxModel struct {
+	Size   [3]int
+	Voxels []Voxel
+}
+
+// Voxel is a filled cell with its palette color index (1-255).
+type Voxel struct {
+	X, Y, Z, Color uint8
+}
+
+// VoxPlacement positions a model in the scene. Translation is the world
+// position of the model's center, in voxels, Z up.
+type VoxPlacement struct {
+	Model       int
+	Translation [3]int
+}
+
+// defaultVoxPalette is the palette MagicaVoxel uses when a file has no RGBA
+// chunk: a 6×6×6 color cube from white down to dark blue (black left out),
+// followed by ten-step ramps of red, green, blue and gray.
+func defaultVoxPalette() [256]string {
+	var p [256]string
+	i := 1
+	for r := 5; r >= 0; r-- {
+		for g := 5; g >= 0; g-- {
+			for b := 5; b >= 0; b-- {
+				if r == 0 && g == 0 && b == 0 {
+					continue
+				}
+				p[i] = formatHex(uint8(r*0x33), uint8(g*0x33), uint8(b*0x33))
+				i++
+			}
+		}
+	}
+	ramp := []uint8{0xEE, 0xDD, 0xBB, 0xAA, 0x88, 0x77, 0x55, 0x44, 0x22, 0x11}
+	for _, channel := range [][3]bool{{true, false, false}, {false, true, false}, {false, false, true}, {true, true, true}} {
+		for _, v := range ramp {
+			var rgb [3]uint8
+			for c, on := range channel {
+				if on {
+					rgb[c] = v
+				}
+			}
+			p[i] = formatHex(rgb[0], rgb[1], rgb[2])
+			i++
+		}
+	}
+	return p
+}
+
+// loadVox reads a .vox file.
+func loadVox(path string) (*VoxFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[Vox] %v", err)
+	}
+	vox, err := parseVox(data)
+	if err != nil {
+		return nil, fmt.Errorf("[Vox] %s: %v", path, err)
+	}
+	return vox, nil
+}
+
+// voxReader decodes the little-endian primitives .vox files are made of.
+type voxReader struct {
+	data []byte
+	err  error
+}
+
+func (r *voxReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = fmt.Errorf("unexpected end of data")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *voxReader) int32() int {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return int(int32(binary.LittleEndian.Uint32(b)))
+}
+
+func (r *voxReader) string() string {
+	return string(r.bytes(r.int32()))
+}
+
+func (r *voxReader) dict() map[string]string {
+	n := r.int32()
+	d := make(map[string]string)
+	for i := 0; i < n && r.err == nil; i++ {
+		key := r.string()
+		d[key] = r.string()
+	}
+	return d
+}
+
+// voxNode is a scene graph node: a transform (nTRN), a group (nGRP) or a
+// shape (nSHP).
+type voxNode struct {
+	translation [3]int
+	children    []int
+	models      []int
+}
+
+// parseVox decodes the chunks of a .vox file. Models, palette and the scene
+// graph's translations are read; materials, layers, cameras and rotations are
+// ignored.
+func parseVox(data []byte) (*VoxFile, error) {
+	r := &voxReader{data: data}
+	if magic := string(r.bytes(4)); magic != "VOX " {
+		return nil, fmt.Errorf("not a MagicaVoxel file")
+	}
+	r.int32() // version
+
+	vox := &VoxFile{Palette: defaultVoxPalette()}
+	nodes := make(map[int]*voxNode)
+	var size [3]int
+	for r.err == nil && len(r.data) > 0 {
+		id := string(r.bytes(4))
+		n := r.int32()
+		r.int32() // children size; MAIN's children simply follow its content
+		content := &voxReader{data: r.bytes(n)}
+		if r.err != nil {
+			break
+		}
+
+		switch id {
+		case "SIZE":
+			size = [3]int{content.int32(), content.int32(), content.int32()}
+		case "XYZI":
+			n := content.int32()
+			// The count comes from the file; check it against the chunk
+			// before allocating for it.
+			if n < 0 || n > len(content.data)/4 {
+				return nil, fmt.Errorf("chunk XYZI: %d voxels do not fit in %d bytes", n, len(content.data))
+			}
+			model := VoxModel{Size: size, Voxels: make([]Voxel, 0, n)}
+			for i := 0; i < n && content.err == nil; i++ {
+				b := content.bytes(4)
+				if b != nil {
+					model.Voxels = append(model.Voxels, Voxel{X: b[0], Y: b[1], Z: b[2], Color: b[3]})
+				}
+			}
+			vox.Models = append(vox.Models, model)
+		case "RGBA":
+			// Entry i holds color index i+1.
+			for i := 1; i < 256 && content.err == nil; i++ {
+				if b := content.bytes(4); b != nil {
+					vox.Palette[i] = formatHex(b[0], b[1], b[2])
+				}
+			}
+		case "nTRN":
+			node := &voxNode{}
+			nodes[content.int32()] = node
+			content.dict()
+			node.children = []int{content.int32()}
+			content.int32() // reserved
+			content.int32() // layer
+			if frames := content.int32(); frames > 0 {
+				if t, ok := content.dict()["_t"]; ok {
+					node.translation = parseVoxVec(t)
+				}
+			}
+		case "nGRP":
+			node := &voxNode{}
+			nodes[content.int32()] = node
+			content.dict()
+			n := content.int32()
+			for i := 0; i < n && content.err == nil; i++ {
+				node.children = append(node.children, content.int32())
+			}
+		case "nSHP":
+			node := &voxNode{}
+			nodes[content.int32()] = node
+			content.dict()
+			n := content.int32()
+			for i := 0; i < n && content.err == nil; i++ {
+				node.models = append(node.models, content.int32())
+				content.dict()
+			}
+		}
+		if content.err != nil {
+			return nil, fmt.Errorf("chunk %s: %v", id, content.err)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(vox.Models) == 0 {
+		return nil, fmt.Errorf("no models")
+	}
+
+	if _, ok := nodes[0]; ok {
+		vox.walkScene(nodes, 0, [3]int{}, 0)
+	}
+	if len(vox.Placements) == 0 {
+		for i := range vox.Models {
+			vox.Placements = append(vox.Placements, VoxPlacement{Model: i})
+		}
+	}
+	return vox, nil
+}
+
+// walkScene accumulates translations down the scene graph and records a
+// placement for every shape it reaches.
+func (v *VoxFile) walkScene(nodes map[int]*voxNode, id int, t [3]int, depth int) {
+	node, ok := nodes[id]
+	if !ok || depth > len(nodes) {
+		return
+	}
+	for c := range t {
+		t[c] += node.translation[c]
+	}
+	for _, model := range node.models {
+		if model >= 0 && model < len(v.Models) {
+			v.Placements = append(v.Placements, VoxPlacement{Model: model, Translation: t})
+		}
+	}
+	for _, child := range node.children {
+		v.walkScene(nodes, child, t, depth+1)
+	}
+}
+
+// parseVoxVec parses a scene graph vector such as "12 -4 0".
+func parseVoxVec(text string) [3]int {
+	var v [3]int
+	for i, field := range strings.Fields(text) {
+		if i < 3 {
+			v[i], _ = strconv.Atoi(field)
+		}
+	}
+	return v
+}
+
+// voxCreature turns every voxel into a cube. MagicaVoxel is Z-up, so voxel
+// (x, y, z) becomes grid cell (x, z, -y). Each palette index in use becomes a
+// material ("vox12") so recoloring a creature file recolors all its voxels.
+func voxCreature(vox *VoxFile, opts VoxelOptions) *Creature {
+	cells := make(map[gridCell]string)
+	palette := Palette{}
+	for _, p := range vox.Placements {
+		model := vox.Models[p.Model]
+		for _, v := range model.Voxels {
+			material := fmt.Sprintf("vox%d", v.Color)
+			palette[material] = vox.Palette[v.Color]
+			cells[gridCell{
+				p.Translation[0] + int(v.X) - model.Size[0]/2,
+				p.Translation[2] + int(v.Z) - model.Size[2]/2,
+				-(p.Translation[1] + int(v.Y) - model.Size[1]/2),
+			}] = material
+		}
+	}
+	return voxelCreature(cells, palette, opts)
+}
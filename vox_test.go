@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// voxWriter builds .vox files for tests.
+type voxWriter struct {
+	bytes.Buffer
+}
+
+func (w *voxWriter) int32(v int) *voxWriter {
+	binary.Write(&w.Buffer, binary.LittleEndian, int32(v))
+	return w
+}
+
+func (w *voxWriter) string(s string) *voxWriter {
+	w.int32(len(s))
+	w.WriteString(s)
+	return w
+}
+
+func (w *voxWriter) dict(kv ...string) *voxWriter {
+	w.int32(len(kv) / 2)
+	for _, s := range kv {
+		w.string(s)
+	}
+	return w
+}
+
+// chunk appends a chunk with content and no children.
+func (w *voxWriter) chunk(id string, content []byte) *voxWriter {
+	w.WriteString(id)
+	w.int32(len(content))
+	w.int32(0)
+	w.Write(content)
+	return w
+}
+
+func voxFile(chunks ...func(*voxWriter)) []byte {
+	w := &voxWriter{}
+	w.WriteString("VOX ")
+	w.int32(150)
+	w.WriteString("MAIN")
+	w.int32(0)
+	w.int32(0)
+	for _, c := range chunks {
+		c(w)
+	}
+	return w.Bytes()
+}
+
+func sizeChunk(x, y, z int) func(*voxWriter) {
+	return func(w *voxWriter) {
+		w.chunk("SIZE", (&voxWriter{}).int32(x).int32(y).int32(z).Bytes())
+	}
+}
+
+// xyziChunk writes voxels as x, y, z, color quadruples, claiming count
+// voxels.
+func xyziChunk(count int, voxels ...[4]byte) func(*voxWriter) {
+	return func(w *voxWriter) {
+		c := (&voxWriter{}).int32(count)
+		for _, v := range voxels {
+			c.Write(v[:])
+		}
+		w.chunk("XYZI", c.Bytes())
+	}
+}
+
+func rawChunk(id string, content *voxWriter) func(*voxWriter) {
+	return func(w *voxWriter) { w.chunk(id, content.Bytes()) }
+}
+
+func TestParseVox(t *testing.T) {
+	red := func(w *voxWriter) {
+		c := &voxWriter{}
+		c.Write([]byte{0xff, 0, 0, 0xff})
+		for i := 1; i < 256; i++ {
+			c.Write([]byte{0, 0, 0, 0xff})
+		}
+		w.chunk("RGBA", c.Bytes())
+	}
+	// A root transform moving a group by (1,2,3), whose transform moves
+	// the model's shape by a further (10,0,0).
+	scene := []func(*voxWriter){
+		rawChunk("nTRN", (&voxWriter{}).int32(0).dict().int32(1).int32(-1).int32(0).int32(1).dict("_t", "1 2 3")),
+		rawChunk("nGRP", (&voxWriter{}).int32(1).dict().int32(1).int32(2)),
+		rawChunk("nTRN", (&voxWriter{}).int32(2).dict().int32(3).int32(-1).int32(0).int32(1).dict("_t", "10 0 0")),
+		rawChunk("nSHP", (&voxWriter{}).int32(3).dict().int32(1).int32(0).dict()),
+	}
+
+	tests := []struct {
+		name           string
+		data           []byte
+		wantErr        string
+		wantModels     int
+		wantVoxels     int
+		wantSize       [3]int
+		wantColor1     string
+		wantPlacements []VoxPlacement
+	}{
+		{
+			name:           "one model",
+			data:           voxFile(sizeChunk(2, 3, 4), xyziChunk(2, [4]byte{0, 0, 0, 1}, [4]byte{1, 2, 3, 9})),
+			wantModels:     1,
+			wantVoxels:     2,
+			wantSize:       [3]int{2, 3, 4},
+			wantColor1:     "#FFFFFF",
+			wantPlacements: []VoxPlacement{{Model: 0}},
+		},
+		{
+			name:           "palette",
+			data:           voxFile(sizeChunk(1, 1, 1), xyziChunk(1, [4]byte{0, 0, 0, 1}), red),
+			wantModels:     1,
+			wantVoxels:     1,
+			wantSize:       [3]int{1, 1, 1},
+			wantColor1:     "#FF0000",
+			wantPlacements: []VoxPlacement{{Model: 0}},
+		},
+		{
+			name:           "two models",
+			data:           voxFile(sizeChunk(1, 1, 1), xyziChunk(0), sizeChunk(2, 2, 2), xyziChunk(1, [4]byte{1, 1, 1, 5})),
+			wantModels:     2,
+			wantVoxels:     0,
+			wantSize:       [3]int{1, 1, 1},
+			wantColor1:     "#FFFFFF",
+			wantPlacements: []VoxPlacement{{Model: 0}, {Model: 1}},
+		},
+		{
+			name:           "scene graph",
+			data:           voxFile(append([]func(*voxWriter){sizeChunk(1, 1, 1), xyziChunk(1, [4]byte{0, 0, 0, 1})}, scene...)...),
+			wantModels:     1,
+			wantVoxels:     1,
+			wantSize:       [3]int{1, 1, 1},
+			wantColor1:     "#FFFFFF",
+			wantPlacements: []VoxPlacement{{Model: 0, Translation: [3]int{11, 2, 3}}},
+		},
+		{name: "not vox", data: []byte("PK\x03\x04 not a vox file"), wantErr: "not a MagicaVoxel file"},
+		{name: "empty", data: nil, wantErr: "not a MagicaVoxel file"},
+		{name: "no models", data: voxFile(sizeChunk(1, 1, 1)), wantErr: "no models"},
+		{
+			name:    "count past the chunk",
+			data:    voxFile(sizeChunk(1, 1, 1), xyziChunk(1<<30, [4]byte{0, 0, 0, 1})),
+			wantErr: "chunk XYZI: 1073741824 voxels do not fit in 4 bytes",
+		},
+		{
+			name:    "negative count",
+			data:    voxFile(sizeChunk(1, 1, 1), xyziChunk(-1)),
+			wantErr: "chunk XYZI: -1 voxels do not fit",
+		},
+		{
+			name:    "truncated chunk",
+			data:    voxFile(sizeChunk(1, 1, 1), xyziChunk(1, [4]byte{0, 0, 0, 1}))[:40],
+			wantErr: "unexpected end of data",
+		},
+		{
+			name:    "truncated content",
+			data:    voxFile(rawChunk("SIZE", (&voxWriter{}).int32(1))),
+			wantErr: "chunk SIZE: unexpected end of data",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vox, err := parseVox(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseVox = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVox: %v", err)
+			}
+			if len(vox.Models) != tt.wantModels {
+				t.Fatalf("%d models, want %d", len(vox.Models), tt.wantModels)
+			}
+			if m := vox.Models[0]; len(m.Voxels) != tt.wantVoxels || m.Size != tt.wantSize {
+				t.Errorf("model 0 has %d voxels in %v, want %d in %v", len(m.Voxels), m.Size, tt.wantVoxels, tt.wantSize)
+			}
+			if vox.Palette[1] != tt.wantColor1 {
+				t.Errorf("color 1 = %s, want %s", vox.Palette[1], tt.wantColor1)
+			}
+			if len(vox.Placements) != len(tt.wantPlacements) {
+				t.Fatalf("placements = %v, want %v", vox.Placements, tt.wantPlacements)
+			}
+			for i, p := range vox.Placements {
+				if p != tt.wantPlacements[i] {
+					t.Errorf("placement %d = %v, want %v", i, p, tt.wantPlacements[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseVoxVoxels(t *testing.T) {
+	vox, err := parseVox(voxFile(sizeChunk(4, 4, 4), xyziChunk(2, [4]byte{1, 2, 3, 7}, [4]byte{3, 0, 1, 255})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Voxel{{X: 1, Y: 2, Z: 3, Color: 7}, {X: 3, Y: 0, Z: 1, Color: 255}}
+	for i, v := range vox.Models[0].Voxels {
+		if v != want[i] {
+			t.Errorf("voxel %d = %+v, want %+v", i, v, want[i])
+		}
+	}
+}
+
+func TestDefaultVoxPalette(t *testing.T) {
+	p := defaultVoxPalette()
+	tests := map[int]string{
+		0:   "",
+		1:   "#FFFFFF",
+		215: "#000033",
+		216: "#EE0000",
+		246: "#EEEEEE",
+		255: "#111111",
+	}
+	for i, want := range tests {
+		if p[i] != want {
+			t.Errorf("color %d = %q, want %q", i, p[i], want)
+		}
+	}
+}
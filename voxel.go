@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// gridCell is a cell of a Y-up voxel grid.
+type gridCell struct{ x, y, z int }
+
+// VoxelOptions controls how a grid of voxels becomes a creature.
+type VoxelOptions struct {
+	Name      string    // creature name and cube prefix
+	Offset    []float64 // world position of the model's bottom center
+	Spacing   float64   // distance between cube centers, default 1
+	JointType JointKind // joint type for auto-jointing; empty leaves cubes unjointed
+}
+
+// voxelCreature turns filled cells into cubes, each colored with its cell's
+// material from palette. The model is centered horizontally with its lowest
+// cells at the offset's height; cubes are named "v_<x>_<y>_<z>" counting from
+// the model's minimum corner. With a joint type, each connected group of
+// cells is tied together by a spanning tree of joints: one joint per cube
+// rather than one per touching face.
+func voxelCreature(cells map[gridCell]string, palette Palette, opts VoxelOptions) *Creature {
+	if opts.Spacing <= 0 {
+		opts.Spacing = 1
+	}
+	c := &Creature{Name: opts.Name, Offset: opts.Offset, Palette: palette}
+	if len(cells) == 0 {
+		return c
+	}
+
+	sorted := make([]gridCell, 0, len(cells))
+	for at := range cells {
+		sorted = append(sorted, at)
+	}
+	slices.SortFunc(sorted, func(a, b gridCell) int {
+		if a.y != b.y {
+			return a.y - b.y
+		}
+		if a.z != b.z {
+			return a.z - b.z
+		}
+		return a.x - b.x
+	})
+	lo, hi := sorted[0], sorted[0]
+	for _, at := range sorted {
+		lo = gridCell{min(lo.x, at.x), min(lo.y, at.y), min(lo.z, at.z)}
+		hi = gridCell{max(hi.x, at.x), max(hi.y, at.y), max(hi.z, at.z)}
+	}
+	cx, cz := float64(lo.x+hi.x)/2, float64(lo.z+hi.z)/2
+
+	name := func(at gridCell) string {
+		return fmt.Sprintf("v_%d_%d_%d", at.x-lo.x, at.y-lo.y, at.z-lo.z)
+	}
+	for _, at := range sorted {
+		c.Cubes = append(c.Cubes, Cube{
+			Name: name(at),
+			Position: []float64{
+				(float64(at.x) - cx) * opts.Spacing,
+				float64(at.y-lo.y) * opts.Spacing,
+				(float64(at.z) - cz) * opts.Spacing,
+			},
+			Material: cells[at],
+		})
+	}
+
+	if opts.JointType == "" {
+		return c
+	}
+	visited := make(map[gridCell]bool, len(cells))
+	neighbors := []gridCell{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}}
+	for _, root := range sorted {
+		if visited[root] {
+			continue
+		}
+		visited[root] = true
+		queue := []gridCell{root}
+		for len(queue) > 0 {
+			at := queue[0]
+			queue = queue[1:]
+			for _, d := range neighbors {
+				next := gridCell{at.x + d.x, at.y + d.y, at.z + d.z}
+				if _, filled := cells[next]; !filled || visited[next] {
+					continue
+				}
+				visited[next] = true
+				queue = append(queue, next)
+				c.Joints = append(c.Joints, JointDef{
+					Name:  fmt.Sprintf("joint_%s_%s", name(at), name(next)),
+					CubeA: name(at),
+					CubeB: name(next),
+					Type:  opts.JointType,
+				})
+			}
+		}
+	}
+	return c
+}
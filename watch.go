@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+)
+
+// watchCreature applies the creature in path and then keeps polling the file.
+// Every time its contents change it plans against the running world and
+// applies only the difference: recolors, joint retunes and respawns of the
+// cubes that actually changed. Invalid edits are reported and skipped until
+// the file is fixed. It returns when stop is closed.
+func (s *Session) watchCreature(path string, interval time.Duration, stop <-chan struct{}) error {
+	last, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("[Watch] %v", err)
+	}
+	s.reloadCreature(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil || bytes.Equal(data, last) {
+			continue
+		}
+		// Editors often write in several steps; wait for the file to settle.
+		time.Sleep(interval / 2)
+		if settled, err := os.ReadFile(path); err != nil || !bytes.Equal(settled, data) {
+			continue
+		}
+		last = data
+		s.reloadCreature(path)
+	}
+}
+
+// reloadCreature reconciles the world with the current contents of path.
+func (s *Session) reloadCreature(path string) {
+	start := time.Now()
+	plan, err := s.reconcileFile(path, true)
+	if err != nil {
+		fmt.Println("[Watch]", err)
+		return
+	}
+	if plan.Empty() {
+		fmt.Printf("[Watch] %s: no changes\n", path)
+		return
+	}
+	fmt.Print(plan)
+	fmt.Printf("[Watch] %s: applied %d changes in %v\n", path, len(plan.Actions), time.Since(start).Round(time.Millisecond))
+}